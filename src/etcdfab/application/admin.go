@@ -0,0 +1,155 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Serve answers the admin endpoints on the configured admin listen address
+// until ctx is done. It is meant to run next to a member started by start,
+// since run serves the same endpoints itself.
+func (a Application) Serve(ctx context.Context) error {
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	if cfg.Etcd.AdminListenAddress == "" {
+		err := errors.New("admin listen address is not configured")
+		a.logger.Error("application.admin.serve.failed", err)
+		return err
+	}
+
+	server, err := a.serveAdmin(cfg)
+	if err != nil {
+		return err
+	}
+
+	<-ctx.Done()
+	a.logger.Info("application.admin.close")
+	return server.Close()
+}
+
+func (a Application) serveAdmin(cfg config.Config) (*http.Server, error) {
+	listener, err := net.Listen("tcp", cfg.Etcd.AdminListenAddress)
+	if err != nil {
+		a.logger.Error("application.admin.listen.failed", err)
+		return nil, err
+	}
+
+	a.logger.Info("application.admin.serve", lager.Data{
+		"address": listener.Addr().String(),
+	})
+
+	server := &http.Server{Handler: a.adminHandler(cfg)}
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			a.logger.Error("application.admin.serve.failed", err)
+		}
+	}()
+
+	return server, nil
+}
+
+// adminHandler serves /healthz, which answers whether the etcd process in
+// the pid file is alive, /readyz, which answers whether the member is
+// registered, sees a leader and has synced with it, /metrics, which returns
+// the metrics of this invocation in the Prometheus text format, and /status,
+// which returns the same report as the status command.
+func (a Application) adminHandler(cfg config.Config) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		err := a.checkAlive(cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		err := a.checkReady(r.Context(), cfg)
+		if err != nil {
+			a.logger.Info("application.admin.not-ready", lager.Data{
+				"error": err.Error(),
+			})
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		a.metrics.Write(w)
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		report := a.buildStatusReport(r.Context(), cfg)
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	})
+
+	return mux
+}
+
+func (a Application) checkAlive(cfg config.Config) error {
+	pidFileContents, err := ioutil.ReadFile(cfg.PidFile())
+	if err != nil {
+		return err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidFileContents)))
+	if err != nil {
+		return fmt.Errorf("invalid pid file: %s", err)
+	}
+
+	if !a.command.Running(pid) {
+		return fmt.Errorf("etcd process %d is not running", pid)
+	}
+
+	return nil
+}
+
+func (a Application) checkReady(ctx context.Context, cfg config.Config) error {
+	memberList, err := a.etcdClient.MemberList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list members: %s", err)
+	}
+
+	registered := false
+	for _, member := range memberList {
+		if member.Name == cfg.NodeName() {
+			registered = true
+		}
+	}
+	if !registered {
+		return fmt.Errorf("member %s is not in the member list", cfg.NodeName())
+	}
+
+	err = a.syncController.CheckSynced(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("member is not synced: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package application_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Serve", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newArgs func(etcdConfiguration map[string]interface{}) application.NewArgs
+
+		app application.Application
+	)
+
+	newApp := func(adminListenAddress string) application.Application {
+		args := newArgs(map[string]interface{}{
+			"admin_listen_address": adminListenAddress,
+		})
+		args.Metrics = metrics.NewRegistry()
+		return application.New(args)
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newArgs = func(etcdConfiguration map[string]interface{}) application.NewArgs {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			}
+		}
+
+		fakeCommand.RunningCall.Returns.Running = true
+		fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+			{
+				ID:         "some-id-2",
+				Name:       "some-name-2",
+				PeerURLs:   []string{"http://some-ip-2:7001"},
+				ClientURLs: []string{"http://some-ip-2:4001"},
+			},
+			{
+				ID:         "some-id-3",
+				Name:       "some-name-3",
+				PeerURLs:   []string{"http://some-external-ip:7001"},
+				ClientURLs: []string{"http://some-external-ip:4001"},
+			},
+		}
+		fakeEtcdClient.LeaderCall.Returns.Leader = fakeEtcdClient.MemberListCall.Returns.MemberList[0]
+		fakeEtcdClient.EndpointHealthCall.Returns.Healthy = true
+
+		Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte("12345"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Context("when an admin listen address is configured", func() {
+		var (
+			address string
+			cancel  context.CancelFunc
+			served  chan error
+		)
+
+		BeforeEach(func() {
+			address = ""
+			app = newApp("127.0.0.1:0")
+
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			served = make(chan error, 1)
+			go func() {
+				served <- app.Serve(ctx)
+			}()
+
+			Eventually(func() string {
+				for _, message := range fakeLogger.Messages() {
+					if message.Action == "application.admin.serve" {
+						address = message.Data[0]["address"].(string)
+					}
+				}
+				return address
+			}).ShouldNot(BeEmpty())
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(served).Should(Receive(BeNil()))
+		})
+
+		get := func(path string) (int, string) {
+			response, err := http.Get(fmt.Sprintf("http://%s%s", address, path))
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+
+			body, err := ioutil.ReadAll(response.Body)
+			Expect(err).NotTo(HaveOccurred())
+
+			return response.StatusCode, string(body)
+		}
+
+		Describe("/healthz", func() {
+			It("reports ok while the etcd process is running", func() {
+				status, body := get("/healthz")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(Equal("ok\n"))
+			})
+
+			It("reports unavailable when the etcd process is not running", func() {
+				fakeCommand.RunningCall.Returns.Running = false
+
+				status, body := get("/healthz")
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(body).To(Equal("etcd process 12345 is not running\n"))
+			})
+
+			It("reports unavailable when there is no pid file", func() {
+				Expect(os.Remove(filepath.Join(runDir, "etcd.pid"))).To(Succeed())
+
+				status, body := get("/healthz")
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(body).To(ContainSubstring("no such file or directory"))
+			})
+		})
+
+		Describe("/readyz", func() {
+			It("reports ok when the member is registered and synced", func() {
+				status, body := get("/readyz")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(Equal("ok\n"))
+
+				Expect(fakeSyncController.CheckSyncedCall.Receives.Config.NodeName()).To(Equal("some-name-3"))
+			})
+
+			It("reports unavailable when the member list cannot be read", func() {
+				fakeEtcdClient.MemberListCall.Returns.Error = errors.New("connection refused")
+
+				status, body := get("/readyz")
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(body).To(Equal("failed to list members: connection refused\n"))
+			})
+
+			It("reports unavailable when the member is not in the member list", func() {
+				fakeEtcdClient.MemberListCall.Returns.MemberList = fakeEtcdClient.MemberListCall.Returns.MemberList[:1]
+
+				status, body := get("/readyz")
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(body).To(Equal("member some-name-3 is not in the member list\n"))
+			})
+
+			It("reports unavailable when the member is not synced", func() {
+				fakeSyncController.CheckSyncedCall.Returns.Error = errors.New("cluster has no leader")
+
+				status, body := get("/readyz")
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(body).To(Equal("member is not synced: cluster has no leader\n"))
+			})
+		})
+
+		Describe("/metrics", func() {
+			It("returns the metrics in the prometheus text format", func() {
+				status, body := get("/metrics")
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(ContainSubstring("# TYPE etcdfab_kill_escalations_total counter\netcdfab_kill_escalations_total 0\n"))
+			})
+		})
+
+		Describe("/status", func() {
+			It("returns the status report", func() {
+				status, body := get("/status")
+				Expect(status).To(Equal(http.StatusOK))
+
+				var report application.StatusReport
+				Expect(json.Unmarshal([]byte(body), &report)).To(Succeed())
+				Expect(report.Name).To(Equal("some-name-3"))
+				Expect(report.Registered).To(BeTrue())
+				Expect(report.Pid).To(Equal(12345))
+				Expect(report.Leader).To(Equal("some-name-2"))
+				Expect(report.Members).To(HaveLen(2))
+			})
+		})
+	})
+
+	Context("failure cases", func() {
+		Context("when no admin listen address is configured", func() {
+			It("returns an error", func() {
+				app = newApp("")
+
+				err := app.Serve(context.Background())
+				Expect(err).To(MatchError("admin listen address is not configured"))
+			})
+		})
+
+		Context("when the admin listen address cannot be listened on", func() {
+			It("returns an error", func() {
+				app = newApp("not-an-address")
+
+				err := app.Serve(context.Background())
+				Expect(err).To(HaveOccurred())
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.admin.listen.failed",
+					Error:  err,
+				}))
+			})
+		})
+	})
+})
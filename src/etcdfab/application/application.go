@@ -1,49 +1,75 @@
 package application
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
 
 	"code.cloudfoundry.org/lager"
 )
 
 type Application struct {
-	command            command
+	command            commandWrapper
 	configFilePath     string
 	linkConfigFilePath string
 	etcdClient         etcdClient
 	clusterController  clusterController
 	syncController     syncController
+	preflight          preflight
 	outWriter          io.Writer
 	errWriter          io.Writer
 	logger             logger
+	metrics            *metrics.Registry
+	sleep              func(time.Duration)
+	now                func() time.Time
 }
 
-type command interface {
+type commandWrapper interface {
 	Start(string, []string, io.Writer, io.Writer) (int, error)
 	Kill(int) error
+	Stop(int, time.Duration) (command.StopResult, error)
+	Wait(int) error
+	Running(int) bool
 }
 
 type syncController interface {
-	VerifySynced() error
+	VerifySynced(context.Context, config.Config, string) error
+	CheckSynced(context.Context, config.Config) error
+}
+
+type preflight interface {
+	Run(config.Config) error
 }
 
 type clusterController interface {
-	GetInitialClusterState(config.Config) (cluster.InitialClusterState, error)
+	GetInitialClusterState(context.Context, config.Config) (cluster.InitialClusterState, error)
+	GetRemovalQuorum(context.Context, config.Config) (cluster.RemovalQuorum, error)
+	PruneOrphanedMembers(context.Context, config.Config, time.Time) ([]string, error)
+	ReleaseJoinLock(context.Context, config.Config)
 }
 
 type etcdClient interface {
 	Configure(client.Config) error
-	MemberRemove(string) error
-	MemberList() ([]client.Member, error)
+	Self() (client.EtcdClientInterface, error)
+	Close() error
+	MemberRemove(context.Context, string) error
+	MemberList(context.Context) ([]client.Member, error)
+	Leader(context.Context) (client.Member, error)
+	EndpointHealth(context.Context, string) (bool, error)
+	EndpointStatus(context.Context, string) (client.EndpointStatus, error)
 }
 
 type logger interface {
@@ -52,15 +78,19 @@ type logger interface {
 }
 
 type NewArgs struct {
-	Command            command
+	Command            commandWrapper
 	ConfigFilePath     string
 	LinkConfigFilePath string
 	EtcdClient         etcdClient
 	ClusterController  clusterController
 	SyncController     syncController
+	Preflight          preflight
 	OutWriter          io.Writer
 	ErrWriter          io.Writer
 	Logger             logger
+	Metrics            *metrics.Registry
+	Sleep              func(time.Duration)
+	Now                func() time.Time
 }
 
 func New(args NewArgs) Application {
@@ -71,29 +101,134 @@ func New(args NewArgs) Application {
 		etcdClient:         args.EtcdClient,
 		clusterController:  args.ClusterController,
 		syncController:     args.SyncController,
+		preflight:          args.Preflight,
 		outWriter:          args.OutWriter,
 		errWriter:          args.ErrWriter,
 		logger:             args.Logger,
+		metrics:            args.Metrics,
+		sleep:              args.Sleep,
+		now:                args.Now,
+	}
+}
+
+// Start gives up once ctx is done or the configured start deadline has
+// passed, whichever comes first.
+func (a Application) Start(ctx context.Context) error {
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Etcd.StartDeadline)*time.Second)
+	defer cancel()
+
+	startedAt := time.Now()
+	_, _, err = a.start(ctx, cfg)
+	a.metrics.Observe(metrics.StartDuration, time.Since(startedAt).Seconds())
+	a.writeMetrics(cfg)
+
+	return err
+}
+
+// Run starts etcd like Start does, but stays in the foreground as the parent
+// of the etcd process. Whenever etcd exits it is restarted with exponential
+// backoff until it has exited more often than the crash budget allows within
+// the crash window. Once ctx is done Run leaves the cluster and stops etcd the
+// way Stop does, and returns. The start deadline applies to the first start
+// only. When an admin listen address is configured, the admin endpoints are
+// served for as long as Run runs, and when pruning orphaned members is enabled
+// orphans are looked for while etcd runs as well as after it has started.
+func (a Application) Run(ctx context.Context) error {
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	if cfg.Etcd.AdminListenAddress != "" {
+		server, err := a.serveAdmin(cfg)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+	defer a.writeMetrics(cfg)
+
+	startCtx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Etcd.StartDeadline)*time.Second)
+	startedAt := time.Now()
+	pid, etcdArgs, err := a.start(startCtx, cfg)
+	a.metrics.Observe(metrics.StartDuration, time.Since(startedAt).Seconds())
+	cancel()
+	if err != nil {
+		return err
 	}
+
+	return a.supervise(ctx, cfg, pid, etcdArgs)
 }
 
-func (a Application) Start() error {
+// Preflight runs the checks Start runs before launching etcd without
+// launching it.
+func (a Application) Preflight() error {
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	return a.runPreflight(cfg)
+}
+
+// configure reads the config and configures the etcd client with it. Callers
+// close the etcd client once they are done with it.
+func (a Application) configure() (config.Config, error) {
 	cfg, err := config.ConfigFromJSONs(a.configFilePath, a.linkConfigFilePath)
 	if err != nil {
 		a.logger.Error("application.read-config-file.failed", err)
-		return err
+		return config.Config{}, err
 	}
 
 	err = a.etcdClient.Configure(cfg)
 	if err != nil {
 		a.logger.Error("application.etcd-client.configure.failed", err)
+		return config.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func (a Application) runPreflight(cfg config.Config) error {
+	a.logger.Info("application.preflight")
+	err := a.preflight.Run(cfg)
+	if err != nil {
+		a.logger.Error("application.preflight.failed", err)
 		return err
 	}
 
-	initialClusterState, err := a.clusterController.GetInitialClusterState(cfg)
+	return nil
+}
+
+func (a Application) start(ctx context.Context, cfg config.Config) (int, []string, error) {
+	err := a.runPreflight(cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = a.verifyClusterID(ctx, cfg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	initialClusterState, err := a.clusterController.GetInitialClusterState(ctx, cfg)
 	if err != nil {
 		a.logger.Error("application.cluster-controller.get-initial-cluster-state.failed", err)
-		return err
+		return 0, nil, err
+	}
+
+	// A node joining an existing cluster holds the join lock until etcd has
+	// synced or been cleaned up again, also when ctx is done by then.
+	if initialClusterState.State == "existing" {
+		defer a.clusterController.ReleaseJoinLock(context.Background(), cfg)
 	}
 
 	etcdArgs := a.buildEtcdArgs(cfg)
@@ -110,79 +245,310 @@ func (a Application) Start() error {
 	pid, err := a.command.Start(cfg.Etcd.EtcdPath, etcdArgs, a.outWriter, a.errWriter)
 	if err != nil {
 		a.logger.Error("application.start.failed", err)
-		return err
+		return 0, nil, err
 	}
 
 	a.logger.Info("application.synchronized-controller.verify-synced")
-	syncErr := a.syncController.VerifySynced()
+	syncErr := a.syncController.VerifySynced(ctx, cfg, initialClusterState.State)
 	if syncErr != nil {
 		a.logger.Error("application.synchronized-controller.verify-synced.failed", syncErr)
 
-		if initialClusterState.State == "existing" {
+		// Cleaning up must not be cut short when the start ran out of time.
+		if initialClusterState.State == "existing" && cfg.Etcd.DataDirPolicy != "preserve" {
 			a.logger.Info("application.remove-self-from-cluster")
-			a.removeSelfFromCluster(cfg)
+			a.removeSelfFromCluster(context.Background(), cfg)
 		}
-		a.removeDataDir(cfg)
 
 		a.logger.Info("application.kill")
-		killErr := a.kill(cfg.PidFile())
+		killErr := a.kill(cfg.PidFile(), pid)
 		if killErr != nil {
-			return killErr
+			return 0, nil, killErr
+		}
+		cleanUpErr := a.cleanUpDataDir(cfg)
+		if cleanUpErr != nil {
+			return 0, nil, fmt.Errorf("%s, and cleaning up the data dir failed: %s", syncErr, cleanUpErr)
+		}
+
+		return 0, nil, syncErr
+	}
+
+	err = a.writePidFile(cfg.PidFile(), pid)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	a.recordClusterID(ctx, cfg)
+
+	if cfg.Etcd.PruneOrphanedMembers {
+		a.pruneOrphanedMembers(ctx, cfg)
+	}
+
+	a.logger.Info("application.start.success")
+
+	return pid, etcdArgs, nil
+}
+
+func (a Application) supervise(ctx context.Context, cfg config.Config, pid int, etcdArgs []string) error {
+	initialBackoff := time.Duration(cfg.Etcd.SuperviseInitialBackoff) * time.Millisecond
+	maxBackoff := time.Duration(cfg.Etcd.SuperviseMaxBackoff) * time.Millisecond
+	crashWindow := time.Duration(cfg.Etcd.SuperviseCrashWindow) * time.Second
+
+	// Orphans are looked for once per grace period while etcd runs, so a
+	// member is removed at most two grace periods after it was orphaned rather
+	// than only when etcd is started again.
+	var pruneTicks <-chan time.Time
+	if cfg.Etcd.PruneOrphanedMembers {
+		interval := time.Duration(cfg.Etcd.OrphanedMemberGracePeriod) * time.Second
+		if interval < time.Second {
+			interval = time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		pruneTicks = ticker.C
+	}
+
+	backoff := initialBackoff
+	var exits []time.Time
+	exited := a.wait(pid)
+	for {
+		a.writeMetrics(cfg)
+
+		select {
+		case <-ctx.Done():
+			a.logger.Info("application.run.cancelled")
+			return a.stopSupervised(cfg, pid)
+		case <-pruneTicks:
+			a.pruneOrphanedMembers(ctx, cfg)
+			continue
+		case err := <-exited:
+			if err != nil {
+				a.logger.Error("application.run.etcd-exited", err, lager.Data{"pid": pid})
+			} else {
+				a.logger.Info("application.run.etcd-exited", lager.Data{"pid": pid})
+			}
 		}
-		return syncErr
+
+		err := os.Remove(cfg.PidFile())
+		if err != nil && !os.IsNotExist(err) {
+			a.logger.Error("application.remove-pid-file.failed", err)
+		}
+
+		// Only exits within the crash window count against the crash budget,
+		// and etcd that ran for a whole window is restarted without delay
+		// accumulated by earlier crashes.
+		now := a.now()
+		exits = exitsSince(exits, now.Add(-crashWindow))
+		if len(exits) == 0 {
+			backoff = initialBackoff
+		}
+		exits = append(exits, now)
+
+		if len(exits) > cfg.Etcd.SuperviseMaxRestarts {
+			err := fmt.Errorf("etcd exited %d times, exceeding the crash budget of %d restarts", len(exits), cfg.Etcd.SuperviseMaxRestarts)
+			a.logger.Error("application.run.crash-budget-exhausted", err, lager.Data{
+				"crash-window": crashWindow.String(),
+			})
+			return err
+		}
+
+		a.logger.Info("application.run.restart", lager.Data{
+			"restart": len(exits),
+			"backoff": backoff.String(),
+		})
+		if !a.sleepContext(ctx, backoff) {
+			a.logger.Info("application.run.cancelled")
+			return a.stopSupervised(cfg, 0)
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		pid, err = a.command.Start(cfg.Etcd.EtcdPath, etcdArgs, a.outWriter, a.errWriter)
+		if err != nil {
+			a.logger.Error("application.run.restart.failed", err)
+			return err
+		}
+		exited = a.wait(pid)
+
+		// The data dir already holds the membership of the restarted member, so
+		// etcd ignores --initial-cluster-state and the member rejoins its
+		// cluster whatever state it was first started with.
+		a.logger.Info("application.synchronized-controller.verify-synced")
+		err = a.syncController.VerifySynced(ctx, cfg, "existing")
+		if err != nil {
+			// The kill makes the next Wait return, so a member that never syncs
+			// is charged against the crash budget like any other exit.
+			a.logger.Error("application.synchronized-controller.verify-synced.failed", err)
+			a.logger.Info("application.kill-pid", lager.Data{"pid": pid})
+			err = a.command.Kill(pid)
+			if err != nil {
+				a.logger.Error("application.kill-pid.failed", err)
+				return err
+			}
+
+			if ctx.Err() != nil {
+				a.logger.Info("application.run.cancelled")
+				return a.stopSupervised(cfg, 0)
+			}
+			continue
+		}
+
+		err = a.writePidFile(cfg.PidFile(), pid)
+		if err != nil {
+			return err
+		}
+
+		a.logger.Info("application.run.restart.success", lager.Data{"pid": pid})
 	}
+}
+
+// wait returns a channel that receives the result of waiting for pid to exit.
+func (a Application) wait(pid int) <-chan error {
+	exited := make(chan error, 1)
+	go func() {
+		exited <- a.command.Wait(pid)
+	}()
+	return exited
+}
+
+func exitsSince(exits []time.Time, since time.Time) []time.Time {
+	var recent []time.Time
+	for _, exit := range exits {
+		if exit.After(since) {
+			recent = append(recent, exit)
+		}
+	}
+	return recent
+}
 
+// sleepContext returns false without waiting for the sleep to finish when ctx
+// is done first.
+func (a Application) sleepContext(ctx context.Context, duration time.Duration) bool {
+	slept := make(chan struct{})
+	go func() {
+		a.sleep(duration)
+		close(slept)
+	}()
+
+	select {
+	case <-slept:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (a Application) writePidFile(pidPath string, pid int) error {
 	a.logger.Info("application.write-pid-file", lager.Data{
 		"pid":  pid,
-		"path": cfg.PidFile(),
+		"path": pidPath,
 	})
-	err = ioutil.WriteFile(cfg.PidFile(), []byte(fmt.Sprintf("%d", pid)), 0644)
+	err := ioutil.WriteFile(pidPath, []byte(fmt.Sprintf("%d", pid)), 0644)
 	if err != nil {
 		a.logger.Error("application.write-pid-file.failed", err)
 		return err
 	}
 
-	a.logger.Info("application.start.success")
-
 	return nil
 }
 
-func (a Application) Stop() error {
+// Stop stops etcd after leaving the cluster. Leaving the cluster gives up once
+// ctx is done or the configured stop deadline has passed, and the member then
+// stays in the cluster with its data, but etcd is stopped either way.
+func (a Application) Stop(ctx context.Context) error {
 	a.logger.Info("application.stop")
 
-	cfg, err := config.ConfigFromJSONs(a.configFilePath, a.linkConfigFilePath)
+	cfg, err := a.configure()
 	if err != nil {
-		a.logger.Error("application.read-config-file.failed", err)
 		return err
 	}
+	defer a.etcdClient.Close()
 
-	err = a.etcdClient.Configure(cfg)
-	if err != nil {
-		a.logger.Error("application.etcd-client.configure.failed", err)
-		return err
-	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.Etcd.StopDeadline)*time.Second)
+	defer cancel()
 
-	teardown := a.priorClusterHadOtherNodes(cfg.NodeName())
-	if teardown {
-		a.logger.Info("application.remove-self-from-cluster")
-		a.removeSelfFromCluster(cfg)
-	}
+	stoppedAt := time.Now()
+	err = a.stop(ctx, cfg, func() error {
+		return a.stopEtcd(cfg)
+	})
+	a.metrics.Observe(metrics.StopDuration, time.Since(stoppedAt).Seconds())
+	a.writeMetrics(cfg)
+
+	return err
+}
+
+// stopSupervised leaves the cluster and stops etcd like Stop does once Run is
+// told to stop. It stops the etcd process Run started rather than the one in
+// the pid file, which is gone while a restart is in progress, and pid is 0
+// when that process has already exited. The context Run was given is done by
+// then, so leaving the cluster gets the stop deadline of its own.
+func (a Application) stopSupervised(cfg config.Config, pid int) error {
+	a.logger.Info("application.stop")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Etcd.StopDeadline)*time.Second)
+	defer cancel()
+
+	stoppedAt := time.Now()
+	err := a.stop(ctx, cfg, func() error {
+		if pid == 0 || !a.command.Running(pid) {
+			a.logger.Info("application.stop-pid.not-running", lager.Data{"pid": pid})
+			return nil
+		}
+
+		err := a.stopPid(cfg, pid)
+		if err != nil {
+			return err
+		}
 
-	a.removeDataDir(cfg)
+		return a.removePidFile(cfg.PidFile())
+	})
+	a.metrics.Observe(metrics.StopDuration, time.Since(stoppedAt).Seconds())
+
+	return err
+}
 
-	a.logger.Info("application.kill")
-	err = a.kill(cfg.PidFile())
+func (a Application) stop(ctx context.Context, cfg config.Config, stopEtcd func() error) error {
+	// A preserved data dir is only useful if the member is still part of the
+	// cluster when it starts again, so preserve also keeps the membership.
+	cleanUpDataDir := true
+	if cfg.Etcd.DataDirPolicy != "preserve" {
+		teardown := a.priorClusterHadOtherNodes(ctx, cfg.NodeName())
+		if teardown {
+			if a.removalKeepsQuorum(ctx, cfg) {
+				a.logger.Info("application.remove-self-from-cluster")
+				a.removeSelfFromCluster(ctx, cfg)
+			} else {
+				// The member stays in the cluster, so it must keep its data to be
+				// able to rejoin when it starts again.
+				cleanUpDataDir = false
+			}
+		}
+	}
+
+	// etcd writes to its data dir until it has exited, so the data dir policy
+	// is only applied once it has.
+	a.logger.Info("application.stop-etcd")
+	err := stopEtcd()
 	if err != nil {
 		return err
 	}
 
+	if cleanUpDataDir {
+		err = a.cleanUpDataDir(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
 	a.logger.Info("application.stop.success")
 	return nil
 }
 
-func (a Application) priorClusterHadOtherNodes(nodeName string) bool {
+func (a Application) priorClusterHadOtherNodes(ctx context.Context, nodeName string) bool {
 	a.logger.Info("application.etcd-client.member-list")
-	memberList, err := a.etcdClient.MemberList()
+	memberList, err := a.etcdClient.MemberList(ctx)
 	if err != nil {
 		a.logger.Error("application.etcd-client.member-list.failed", err)
 		return false
@@ -204,10 +570,61 @@ func (a Application) priorClusterHadOtherNodes(nodeName string) bool {
 	return false
 }
 
-func (a Application) removeSelfFromCluster(cfg config.Config) {
-	memberList, err := a.etcdClient.MemberList()
+// removalKeepsQuorum reports whether the cluster still has enough healthy
+// voters for quorum once this member is gone. With the "wait" policy it keeps
+// checking until the configured timeout before giving up.
+func (a Application) removalKeepsQuorum(ctx context.Context, cfg config.Config) bool {
+	policy := cfg.Etcd.MemberRemovalQuorumPolicy
+	timeout := time.Duration(cfg.Etcd.MemberRemovalQuorumWaitTimeout) * time.Second
+
+	for waited := time.Duration(0); ; waited += time.Second {
+		a.logger.Info("application.cluster-controller.get-removal-quorum")
+		removalQuorum, err := a.clusterController.GetRemovalQuorum(ctx, cfg)
+		if err != nil {
+			a.logger.Error("application.cluster-controller.get-removal-quorum.failed", err)
+		} else if removalQuorum.Safe() {
+			return true
+		}
+
+		if policy != "wait" || waited >= timeout || ctx.Err() != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			} else if err == nil {
+				err = errors.New("removing this member would leave the cluster without quorum")
+			}
+			a.logger.Error("application.remove-self-from-cluster.refused", err, lager.Data{
+				"policy":                    policy,
+				"waited":                    waited.String(),
+				"remaining-members":         removalQuorum.RemainingMembers,
+				"healthy-remaining-members": removalQuorum.HealthyRemainingMembers,
+				"quorum":                    removalQuorum.Quorum,
+			})
+			return false
+		}
+
+		a.logger.Info("application.remove-self-from-cluster.waiting-for-quorum", lager.Data{
+			"waited":  waited.String(),
+			"timeout": timeout.String(),
+		})
+		a.sleep(time.Second)
+	}
+}
+
+// pruneOrphanedMembers is best effort: etcd is already running and a member
+// that is not pruned now is pruned by a later attempt.
+func (a Application) pruneOrphanedMembers(ctx context.Context, cfg config.Config) {
+	a.logger.Info("application.cluster-controller.prune-orphaned-members")
+	_, err := a.clusterController.PruneOrphanedMembers(ctx, cfg, time.Now())
+	if err != nil {
+		a.logger.Error("application.cluster-controller.prune-orphaned-members.failed", err)
+	}
+}
+
+func (a Application) removeSelfFromCluster(ctx context.Context, cfg config.Config) {
+	memberList, err := a.etcdClient.MemberList(ctx)
 	if err != nil {
 		a.logger.Error("application.etcd-client.member-list.failed", err)
+		return
 	}
 	var memberID string
 	for _, member := range memberList {
@@ -216,56 +633,116 @@ func (a Application) removeSelfFromCluster(cfg config.Config) {
 		}
 	}
 
+	if memberID == "" {
+		a.logger.Info("application.etcd-client.member-remove.not-a-member", lager.Data{"name": cfg.NodeName()})
+		return
+	}
+
 	a.logger.Info("application.etcd-client.member-remove", lager.Data{"member-id": memberID})
-	err = a.etcdClient.MemberRemove(memberID)
+	err = a.etcdClient.MemberRemove(ctx, memberID)
 	if err != nil {
+		a.metrics.Inc(metrics.MemberRemoves, metrics.Failure)
 		a.logger.Error("application.etcd-client.member-remove.failed", err)
+		return
 	}
+	a.metrics.Inc(metrics.MemberRemoves, metrics.Success)
 }
 
-func (a Application) removeDataDir(cfg config.Config) {
-	a.logger.Info("application.remove-data-dir", lager.Data{"data-dir": cfg.Etcd.DataDir})
-	d, err := os.Open(cfg.Etcd.DataDir)
+// kill kills the etcd process start launched and waits for it to exit, since
+// its data dir may only be cleaned up once it no longer writes to it.
+func (a Application) kill(pidPath string, pid int) error {
+	a.logger.Info("application.kill-pid", lager.Data{"pid": pid})
+	err := a.command.Kill(pid)
 	if err != nil {
-		a.logger.Error("application.remove-data-dir", err)
+		a.logger.Error("application.kill-pid.failed", err)
+		return err
 	}
-	defer d.Close()
-	files, err := d.Readdirnames(-1)
+
+	// A killed process never exits successfully, so the error Wait returns
+	// says nothing beyond that it is gone.
+	a.command.Wait(pid)
+	a.logger.Info("application.kill-pid.exited", lager.Data{"pid": pid})
+
+	if _, err := os.Stat(pidPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	return a.removePidFile(pidPath)
+}
+
+func (a Application) stopEtcd(cfg config.Config) error {
+	pid, err := a.readPidFile(cfg.PidFile())
 	if err != nil {
-		a.logger.Error("application.remove-data-dir", err)
+		return err
 	}
-	for _, file := range files {
-		err = os.RemoveAll(filepath.Join(cfg.Etcd.DataDir, file))
+
+	err = a.stopPid(cfg, pid)
+	if err != nil {
+		return err
 	}
+
+	return a.removePidFile(cfg.PidFile())
+}
+
+func (a Application) stopPid(cfg config.Config, pid int) error {
+	timeout := time.Duration(cfg.Etcd.StopTimeout) * time.Second
+	a.logger.Info("application.stop-pid", lager.Data{
+		"pid":     pid,
+		"timeout": timeout.String(),
+	})
+	result, err := a.command.Stop(pid, timeout)
 	if err != nil {
-		a.logger.Error("application.remove-data-dir", err)
+		a.logger.Error("application.stop-pid.failed", err)
+		return err
 	}
+
+	a.logger.Info("application.stop-pid.success", lager.Data{
+		"pid":      pid,
+		"shutdown": string(result),
+	})
+	if result == command.Killed {
+		a.metrics.Inc(metrics.KillEscalations, nil)
+	}
+
+	return nil
 }
 
-func (a Application) kill(pidPath string) error {
+// writeMetrics is best effort, since failing to record what etcdfab did must
+// not fail what it did.
+func (a Application) writeMetrics(cfg config.Config) {
+	if cfg.Etcd.MetricsTextfilePath == "" {
+		return
+	}
+
+	err := a.metrics.WriteTextfile(cfg.Etcd.MetricsTextfilePath)
+	if err != nil {
+		a.logger.Error("application.write-metrics.failed", err, lager.Data{
+			"path": cfg.Etcd.MetricsTextfilePath,
+		})
+	}
+}
+
+func (a Application) readPidFile(pidPath string) (int, error) {
 	a.logger.Info("application.read-pid-file", lager.Data{"pid-file": pidPath})
 	pidFileContents, err := ioutil.ReadFile(pidPath)
 	if err != nil {
 		a.logger.Error("application.read-pid-file.failed", err)
-		return err
+		return 0, err
 	}
 
 	a.logger.Info("application.convert-pid-file-to-pid")
 	pid, err := strconv.Atoi(string(pidFileContents))
 	if err != nil {
 		a.logger.Error("application.convert-pid-file-to-pid.failed", err)
-		return err
+		return 0, err
 	}
 
-	a.logger.Info("application.kill-pid", lager.Data{"pid": pid})
-	err = a.command.Kill(pid)
-	if err != nil {
-		a.logger.Error("application.kill-pid.failed", err)
-		return err
-	}
+	return pid, nil
+}
 
+func (a Application) removePidFile(pidPath string) error {
 	a.logger.Info("application.remove-pid-file")
-	err = os.Remove(pidPath)
+	err := os.Remove(pidPath)
 	if err != nil {
 		//not tested
 		a.logger.Error("application.remove-pid-file.failed", err)
@@ -296,10 +773,10 @@ func (a Application) buildEtcdArgs(cfg config.Config) []string {
 	etcdArgs = append(etcdArgs, fmt.Sprintf("%d", cfg.Etcd.ElectionTimeout))
 
 	etcdArgs = append(etcdArgs, "--listen-peer-urls")
-	etcdArgs = append(etcdArgs, cfg.ListenPeerURL())
+	etcdArgs = append(etcdArgs, strings.Join(cfg.ListenPeerURLs(), ","))
 
 	etcdArgs = append(etcdArgs, "--listen-client-urls")
-	etcdArgs = append(etcdArgs, cfg.ListenClientURL())
+	etcdArgs = append(etcdArgs, strings.Join(cfg.ListenClientURLs(), ","))
 
 	etcdArgs = append(etcdArgs, "--initial-advertise-peer-urls")
 	etcdArgs = append(etcdArgs, cfg.AdvertisePeerURL())
@@ -307,6 +784,11 @@ func (a Application) buildEtcdArgs(cfg config.Config) []string {
 	etcdArgs = append(etcdArgs, "--advertise-client-urls")
 	etcdArgs = append(etcdArgs, cfg.AdvertiseClientURL())
 
+	if cfg.Etcd.InitialClusterToken != "" {
+		etcdArgs = append(etcdArgs, "--initial-cluster-token")
+		etcdArgs = append(etcdArgs, cfg.Etcd.InitialClusterToken)
+	}
+
 	if cfg.Etcd.RequireSSL {
 		etcdArgs = append(etcdArgs, "--client-cert-auth")
 		etcdArgs = append(etcdArgs, "--trusted-ca-file")
@@ -327,5 +809,7 @@ func (a Application) buildEtcdArgs(cfg config.Config) []string {
 		etcdArgs = append(etcdArgs, filepath.Join(cfg.CertDir(), "peer.key"))
 	}
 
+	etcdArgs = append(etcdArgs, buildTuningArgs(cfg)...)
+
 	return etcdArgs
 }
@@ -2,19 +2,23 @@ package application_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"code.cloudfoundry.org/lager"
 
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
 
@@ -149,6 +153,7 @@ var _ = Describe("Application", func() {
 					},
 					Etcd: config.Etcd{
 						EtcdPath:               "path-to-etcd",
+						EtcdctlPath:            "/var/vcap/packages/etcd/etcdctl",
 						CertDir:                "some/cert/dir",
 						RunDir:                 runDir,
 						DataDir:                dataDir,
@@ -161,6 +166,50 @@ var _ = Describe("Application", func() {
 						AdvertiseURLsDNSSuffix: "some-dns-suffix",
 						Machines:               []string{"some-ip-1", "some-ip-2"},
 						EnableDebugLogging:     true,
+						StopTimeout:            20,
+						StartDeadline:          50,
+						StopDeadline:           90,
+						ClientAPI:              "v2",
+
+						ClientPort: 4001,
+						PeerPort:   7001,
+
+						MemberListBackoff: config.Backoff{
+							Initial:    1000,
+							Max:        1000,
+							Multiplier: 1,
+							Deadline:   5000,
+						},
+						SyncBackoff: config.Backoff{
+							Initial:    1000,
+							Max:        1000,
+							Multiplier: 1,
+							Deadline:   20000,
+						},
+						SyncMaxRaftIndexLag:  100,
+						MemberAddSettleDelay: 2000,
+
+						SuperviseMaxRestarts:    5,
+						SuperviseInitialBackoff: 1000,
+						SuperviseMaxBackoff:     30000,
+						SuperviseCrashWindow:    600,
+
+						MemberRemovalQuorumPolicy:      "refuse",
+						MemberRemovalQuorumWaitTimeout: 60,
+						MemberAddQuorumPolicy:          "wait",
+						MemberAddQuorumWaitTimeout:     10,
+
+						JoinLockTTL:     50,
+						JoinLockTimeout: 10,
+
+						OrphanedMemberGracePeriod: 3600,
+
+						DataDirPolicy:              "wipe",
+						DataDirQuarantineRetention: 3,
+
+						PreflightMode:              "enforce",
+						PreflightMinFreeDisk:       100,
+						PreflightCertExpiryWarning: 30,
 					},
 				}
 
@@ -171,6 +220,7 @@ var _ = Describe("Application", func() {
 					EtcdClient:         fakeEtcdClient,
 					ClusterController:  fakeClusterController,
 					SyncController:     fakeSyncController,
+					Preflight:          &fakes.Preflight{},
 					OutWriter:          &outWriter,
 					ErrWriter:          &errWriter,
 					Logger:             fakeLogger,
@@ -192,7 +242,7 @@ var _ = Describe("Application", func() {
 			})
 
 			It("starts etcd in non tls mode", func() {
-				err := app.Start()
+				err := app.Start(context.Background())
 				Expect(err).NotTo(HaveOccurred())
 
 				By("configuring the etcd client", func() {
@@ -215,6 +265,8 @@ var _ = Describe("Application", func() {
 
 				By("verifying the cluster is synced", func() {
 					Expect(fakeSyncController.VerifySyncedCall.CallCount).To(Equal(1))
+					Expect(fakeSyncController.VerifySyncedCall.Receives.Config).To(Equal(etcdfabConfig))
+					Expect(fakeSyncController.VerifySyncedCall.Receives.InitialClusterState).To(Equal("new"))
 				})
 
 				By("writing the pid of etcd to the run dir", func() {
@@ -225,6 +277,10 @@ var _ = Describe("Application", func() {
 
 					Expect(pid).To(Equal(etcdPid))
 				})
+
+				By("closing the etcd client", func() {
+					Expect(fakeEtcdClient.CloseCall.CallCount).To(Equal(1))
+				})
 			})
 
 			Context("failure cases", func() {
@@ -238,7 +294,7 @@ var _ = Describe("Application", func() {
 					})
 
 					It("returns the error to the caller and logs a helpful message", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("error reading config file: open /path/to/missing/file: no such file or directory"))
 
 						Expect(fakeLogger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
@@ -260,7 +316,7 @@ var _ = Describe("Application", func() {
 					})
 
 					It("returns the error to the caller and logs a helpful message", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("error reading link config file: open /path/to/missing/file: no such file or directory"))
 
 						Expect(fakeLogger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
@@ -278,8 +334,9 @@ var _ = Describe("Application", func() {
 					})
 
 					It("returns the error to the caller and logs a helpful message", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("failed to configure etcd client"))
+						Expect(fakeEtcdClient.CloseCall.CallCount).To(Equal(0))
 
 						Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
 							{
@@ -296,7 +353,7 @@ var _ = Describe("Application", func() {
 					})
 
 					It("returns the error to the caller and logs a helpful message", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("failed to get initial cluster state"))
 
 						Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -314,7 +371,7 @@ var _ = Describe("Application", func() {
 					})
 
 					It("returns the error to the caller and logs a helpful message", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("failed to start command"))
 
 						Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -341,7 +398,7 @@ var _ = Describe("Application", func() {
 					})
 
 					It("cleans up", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("failed to verify synced"))
 
 						By("removing the node from the cluster", func() {
@@ -394,7 +451,7 @@ var _ = Describe("Application", func() {
 						})
 
 						It("skips removing self from cluster", func() {
-							err := app.Start()
+							err := app.Start(context.Background())
 							Expect(err).To(MatchError("failed to verify synced"))
 
 							Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
@@ -405,25 +462,63 @@ var _ = Describe("Application", func() {
 									Error:  err,
 								},
 								{
-									Action: "application.remove-data-dir",
+									Action: "application.kill",
+								},
+								{
+									Action: "application.kill-pid",
 									Data: []lager.Data{{
-										"data-dir": dataDir,
+										"pid": etcdPid,
 									}},
 								},
 								{
-									Action: "application.kill",
+									Action: "application.kill-pid.exited",
+									Data: []lager.Data{{
+										"pid": etcdPid,
+									}},
+								},
+								{
+									Action: "application.remove-pid-file",
+								},
+								{
+									Action: "application.remove-data-dir",
+									Data: []lager.Data{{
+										"data-dir": dataDir,
+									}},
 								},
 							}))
 						})
 					})
 
+					Context("when it cannot clean up the data dir", func() {
+						BeforeEach(func() {
+							Expect(os.RemoveAll(dataDir)).To(Succeed())
+							Expect(ioutil.WriteFile(dataDir, []byte("not a dir"), 0644)).To(Succeed())
+						})
+
+						AfterEach(func() {
+							Expect(os.Remove(dataDir)).To(Succeed())
+						})
+
+						It("returns both errors and logs the failed clean up", func() {
+							err := app.Start(context.Background())
+							Expect(err).To(MatchError(MatchRegexp(`^failed to verify synced, and cleaning up the data dir failed: .*not a directory$`)))
+
+							Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+							var actions []string
+							for _, message := range fakeLogger.Messages() {
+								actions = append(actions, message.Action)
+							}
+							Expect(actions).To(ContainElement("application.remove-data-dir.failed"))
+						})
+					})
+
 					Context("when it cannot kill the etcd process", func() {
 						BeforeEach(func() {
 							fakeCommand.KillCall.Returns.Error = errors.New("failed to kill process")
 						})
 
 						It("stops cleaning up, logs the error and returns", func() {
-							err := app.Start()
+							err := app.Start(context.Background())
 							Expect(err).To(MatchError("failed to kill process"))
 
 							Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
@@ -450,7 +545,7 @@ var _ = Describe("Application", func() {
 						})
 
 						It("continues cleanup but logs the error", func() {
-							err := app.Start()
+							err := app.Start(context.Background())
 							Expect(err).To(MatchError("failed to verify synced"))
 
 							Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
@@ -471,9 +566,56 @@ var _ = Describe("Application", func() {
 									Error:  errors.New("failed to remove member"),
 								},
 								{
-									Action: "application.remove-data-dir",
+									Action: "application.kill",
+								},
+							}))
+						})
+					})
+
+					Context("when it cannot list the members of the cluster", func() {
+						BeforeEach(func() {
+							fakeEtcdClient.MemberListCall.Returns.Error = errors.New("failed to list members")
+						})
+
+						It("skips removing the node and continues cleanup", func() {
+							err := app.Start(context.Background())
+							Expect(err).To(MatchError("failed to verify synced"))
+
+							Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+							Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+							Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+								{
+									Action: "application.etcd-client.member-list.failed",
+									Error:  errors.New("failed to list members"),
+								},
+								{
+									Action: "application.kill",
+								},
+							}))
+						})
+					})
+
+					Context("when the node is not a member of the cluster", func() {
+						BeforeEach(func() {
+							fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+								{
+									ID:   "some-other-id",
+									Name: "some-other-name",
+								},
+							}
+						})
+
+						It("skips removing the node and continues cleanup", func() {
+							err := app.Start(context.Background())
+							Expect(err).To(MatchError("failed to verify synced"))
+
+							Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+							Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+							Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+								{
+									Action: "application.etcd-client.member-remove.not-a-member",
 									Data: []lager.Data{{
-										"data-dir": dataDir,
+										"name": "some-name-3",
 									}},
 								},
 								{
@@ -484,6 +626,46 @@ var _ = Describe("Application", func() {
 					})
 				})
 
+				Context("when a preflight check fails", func() {
+					var fakePreflight *fakes.Preflight
+
+					BeforeEach(func() {
+						fakePreflight = &fakes.Preflight{}
+						fakePreflight.RunCall.Returns.Error = errors.New("preflight check dns failed: failed to resolve")
+
+						app = application.New(application.NewArgs{
+							Command:            fakeCommand,
+							ConfigFilePath:     configFileName,
+							LinkConfigFilePath: linkConfigFileName,
+							EtcdClient:         fakeEtcdClient,
+							ClusterController:  fakeClusterController,
+							SyncController:     fakeSyncController,
+							Preflight:          fakePreflight,
+							Logger:             fakeLogger,
+						})
+					})
+
+					It("returns the error before touching the cluster or starting etcd", func() {
+						err := app.Start(context.Background())
+						Expect(err).To(MatchError("preflight check dns failed: failed to resolve"))
+
+						Expect(fakePreflight.RunCall.CallCount).To(Equal(1))
+						Expect(fakePreflight.RunCall.Receives.Config).To(Equal(etcdfabConfig))
+						Expect(fakeClusterController.GetInitialClusterStateCall.CallCount).To(Equal(0))
+						Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+
+						Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+							{
+								Action: "application.preflight",
+							},
+							{
+								Action: "application.preflight.failed",
+								Error:  err,
+							},
+						}))
+					})
+				})
+
 				Context("when it cannot write to the specified PID file", func() {
 					BeforeEach(func() {
 						configuration := map[string]interface{}{
@@ -499,12 +681,13 @@ var _ = Describe("Application", func() {
 							EtcdClient:         fakeEtcdClient,
 							ClusterController:  fakeClusterController,
 							SyncController:     fakeSyncController,
+							Preflight:          &fakes.Preflight{},
 							Logger:             fakeLogger,
 						})
 					})
 
 					It("returns the error to the caller and logs a helpful message", func() {
-						err := app.Start()
+						err := app.Start(context.Background())
 						Expect(err).To(MatchError("open /path/to/missing/etcd.pid: no such file or directory"))
 
 						Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -560,6 +743,7 @@ var _ = Describe("Application", func() {
 					EtcdClient:         fakeEtcdClient,
 					ClusterController:  fakeClusterController,
 					SyncController:     fakeSyncController,
+					Preflight:          &fakes.Preflight{},
 					OutWriter:          &outWriter,
 					ErrWriter:          &errWriter,
 					Logger:             fakeLogger,
@@ -589,7 +773,7 @@ var _ = Describe("Application", func() {
 				}
 
 				By("calling Start on the command with etcd security flags", func() {
-					err := app.Start()
+					err := app.Start(context.Background())
 					Expect(err).NotTo(HaveOccurred())
 
 					Expect(fakeCommand.StartCall.CallCount).To(Equal(1))
@@ -640,6 +824,7 @@ var _ = Describe("Application", func() {
 
 		BeforeEach(func() {
 			fakeCommand = &fakes.CommandWrapper{}
+			fakeCommand.StopCall.Returns.StopResult = command.Terminated
 			fakeEtcdClient = &fakes.EtcdClient{}
 			fakeClusterController = &fakes.ClusterController{}
 			fakeSyncController = &fakes.SyncController{}
@@ -654,6 +839,15 @@ var _ = Describe("Application", func() {
 					Name: "some-name-2",
 				},
 			}
+			fakeClusterController.GetRemovalQuorumCall.Returns.RemovalQuorum = cluster.RemovalQuorum{
+				Members: []cluster.MemberHealth{
+					{ID: "some-id", Name: "some-name-3", Healthy: true},
+					{Name: "some-name-2", Healthy: true},
+				},
+				RemainingMembers:        1,
+				HealthyRemainingMembers: 1,
+				Quorum:                  1,
+			}
 
 			var err error
 			tmpDir, err = ioutil.TempDir("", "")
@@ -700,6 +894,7 @@ var _ = Describe("Application", func() {
 				},
 				Etcd: config.Etcd{
 					EtcdPath:               "path-to-etcd",
+					EtcdctlPath:            "/var/vcap/packages/etcd/etcdctl",
 					CertDir:                "some/cert/dir",
 					RunDir:                 runDir,
 					DataDir:                dataDir,
@@ -711,6 +906,50 @@ var _ = Describe("Application", func() {
 					ClientIP:               "some-client-ip",
 					AdvertiseURLsDNSSuffix: "some-dns-suffix",
 					Machines:               []string{"some-ip-1", "some-ip-2"},
+					StopTimeout:            20,
+					StartDeadline:          50,
+					StopDeadline:           90,
+					ClientAPI:              "v2",
+
+					ClientPort: 4001,
+					PeerPort:   7001,
+
+					MemberListBackoff: config.Backoff{
+						Initial:    1000,
+						Max:        1000,
+						Multiplier: 1,
+						Deadline:   5000,
+					},
+					SyncBackoff: config.Backoff{
+						Initial:    1000,
+						Max:        1000,
+						Multiplier: 1,
+						Deadline:   20000,
+					},
+					SyncMaxRaftIndexLag:  100,
+					MemberAddSettleDelay: 2000,
+
+					SuperviseMaxRestarts:    5,
+					SuperviseInitialBackoff: 1000,
+					SuperviseMaxBackoff:     30000,
+					SuperviseCrashWindow:    600,
+
+					MemberRemovalQuorumPolicy:      "refuse",
+					MemberRemovalQuorumWaitTimeout: 60,
+					MemberAddQuorumPolicy:          "wait",
+					MemberAddQuorumWaitTimeout:     10,
+
+					JoinLockTTL:     50,
+					JoinLockTimeout: 10,
+
+					OrphanedMemberGracePeriod: 3600,
+
+					DataDirPolicy:              "wipe",
+					DataDirQuarantineRetention: 3,
+
+					PreflightMode:              "enforce",
+					PreflightMinFreeDisk:       100,
+					PreflightCertExpiryWarning: 30,
 				},
 			}
 
@@ -721,6 +960,7 @@ var _ = Describe("Application", func() {
 				EtcdClient:         fakeEtcdClient,
 				ClusterController:  fakeClusterController,
 				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
 				OutWriter:          &outWriter,
 				ErrWriter:          &errWriter,
 				Logger:             fakeLogger,
@@ -738,9 +978,14 @@ var _ = Describe("Application", func() {
 		})
 
 		It("stops etcd and cleans up", func() {
-			err := app.Stop()
+			err := app.Stop(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 
+			By("checking that the cluster keeps quorum without the node", func() {
+				Expect(fakeClusterController.GetRemovalQuorumCall.CallCount).To(Equal(1))
+				Expect(fakeClusterController.GetRemovalQuorumCall.Receives.Config).To(Equal(etcdfabConfig))
+			})
+
 			By("removing the node from the cluster", func() {
 				Expect(fakeEtcdClient.MemberListCall.CallCount).To(Equal(2))
 				Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(1))
@@ -756,9 +1001,11 @@ var _ = Describe("Application", func() {
 				Expect(len(files)).To(Equal(0))
 			})
 
-			By("killing the etcd process", func() {
-				Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
-				Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+			By("gracefully stopping the etcd process", func() {
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+				Expect(fakeCommand.StopCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(fakeCommand.StopCall.Receives.Timeout).To(Equal(20 * time.Second))
+				Expect(fakeCommand.KillCall.CallCount).To(Equal(0))
 			})
 
 			By("deleting the pid file", func() {
@@ -779,6 +1026,9 @@ var _ = Describe("Application", func() {
 							"member-list": fakeEtcdClient.MemberListCall.Returns.MemberList,
 						}},
 					},
+					{
+						Action: "application.cluster-controller.get-removal-quorum",
+					},
 					{
 						Action: "application.remove-self-from-cluster",
 					},
@@ -789,13 +1039,7 @@ var _ = Describe("Application", func() {
 						}},
 					},
 					{
-						Action: "application.remove-data-dir",
-						Data: []lager.Data{{
-							"data-dir": dataDir,
-						}},
-					},
-					{
-						Action: "application.kill",
+						Action: "application.stop-etcd",
 					},
 					{
 						Action: "application.read-pid-file",
@@ -807,14 +1051,28 @@ var _ = Describe("Application", func() {
 						Action: "application.convert-pid-file-to-pid",
 					},
 					{
-						Action: "application.kill-pid",
+						Action: "application.stop-pid",
 						Data: []lager.Data{{
-							"pid": etcdPid,
+							"pid":     etcdPid,
+							"timeout": "20s",
+						}},
+					},
+					{
+						Action: "application.stop-pid.success",
+						Data: []lager.Data{{
+							"pid":      etcdPid,
+							"shutdown": "terminated",
 						}},
 					},
 					{
 						Action: "application.remove-pid-file",
 					},
+					{
+						Action: "application.remove-data-dir",
+						Data: []lager.Data{{
+							"data-dir": dataDir,
+						}},
+					},
 					{
 						Action: "application.stop.success",
 					},
@@ -832,7 +1090,7 @@ var _ = Describe("Application", func() {
 			})
 
 			It("returns the error to the caller and logs a helpful message", func() {
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).To(MatchError("error reading config file: open /path/to/missing/file: no such file or directory"))
 
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -850,7 +1108,7 @@ var _ = Describe("Application", func() {
 			})
 
 			It("returns the error to the caller and logs a helpful message", func() {
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).To(MatchError("failed to configure etcd client"))
 
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -872,7 +1130,7 @@ var _ = Describe("Application", func() {
 			})
 
 			It("returns the error to the caller and logs a helpful message", func() {
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).To(MatchError("error reading link config file: open /path/to/missing/file: no such file or directory"))
 
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -884,27 +1142,62 @@ var _ = Describe("Application", func() {
 			})
 		})
 
-		Context("when it cannot kill the etcd process", func() {
+		Context("when etcd has to be killed after the stop timeout", func() {
 			BeforeEach(func() {
-				fakeCommand.KillCall.Returns.Error = errors.New("failed to kill process")
+				fakeCommand.StopCall.Returns.StopResult = command.Killed
+			})
+
+			It("reports that the process was killed", func() {
+				err := app.Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(etcdPidPath).NotTo(BeARegularFile())
+				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "application.stop-pid.success",
+						Data: []lager.Data{{
+							"pid":      etcdPid,
+							"shutdown": "killed",
+						}},
+					},
+					{
+						Action: "application.remove-pid-file",
+					},
+					{
+						Action: "application.remove-data-dir",
+						Data: []lager.Data{{
+							"data-dir": dataDir,
+						}},
+					},
+					{
+						Action: "application.stop.success",
+					},
+				}))
+			})
+		})
+
+		Context("when it cannot stop the etcd process", func() {
+			BeforeEach(func() {
+				fakeCommand.StopCall.Returns.Error = errors.New("failed to stop process")
 			})
 
 			It("returns and logs the error", func() {
-				err := app.Stop()
-				Expect(err).To(MatchError("failed to kill process"))
+				err := app.Stop(context.Background())
+				Expect(err).To(MatchError("failed to stop process"))
 
-				Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
-				Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+				Expect(fakeCommand.StopCall.Receives.Pid).To(Equal(etcdPid))
 				Expect(etcdPidPath).To(BeARegularFile())
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
 					{
-						Action: "application.kill-pid",
+						Action: "application.stop-pid",
 						Data: []lager.Data{{
-							"pid": 12345,
+							"pid":     12345,
+							"timeout": "20s",
 						}},
 					},
 					{
-						Action: "application.kill-pid.failed",
+						Action: "application.stop-pid.failed",
 						Error:  err,
 					},
 				}))
@@ -924,7 +1217,7 @@ var _ = Describe("Application", func() {
 			})
 
 			It("cleans up", func() {
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).NotTo(HaveOccurred())
 
 				By("checking there are no other members", func() {
@@ -935,9 +1228,9 @@ var _ = Describe("Application", func() {
 					Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
 				})
 
-				By("killing the etcd process", func() {
-					Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
-					Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+				By("stopping the etcd process", func() {
+					Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+					Expect(fakeCommand.StopCall.Receives.Pid).To(Equal(etcdPid))
 				})
 
 				By("not writing a pidfile", func() {
@@ -959,13 +1252,7 @@ var _ = Describe("Application", func() {
 							}},
 						},
 						{
-							Action: "application.remove-data-dir",
-							Data: []lager.Data{{
-								"data-dir": dataDir,
-							}},
-						},
-						{
-							Action: "application.kill",
+							Action: "application.stop-etcd",
 						},
 					}))
 				})
@@ -979,15 +1266,15 @@ var _ = Describe("Application", func() {
 				})
 
 				It("cleans up", func() {
-					Expect(app.Stop()).NotTo(HaveOccurred())
+					Expect(app.Stop(context.Background())).NotTo(HaveOccurred())
 
 					By("checking there are no other members", func() {
 						Expect(fakeEtcdClient.MemberListCall.CallCount).To(Equal(1))
 					})
 
-					By("killing the etcd process", func() {
-						Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
-						Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+					By("stopping the etcd process", func() {
+						Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+						Expect(fakeCommand.StopCall.Receives.Pid).To(Equal(etcdPid))
 					})
 
 					By("not writing a pidfile", func() {
@@ -1007,13 +1294,7 @@ var _ = Describe("Application", func() {
 								Error:  err,
 							},
 							{
-								Action: "application.remove-data-dir",
-								Data: []lager.Data{{
-									"data-dir": dataDir,
-								}},
-							},
-							{
-								Action: "application.kill",
+								Action: "application.stop-etcd",
 							},
 						}))
 					})
@@ -1021,17 +1302,177 @@ var _ = Describe("Application", func() {
 			})
 		})
 
+		Context("when removing the node would leave the cluster without quorum", func() {
+			BeforeEach(func() {
+				fakeClusterController.GetRemovalQuorumCall.Returns.RemovalQuorum = cluster.RemovalQuorum{
+					RemainingMembers:        2,
+					HealthyRemainingMembers: 1,
+					Quorum:                  2,
+				}
+
+				err := ioutil.WriteFile(filepath.Join(dataDir, "some-data"), []byte("data"), 0644)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("refuses to remove the node, keeps its data and stops etcd", func() {
+				err := app.Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+				Expect(filepath.Join(dataDir, "some-data")).To(BeARegularFile())
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+				Expect(etcdPidPath).NotTo(BeARegularFile())
+
+				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "application.cluster-controller.get-removal-quorum",
+					},
+					{
+						Action: "application.remove-self-from-cluster.refused",
+						Error:  errors.New("removing this member would leave the cluster without quorum"),
+						Data: []lager.Data{{
+							"policy":                    "refuse",
+							"waited":                    "0s",
+							"remaining-members":         2,
+							"healthy-remaining-members": 1,
+							"quorum":                    2,
+						}},
+					},
+					{
+						Action: "application.stop-etcd",
+					},
+				}))
+			})
+
+			Context("when the policy is to wait for quorum", func() {
+				var sleepDurations []time.Duration
+
+				BeforeEach(func() {
+					configuration := map[string]interface{}{
+						"node": map[string]interface{}{
+							"name":  "some_name",
+							"index": 3,
+						},
+						"etcd": map[string]interface{}{
+							"run_dir":                      runDir,
+							"data_dir":                     dataDir,
+							"member_removal_quorum_policy": "wait",
+							"member_removal_quorum_wait_timeout_in_seconds": 3,
+						},
+					}
+					configFileName = createConfig(tmpDir, "config-file", configuration)
+
+					sleepDurations = []time.Duration{}
+					app = application.New(application.NewArgs{
+						Command:            fakeCommand,
+						ConfigFilePath:     configFileName,
+						LinkConfigFilePath: linkConfigFileName,
+						EtcdClient:         fakeEtcdClient,
+						ClusterController:  fakeClusterController,
+						SyncController:     fakeSyncController,
+						Preflight:          &fakes.Preflight{},
+						OutWriter:          &outWriter,
+						ErrWriter:          &errWriter,
+						Logger:             fakeLogger,
+						Sleep: func(duration time.Duration) {
+							sleepDurations = append(sleepDurations, duration)
+						},
+					})
+				})
+
+				It("removes the node once the rest of the cluster is healthy", func() {
+					fakeClusterController.GetRemovalQuorumCall.Stub = func() (cluster.RemovalQuorum, error) {
+						if fakeClusterController.GetRemovalQuorumCall.CallCount < 3 {
+							return cluster.RemovalQuorum{RemainingMembers: 2, HealthyRemainingMembers: 1, Quorum: 2}, nil
+						}
+						return cluster.RemovalQuorum{RemainingMembers: 2, HealthyRemainingMembers: 2, Quorum: 2}, nil
+					}
+
+					err := app.Stop(context.Background())
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeClusterController.GetRemovalQuorumCall.CallCount).To(Equal(3))
+					Expect(sleepDurations).To(Equal([]time.Duration{time.Second, time.Second}))
+					Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(1))
+					Expect(filepath.Join(dataDir, "some-data")).NotTo(BeAnExistingFile())
+
+					Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "application.remove-self-from-cluster.waiting-for-quorum",
+						Data: []lager.Data{{
+							"waited":  "1s",
+							"timeout": "3s",
+						}},
+					}))
+				})
+
+				It("refuses to remove the node when the timeout is reached", func() {
+					err := app.Stop(context.Background())
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeClusterController.GetRemovalQuorumCall.CallCount).To(Equal(4))
+					Expect(sleepDurations).To(HaveLen(3))
+					Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+					Expect(filepath.Join(dataDir, "some-data")).To(BeARegularFile())
+
+					Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "application.remove-self-from-cluster.refused",
+						Error:  errors.New("removing this member would leave the cluster without quorum"),
+						Data: []lager.Data{{
+							"policy":                    "wait",
+							"waited":                    "3s",
+							"remaining-members":         2,
+							"healthy-remaining-members": 1,
+							"quorum":                    2,
+						}},
+					}))
+				})
+			})
+		})
+
+		Context("when the health of the cluster cannot be determined", func() {
+			BeforeEach(func() {
+				fakeClusterController.GetRemovalQuorumCall.Returns.RemovalQuorum = cluster.RemovalQuorum{}
+				fakeClusterController.GetRemovalQuorumCall.Returns.Error = errors.New("failed to list members")
+			})
+
+			It("refuses to remove the node and logs the error", func() {
+				err := app.Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+
+				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "application.cluster-controller.get-removal-quorum.failed",
+						Error:  errors.New("failed to list members"),
+					},
+					{
+						Action: "application.remove-self-from-cluster.refused",
+						Error:  errors.New("failed to list members"),
+						Data: []lager.Data{{
+							"policy":                    "refuse",
+							"waited":                    "0s",
+							"remaining-members":         0,
+							"healthy-remaining-members": 0,
+							"quorum":                    0,
+						}},
+					},
+				}))
+			})
+		})
+
 		Context("when it cannot remove the node from the cluster", func() {
 			BeforeEach(func() {
 				fakeEtcdClient.MemberRemoveCall.Returns.Error = errors.New("failed to remove member")
 			})
 
 			It("continues cleanup but logs the error", func() {
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
-				Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+				Expect(fakeCommand.StopCall.Receives.Pid).To(Equal(etcdPid))
 				Expect(etcdPidPath).NotTo(BeARegularFile())
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
 					{
@@ -1039,13 +1480,7 @@ var _ = Describe("Application", func() {
 						Error:  errors.New("failed to remove member"),
 					},
 					{
-						Action: "application.remove-data-dir",
-						Data: []lager.Data{{
-							"data-dir": dataDir,
-						}},
-					},
-					{
-						Action: "application.kill",
+						Action: "application.stop-etcd",
 					},
 					{
 						Action: "application.read-pid-file",
@@ -1057,14 +1492,28 @@ var _ = Describe("Application", func() {
 						Action: "application.convert-pid-file-to-pid",
 					},
 					{
-						Action: "application.kill-pid",
+						Action: "application.stop-pid",
 						Data: []lager.Data{{
-							"pid": 12345,
+							"pid":     12345,
+							"timeout": "20s",
+						}},
+					},
+					{
+						Action: "application.stop-pid.success",
+						Data: []lager.Data{{
+							"pid":      12345,
+							"shutdown": "terminated",
 						}},
 					},
 					{
 						Action: "application.remove-pid-file",
 					},
+					{
+						Action: "application.remove-data-dir",
+						Data: []lager.Data{{
+							"data-dir": dataDir,
+						}},
+					},
 					{
 						Action: "application.stop.success",
 					},
@@ -1087,12 +1536,13 @@ var _ = Describe("Application", func() {
 					EtcdClient:         fakeEtcdClient,
 					ClusterController:  fakeClusterController,
 					SyncController:     fakeSyncController,
+					Preflight:          &fakes.Preflight{},
 					Logger:             fakeLogger,
 				})
 			})
 
 			It("returns the error to the caller and logs a helpful message", func() {
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).To(MatchError("open /path/to/missing/etcd.pid: no such file or directory"))
 
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -1113,7 +1563,7 @@ var _ = Describe("Application", func() {
 		Context("when the pid file cannot be read", func() {
 			It("returns the error", func() {
 				Expect(ioutil.WriteFile(etcdPidPath, []byte("nonsense"), 0644)).To(Succeed())
-				err := app.Stop()
+				err := app.Stop(context.Background())
 				Expect(err).To(MatchError(ContainSubstring("invalid syntax")))
 
 				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
@@ -1134,4 +1584,450 @@ var _ = Describe("Application", func() {
 			})
 		})
 	})
+
+	Describe("Run", func() {
+		var (
+			tmpDir             string
+			runDir             string
+			dataDir            string
+			configFileName     string
+			linkConfigFileName string
+
+			etcdPidPath string
+
+			fakeCommand           *fakes.CommandWrapper
+			fakeClusterController *fakes.ClusterController
+			fakeSyncController    *fakes.SyncController
+			fakeEtcdClient        *fakes.EtcdClient
+			fakeLogger            *fakes.Logger
+
+			sleepDurations []time.Duration
+			now            time.Time
+			ctx            context.Context
+			cancel         context.CancelFunc
+
+			app application.Application
+		)
+
+		BeforeEach(func() {
+			fakeCommand = &fakes.CommandWrapper{}
+			fakeCommand.StartCall.Returns.Pid = etcdPid
+
+			fakeEtcdClient = &fakes.EtcdClient{}
+			fakeClusterController = &fakes.ClusterController{}
+			fakeClusterController.GetInitialClusterStateCall.Returns.InitialClusterState = cluster.InitialClusterState{
+				Members: "etcd-0=http://some-ip-1:7001",
+				State:   "new",
+			}
+			fakeSyncController = &fakes.SyncController{}
+			fakeLogger = &fakes.Logger{}
+
+			sleepDurations = []time.Duration{}
+			now = time.Unix(1500000000, 0)
+			ctx, cancel = context.WithCancel(context.Background())
+
+			var err error
+			tmpDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			runDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			dataDir, err = ioutil.TempDir("", "data")
+			Expect(err).NotTo(HaveOccurred())
+
+			etcdPidPath = filepath.Join(runDir, "etcd.pid")
+
+			configFileName = createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": map[string]interface{}{
+					"etcd_path":                                 "path-to-etcd",
+					"run_dir":                                   runDir,
+					"data_dir":                                  dataDir,
+					"peer_ip":                                   "some-peer-ip",
+					"client_ip":                                 "some-client-ip",
+					"supervise_max_restarts":                    2,
+					"supervise_initial_backoff_in_milliseconds": 100,
+					"supervise_max_backoff_in_milliseconds":     150,
+					"supervise_crash_window_in_seconds":         60,
+				},
+			})
+			linkConfigFileName = createConfig(tmpDir, "config-link-file", map[string]interface{}{
+				"machines": []string{"some-ip-1"},
+			})
+
+			app = application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				Logger:             fakeLogger,
+				Sleep: func(duration time.Duration) {
+					sleepDurations = append(sleepDurations, duration)
+				},
+				Now: func() time.Time {
+					return now
+				},
+			})
+		})
+
+		AfterEach(func() {
+			cancel()
+			os.Remove(etcdPidPath)
+			Expect(os.Remove(configFileName)).NotTo(HaveOccurred())
+			Expect(os.Remove(linkConfigFileName)).NotTo(HaveOccurred())
+		})
+
+		Context("when the context is cancelled", func() {
+			var waiting chan struct{}
+
+			BeforeEach(func() {
+				waiting = make(chan struct{})
+				fakeCommand.WaitCall.Stub = func(int) error {
+					<-waiting
+					return nil
+				}
+			})
+
+			AfterEach(func() {
+				close(waiting)
+			})
+
+			It("leaves the cluster, stops the etcd it started and returns without restarting it", func() {
+				fakeCommand.RunningCall.Returns.Running = true
+				fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+					{ID: "some-id", Name: "some-name-3"},
+					{ID: "some-other-id", Name: "some-other-name-4"},
+				}
+				cancel()
+
+				err := app.Run(ctx)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeCommand.StartCall.CallCount).To(Equal(1))
+				Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(1))
+				Expect(fakeEtcdClient.MemberRemoveCall.Receives.MemberID).To(Equal("some-id"))
+				Expect(fakeCommand.RunningCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+				Expect(fakeCommand.StopCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(etcdPidPath).NotTo(BeARegularFile())
+
+				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "application.run.cancelled",
+					},
+					{
+						Action: "application.stop",
+					},
+				}))
+			})
+
+			Context("when etcd has already exited", func() {
+				It("does not try to stop it", func() {
+					fakeCommand.RunningCall.Returns.Running = false
+					cancel()
+
+					err := app.Run(ctx)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeCommand.StopCall.CallCount).To(Equal(0))
+					Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "application.stop-pid.not-running",
+						Data: []lager.Data{{
+							"pid": etcdPid,
+						}},
+					}))
+				})
+			})
+		})
+
+		Context("when an admin listen address is configured", func() {
+			BeforeEach(func() {
+				configData, err := ioutil.ReadFile(configFileName)
+				Expect(err).NotTo(HaveOccurred())
+
+				var configuration map[string]map[string]interface{}
+				Expect(json.Unmarshal(configData, &configuration)).To(Succeed())
+				configuration["etcd"]["admin_listen_address"] = "127.0.0.1:0"
+
+				configData, err = json.Marshal(configuration)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ioutil.WriteFile(configFileName, configData, os.ModePerm)).To(Succeed())
+			})
+
+			It("serves the admin endpoints while etcd runs and closes them on return", func() {
+				fakeCommand.RunningCall.Returns.Running = true
+
+				var healthz int
+				waiting := make(chan struct{})
+				defer close(waiting)
+				fakeCommand.WaitCall.Stub = func(int) error {
+					for _, message := range fakeLogger.Messages() {
+						if message.Action == "application.admin.serve" {
+							response, err := http.Get(fmt.Sprintf("http://%s/healthz", message.Data[0]["address"]))
+							if err == nil {
+								healthz = response.StatusCode
+								response.Body.Close()
+							}
+						}
+					}
+					cancel()
+					<-waiting
+					return nil
+				}
+
+				err := app.Run(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(healthz).To(Equal(http.StatusOK))
+			})
+		})
+
+		Context("when etcd keeps exiting", func() {
+			BeforeEach(func() {
+				fakeCommand.WaitCall.Returns.Error = errors.New("exit status 1")
+			})
+
+			It("restarts etcd with exponential backoff until the crash budget is exhausted", func() {
+				err := app.Run(ctx)
+				Expect(err).To(MatchError("etcd exited 3 times, exceeding the crash budget of 2 restarts"))
+
+				Expect(fakeCommand.StartCall.CallCount).To(Equal(3))
+				Expect(fakeCommand.StartCall.Receives.CommandArgs).To(ContainElement("--initial-cluster-state"))
+				Expect(fakeCommand.WaitCall.CallCount).To(Equal(3))
+				Expect(fakeCommand.WaitCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(fakeSyncController.VerifySyncedCall.CallCount).To(Equal(3))
+				Expect(fakeClusterController.GetInitialClusterStateCall.CallCount).To(Equal(1))
+				Expect(sleepDurations).To(Equal([]time.Duration{
+					100 * time.Millisecond,
+					150 * time.Millisecond,
+				}))
+				Expect(etcdPidPath).NotTo(BeARegularFile())
+
+				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "application.run.etcd-exited",
+						Error:  errors.New("exit status 1"),
+						Data: []lager.Data{{
+							"pid": etcdPid,
+						}},
+					},
+					{
+						Action: "application.run.restart",
+						Data: []lager.Data{{
+							"restart": 1,
+							"backoff": "100ms",
+						}},
+					},
+					{
+						Action: "application.synchronized-controller.verify-synced",
+					},
+					{
+						Action: "application.write-pid-file",
+						Data: []lager.Data{{
+							"pid":  etcdPid,
+							"path": etcdPidPath,
+						}},
+					},
+					{
+						Action: "application.run.restart.success",
+						Data: []lager.Data{{
+							"pid": etcdPid,
+						}},
+					},
+				}))
+				Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+					{
+						Action: "application.run.crash-budget-exhausted",
+						Error:  err,
+						Data: []lager.Data{{
+							"crash-window": "1m0s",
+						}},
+					},
+				}))
+			})
+
+			Context("when etcd runs longer than the crash window between exits", func() {
+				BeforeEach(func() {
+					fakeCommand.WaitCall.Stub = func(int) error {
+						if fakeCommand.WaitCall.CallCount > 5 {
+							cancel()
+							select {}
+						}
+						now = now.Add(61 * time.Second)
+						return errors.New("exit status 1")
+					}
+				})
+
+				It("does not charge earlier exits against the crash budget and starts the backoff over", func() {
+					err := app.Run(ctx)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeCommand.StartCall.CallCount).To(Equal(6))
+					Expect(sleepDurations).To(Equal([]time.Duration{
+						100 * time.Millisecond,
+						100 * time.Millisecond,
+						100 * time.Millisecond,
+						100 * time.Millisecond,
+						100 * time.Millisecond,
+					}))
+				})
+			})
+
+			Context("when the context is cancelled during the backoff", func() {
+				BeforeEach(func() {
+					app = application.New(application.NewArgs{
+						Command:            fakeCommand,
+						ConfigFilePath:     configFileName,
+						LinkConfigFilePath: linkConfigFileName,
+						EtcdClient:         fakeEtcdClient,
+						ClusterController:  fakeClusterController,
+						SyncController:     fakeSyncController,
+						Preflight:          &fakes.Preflight{},
+						Logger:             fakeLogger,
+						Sleep: func(time.Duration) {
+							cancel()
+							select {}
+						},
+						Now: func() time.Time {
+							return now
+						},
+					})
+				})
+
+				It("returns without restarting etcd", func() {
+					err := app.Run(ctx)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(fakeCommand.StartCall.CallCount).To(Equal(1))
+					Expect(etcdPidPath).NotTo(BeARegularFile())
+					Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "application.run.restart",
+							Data: []lager.Data{{
+								"restart": 1,
+								"backoff": "100ms",
+							}},
+						},
+						{
+							Action: "application.run.cancelled",
+						},
+					}))
+				})
+			})
+
+			Context("when the restarted etcd does not sync", func() {
+				BeforeEach(func() {
+					fakeSyncController.VerifySyncedCall.Stub = func(context.Context, config.Config, string) error {
+						if fakeSyncController.VerifySyncedCall.CallCount > 1 {
+							return errors.New("failed to verify synced")
+						}
+						return nil
+					}
+				})
+
+				It("kills it and charges the failure against the crash budget", func() {
+					err := app.Run(ctx)
+					Expect(err).To(MatchError("etcd exited 3 times, exceeding the crash budget of 2 restarts"))
+
+					Expect(fakeCommand.StartCall.CallCount).To(Equal(3))
+					Expect(fakeCommand.KillCall.CallCount).To(Equal(2))
+					Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+					Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+				})
+
+				It("waits for the restarted member to find the leader of its cluster", func() {
+					app.Run(ctx)
+
+					Expect(fakeSyncController.VerifySyncedCall.Receives.InitialClusterState).To(Equal("existing"))
+				})
+
+				Context("because the context is cancelled", func() {
+					BeforeEach(func() {
+						fakeSyncController.VerifySyncedCall.Stub = func(context.Context, config.Config, string) error {
+							if fakeSyncController.VerifySyncedCall.CallCount > 1 {
+								cancel()
+								return context.Canceled
+							}
+							return nil
+						}
+					})
+
+					It("kills it and returns without restarting it again", func() {
+						err := app.Run(ctx)
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(fakeCommand.StartCall.CallCount).To(Equal(2))
+						Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+						Expect(etcdPidPath).NotTo(BeARegularFile())
+					})
+
+					It("leaves the cluster without looking for the killed etcd in the missing pid file", func() {
+						fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+							{ID: "some-id", Name: "some-name-3"},
+							{ID: "some-other-id", Name: "some-other-name-4"},
+						}
+
+						err := app.Run(ctx)
+						Expect(err).NotTo(HaveOccurred())
+
+						Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(1))
+						Expect(fakeCommand.StopCall.CallCount).To(Equal(0))
+						Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+							Action: "application.stop-pid.not-running",
+							Data: []lager.Data{{
+								"pid": 0,
+							}},
+						}))
+						for _, message := range fakeLogger.Messages() {
+							Expect(message.Action).NotTo(Equal("application.read-pid-file"))
+						}
+					})
+				})
+			})
+
+			Context("when etcd cannot be restarted", func() {
+				BeforeEach(func() {
+					fakeCommand.StartCall.Stub = func() (int, error) {
+						if fakeCommand.StartCall.CallCount > 1 {
+							return 0, errors.New("failed to start command")
+						}
+						return etcdPid, nil
+					}
+				})
+
+				It("returns the error and logs a helpful message", func() {
+					err := app.Run(ctx)
+					Expect(err).To(MatchError("failed to start command"))
+
+					Expect(fakeLogger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "application.run.restart.failed",
+							Error:  err,
+						},
+					}))
+				})
+			})
+		})
+
+		Context("when the initial start fails", func() {
+			BeforeEach(func() {
+				fakeClusterController.GetInitialClusterStateCall.Returns.Error = errors.New("failed to get initial cluster state")
+			})
+
+			It("returns the error without supervising etcd", func() {
+				err := app.Run(ctx)
+				Expect(err).To(MatchError("failed to get initial cluster state"))
+
+				Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+				Expect(fakeCommand.WaitCall.CallCount).To(Equal(0))
+			})
+		})
+	})
 })
@@ -0,0 +1,261 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/backup"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// Backup archives a copy of the data dir of the running member together with
+// the cluster ID, member list, etcd version and raft index it reports. The
+// copy is taken with etcdctl backup rather than from the live data dir.
+func (a Application) Backup(ctx context.Context, backupFile string) error {
+	a.logger.Info("application.backup", lager.Data{"backup-file": backupFile})
+
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	files, err := readDirNames(cfg.Etcd.DataDir)
+	if err != nil {
+		a.logger.Error("application.backup.failed", err)
+		return err
+	}
+	if len(files) == 0 {
+		err = fmt.Errorf("data dir %s is empty", cfg.Etcd.DataDir)
+		a.logger.Error("application.backup.failed", err)
+		return err
+	}
+
+	selfEndpoint := cfg.EtcdClientSelfEndpoint()
+	a.logger.Info("application.etcd-client.endpoint-status", lager.Data{"endpoint": selfEndpoint})
+	status, err := a.etcdClient.EndpointStatus(ctx, selfEndpoint)
+	if err != nil {
+		a.logger.Error("application.etcd-client.endpoint-status.failed", err)
+		return err
+	}
+
+	a.logger.Info("application.etcd-client.member-list")
+	memberList, err := a.etcdClient.MemberList(ctx)
+	if err != nil {
+		a.logger.Error("application.etcd-client.member-list.failed", err)
+		return err
+	}
+
+	stagingDir, err := ioutil.TempDir(filepath.Dir(backupFile), ".etcd-backup")
+	if err != nil {
+		a.logger.Error("application.backup.failed", err)
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	backupDir := filepath.Join(stagingDir, "data")
+	err = a.etcdctlBackup(cfg, backupDir)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := backup.Create(backupFile, backupDir, backup.Metadata{
+		ClusterID:   status.ClusterID,
+		EtcdVersion: status.EtcdVersion,
+		RaftIndex:   status.RaftIndex,
+		Members:     memberList,
+		CreatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		a.logger.Error("application.backup.failed", err)
+		return err
+	}
+
+	a.logger.Info("application.backup.success", lager.Data{
+		"backup-file":  backupFile,
+		"cluster-id":   metadata.ClusterID,
+		"etcd-version": metadata.EtcdVersion,
+		"raft-index":   metadata.RaftIndex,
+		"files":        len(metadata.Files),
+	})
+	return nil
+}
+
+// etcdctlBackup has etcdctl write a copy of the data dir to backupDir. etcdctl
+// cuts the copy from the latest snapshot and the WAL entries after it, so
+// unlike copying the data dir it neither tears files etcd is writing to nor
+// trips over snapshots and WAL files etcd purges in the meantime. The copy
+// carries a new member and cluster ID, which is why Restore starts it with
+// --force-new-cluster.
+func (a Application) etcdctlBackup(cfg config.Config, backupDir string) error {
+	etcdctlArgs := []string{
+		"backup",
+		"--data-dir", cfg.Etcd.DataDir,
+		"--backup-dir", backupDir,
+	}
+	if cfg.EtcdClientAPI() == "v3" {
+		etcdctlArgs = append(etcdctlArgs, "--with-v3")
+	}
+
+	a.logger.Info("application.etcdctl-backup", lager.Data{
+		"etcdctl-path": cfg.Etcd.EtcdctlPath,
+		"etcdctl-args": etcdctlArgs,
+	})
+	pid, err := a.command.Start(cfg.Etcd.EtcdctlPath, etcdctlArgs, a.outWriter, a.errWriter)
+	if err != nil {
+		a.logger.Error("application.etcdctl-backup.failed", err)
+		return err
+	}
+
+	err = a.command.Wait(pid)
+	if err != nil {
+		a.logger.Error("application.etcdctl-backup.failed", err)
+		return err
+	}
+
+	return nil
+}
+
+// Restore seeds a new single member cluster from a backup archive. etcd must
+// be stopped and the data dir empty. etcd is started with --force-new-cluster
+// and keeps running afterwards; the other members rejoin it the same way they
+// would join any existing cluster once their data dirs have been wiped.
+func (a Application) Restore(ctx context.Context, backupFile string) error {
+	a.logger.Info("application.restore", lager.Data{"backup-file": backupFile})
+
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	_, err = os.Stat(cfg.PidFile())
+	if err == nil {
+		err = fmt.Errorf("etcd must be stopped before restoring, found pid file %s", cfg.PidFile())
+		a.logger.Error("application.restore.failed", err)
+		return err
+	}
+
+	files, err := readDirNames(cfg.Etcd.DataDir)
+	if err != nil {
+		a.logger.Error("application.restore.failed", err)
+		return err
+	}
+	if len(files) > 0 {
+		err = fmt.Errorf("data dir %s must be empty before restoring", cfg.Etcd.DataDir)
+		a.logger.Error("application.restore.failed", err)
+		return err
+	}
+
+	metadata, err := backup.Extract(backupFile, cfg.Etcd.DataDir)
+	if err != nil {
+		a.logger.Error("application.restore.extract.failed", err)
+		a.removeDataDir(cfg)
+		return err
+	}
+
+	a.logger.Info("application.restore.extract.success", lager.Data{
+		"cluster-id":   metadata.ClusterID,
+		"etcd-version": metadata.EtcdVersion,
+		"raft-index":   metadata.RaftIndex,
+		"created-at":   metadata.CreatedAt.String(),
+	})
+
+	etcdArgs := a.buildEtcdArgs(cfg)
+
+	etcdArgs = append(etcdArgs, "--initial-cluster")
+	etcdArgs = append(etcdArgs, fmt.Sprintf("%s=%s", cfg.NodeName(), cfg.AdvertisePeerURL()))
+	etcdArgs = append(etcdArgs, "--initial-cluster-state")
+	etcdArgs = append(etcdArgs, "new")
+	etcdArgs = append(etcdArgs, "--force-new-cluster")
+
+	a.logger.Info("application.start", lager.Data{
+		"etcd-path": cfg.Etcd.EtcdPath,
+		"etcd-args": etcdArgs,
+	})
+	pid, err := a.command.Start(cfg.Etcd.EtcdPath, etcdArgs, a.outWriter, a.errWriter)
+	if err != nil {
+		a.logger.Error("application.start.failed", err)
+		return err
+	}
+
+	a.logger.Info("application.synchronized-controller.verify-synced")
+	err = a.syncController.VerifySynced(ctx, cfg, "new")
+	if err != nil {
+		a.logger.Error("application.synchronized-controller.verify-synced.failed", err)
+		a.logger.Info("application.kill-pid", lager.Data{"pid": pid})
+		killErr := a.command.Kill(pid)
+		if killErr != nil {
+			a.logger.Error("application.kill-pid.failed", killErr)
+		}
+		return err
+	}
+
+	err = a.writePidFile(cfg.PidFile(), pid)
+	if err != nil {
+		return err
+	}
+
+	// Left running, etcd would keep serving the forced new cluster under the
+	// peer URL of the node the backup was taken from.
+	err = a.updateRestoredPeerURL(ctx, cfg)
+	if err != nil {
+		killErr := a.kill(cfg.PidFile(), pid)
+		if killErr != nil {
+			return fmt.Errorf("%s, and killing etcd failed: %s", err, killErr)
+		}
+		return err
+	}
+
+	a.recordClusterID(ctx, cfg)
+
+	a.logger.Info("application.restore.success")
+	return nil
+}
+
+// The restored member keeps the peer URL of the member the backup was taken
+// from, which is wrong when restoring onto a different node.
+func (a Application) updateRestoredPeerURL(ctx context.Context, cfg config.Config) error {
+	selfEtcdClient, err := a.etcdClient.Self()
+	if err != nil {
+		a.logger.Error("application.etcd-client.self.failed", err)
+		return err
+	}
+	defer selfEtcdClient.Close()
+
+	memberList, err := selfEtcdClient.MemberList(ctx)
+	if err != nil {
+		a.logger.Error("application.etcd-client.member-list.failed", err)
+		return err
+	}
+
+	if len(memberList) != 1 {
+		err = fmt.Errorf("expected the restored cluster to have 1 member, found %d", len(memberList))
+		a.logger.Error("application.restore.update-peer-url.failed", err)
+		return err
+	}
+
+	member := memberList[0]
+	if len(member.PeerURLs) > 0 && member.PeerURLs[0] == cfg.AdvertisePeerURL() {
+		return nil
+	}
+
+	a.logger.Info("application.restore.update-peer-url", lager.Data{
+		"member-id": member.ID,
+		"peer-urls": member.PeerURLs,
+		"peer-url":  cfg.AdvertisePeerURL(),
+	})
+	err = selfEtcdClient.MemberUpdate(ctx, member.ID, cfg.AdvertisePeerURL())
+	if err != nil {
+		a.logger.Error("application.restore.update-peer-url.failed", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,571 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/backup"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/gomegamatchers"
+)
+
+var _ = Describe("Backup and Restore", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+
+		backupFile         string
+		fakeSelfEtcdClient *fakes.EtcdClient
+
+		app application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		fakeSelfEtcdClient = &fakes.EtcdClient{}
+		fakeEtcdClient.SelfCall.Returns.EtcdClient = fakeSelfEtcdClient
+
+		backupFile = filepath.Join(tmpDir, "etcd-backup.tgz")
+
+		app = newApp(map[string]interface{}{
+			"etcd_path":    "path-to-etcd",
+			"etcdctl_path": "path-to-etcdctl",
+			"peer_ip":      "some-peer-ip",
+			"client_ip":    "some-client-ip",
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Describe("Backup", func() {
+		var etcdctlBackup func(backupDir string)
+
+		BeforeEach(func() {
+			Expect(os.MkdirAll(filepath.Join(dataDir, "member", "wal"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dataDir, "member", "wal", "0.wal"), []byte("some-wal"), 0644)).To(Succeed())
+
+			etcdctlBackup = func(backupDir string) {
+				Expect(os.MkdirAll(filepath.Join(backupDir, "member", "wal"), os.ModePerm)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(backupDir, "member", "wal", "0.wal"), []byte("some-backed-up-wal"), 0644)).To(Succeed())
+			}
+			fakeCommand.StartCall.Stub = func() (int, error) {
+				args := fakeCommand.StartCall.Receives.CommandArgs
+				if fakeCommand.StartCall.Receives.CommandPath == "path-to-etcdctl" {
+					etcdctlBackup(args[len(args)-1])
+				}
+				return etcdPid, nil
+			}
+
+			fakeEtcdClient.EndpointStatusCall.Returns.EndpointStatus = client.EndpointStatus{
+				ClusterID:   "some-cluster-id",
+				EtcdVersion: "2.3.8",
+				RaftIndex:   1234,
+				RaftTerm:    5,
+			}
+			fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+				{ID: "some-id", Name: "some-name-3"},
+			}
+		})
+
+		It("writes the etcdctl backup of the data dir and the cluster metadata to the backup file", func() {
+			err := app.Backup(context.Background(), backupFile)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeEtcdClient.EndpointStatusCall.Receives.Endpoint).To(Equal("http://some-external-ip:4001"))
+
+			Expect(fakeCommand.StartCall.CallCount).To(Equal(1))
+			Expect(fakeCommand.StartCall.Receives.CommandPath).To(Equal("path-to-etcdctl"))
+			Expect(fakeCommand.StartCall.Receives.CommandArgs[:4]).To(Equal([]string{
+				"backup",
+				"--data-dir", dataDir,
+				"--backup-dir",
+			}))
+			Expect(fakeCommand.WaitCall.Receives.Pid).To(Equal(etcdPid))
+
+			restoreDir := filepath.Join(tmpDir, "restore")
+			metadata, err := backup.Extract(backupFile, restoreDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.ClusterID).To(Equal("some-cluster-id"))
+			Expect(metadata.EtcdVersion).To(Equal("2.3.8"))
+			Expect(metadata.RaftIndex).To(Equal(uint64(1234)))
+			Expect(metadata.Members).To(Equal(fakeEtcdClient.MemberListCall.Returns.MemberList))
+			Expect(metadata.CreatedAt.IsZero()).To(BeFalse())
+
+			contents, err := ioutil.ReadFile(filepath.Join(restoreDir, "member", "wal", "0.wal"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-backed-up-wal"))
+
+			stagingDirs, err := filepath.Glob(filepath.Join(tmpDir, ".etcd-backup*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stagingDirs).To(BeEmpty())
+
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.backup.success",
+				Data: []lager.Data{{
+					"backup-file":  backupFile,
+					"cluster-id":   "some-cluster-id",
+					"etcd-version": "2.3.8",
+					"raft-index":   uint64(1234),
+					"files":        1,
+				}},
+			}))
+		})
+
+		Context("when etcd is writing to the data dir while the backup is taken", func() {
+			var (
+				done    chan struct{}
+				stopped chan struct{}
+			)
+
+			BeforeEach(func() {
+				done = make(chan struct{})
+				stopped = make(chan struct{})
+
+				// Appends to the WAL and purges old snapshots the way etcd does
+				// until the backup is done.
+				go func() {
+					defer GinkgoRecover()
+					defer close(stopped)
+					walPath := filepath.Join(dataDir, "member", "wal", "0.wal")
+					snapDir := filepath.Join(dataDir, "member", "snap")
+					Expect(os.MkdirAll(snapDir, os.ModePerm)).To(Succeed())
+
+					for i := 0; ; i++ {
+						select {
+						case <-done:
+							return
+						default:
+						}
+
+						wal, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0644)
+						Expect(err).NotTo(HaveOccurred())
+						fmt.Fprintf(wal, "entry-%d", i)
+						Expect(wal.Close()).To(Succeed())
+
+						snapPath := filepath.Join(snapDir, fmt.Sprintf("%d.snap", i))
+						Expect(ioutil.WriteFile(snapPath, []byte("some-snap"), 0644)).To(Succeed())
+						os.Remove(filepath.Join(snapDir, fmt.Sprintf("%d.snap", i-1)))
+					}
+				}()
+
+				// etcdctl cuts a consistent copy from the data dir, which the
+				// fake stands in for with a fixed snapshot and WAL.
+				etcdctlBackup = func(backupDir string) {
+					Expect(os.MkdirAll(filepath.Join(backupDir, "member", "snap"), os.ModePerm)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(backupDir, "member", "snap", "0000000000000005-00000000000004d2.snap"), []byte("some-snap"), 0644)).To(Succeed())
+					Expect(os.MkdirAll(filepath.Join(backupDir, "member", "wal"), os.ModePerm)).To(Succeed())
+					Expect(ioutil.WriteFile(filepath.Join(backupDir, "member", "wal", "0000000000000000-0000000000000000.wal"), []byte("some-consistent-wal"), 0644)).To(Succeed())
+				}
+
+				fakeSelfEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+					{
+						ID:       "some-id",
+						Name:     "some-name-3",
+						PeerURLs: []string{"http://some-external-ip:7001"},
+					},
+				}
+			})
+
+			It("restores exactly the copy etcdctl took", func() {
+				err := app.Backup(context.Background(), backupFile)
+				close(done)
+				<-stopped
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(os.RemoveAll(dataDir)).To(Succeed())
+				Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+				err = app.Restore(context.Background(), backupFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				var restored []string
+				err = filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+					if err == nil && info.Mode().IsRegular() {
+						relPath, _ := filepath.Rel(dataDir, path)
+						restored = append(restored, relPath)
+					}
+					return err
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(restored).To(ConsistOf(
+					filepath.Join("member", "snap", "0000000000000005-00000000000004d2.snap"),
+					filepath.Join("member", "wal", "0000000000000000-0000000000000000.wal"),
+				))
+
+				contents, err := ioutil.ReadFile(filepath.Join(dataDir, "member", "wal", "0000000000000000-0000000000000000.wal"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(Equal("some-consistent-wal"))
+			})
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when etcdctl cannot be started", func() {
+				fakeCommand.StartCall.Stub = nil
+				fakeCommand.StartCall.Returns.Error = errors.New("failed to start etcdctl")
+
+				err := app.Backup(context.Background(), backupFile)
+				Expect(err).To(MatchError("failed to start etcdctl"))
+				Expect(backupFile).NotTo(BeAnExistingFile())
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.etcdctl-backup.failed",
+					Error:  err,
+				}))
+			})
+
+			It("returns an error when etcdctl fails", func() {
+				fakeCommand.WaitCall.Returns.Error = errors.New("exit status 1")
+
+				err := app.Backup(context.Background(), backupFile)
+				Expect(err).To(MatchError("exit status 1"))
+				Expect(backupFile).NotTo(BeAnExistingFile())
+
+				stagingDirs, err := filepath.Glob(filepath.Join(tmpDir, ".etcd-backup*"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stagingDirs).To(BeEmpty())
+			})
+
+			It("returns an error when the data dir is empty", func() {
+				Expect(os.RemoveAll(filepath.Join(dataDir, "member"))).To(Succeed())
+
+				err := app.Backup(context.Background(), backupFile)
+				Expect(err).To(MatchError(fmt.Sprintf("data dir %s is empty", dataDir)))
+				Expect(backupFile).NotTo(BeAnExistingFile())
+			})
+
+			It("returns an error when the status of the member cannot be retrieved", func() {
+				fakeEtcdClient.EndpointStatusCall.Returns.Error = errors.New("failed to get status")
+
+				err := app.Backup(context.Background(), backupFile)
+				Expect(err).To(MatchError("failed to get status"))
+				Expect(backupFile).NotTo(BeAnExistingFile())
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.etcd-client.endpoint-status.failed",
+					Error:  errors.New("failed to get status"),
+				}))
+			})
+
+			It("returns an error when the member list cannot be retrieved", func() {
+				fakeEtcdClient.MemberListCall.Returns.Error = errors.New("failed to list members")
+
+				err := app.Backup(context.Background(), backupFile)
+				Expect(err).To(MatchError("failed to list members"))
+				Expect(backupFile).NotTo(BeAnExistingFile())
+			})
+
+			It("returns an error when the backup file cannot be written", func() {
+				err := app.Backup(context.Background(), "/path/to/missing/dir/backup.tgz")
+				Expect(err).To(HaveOccurred())
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.backup.failed",
+					Error:  err,
+				}))
+			})
+		})
+	})
+
+	Describe("Restore", func() {
+		BeforeEach(func() {
+			sourceDir := filepath.Join(tmpDir, "source")
+			Expect(os.MkdirAll(filepath.Join(sourceDir, "member", "wal"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(sourceDir, "member", "wal", "0.wal"), []byte("some-wal"), 0644)).To(Succeed())
+
+			_, err := backup.Create(backupFile, sourceDir, backup.Metadata{
+				ClusterID: "some-cluster-id",
+				RaftIndex: 1234,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeSelfEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+				{
+					ID:       "some-id",
+					Name:     "some-name-3",
+					PeerURLs: []string{"http://some-external-ip:7001"},
+				},
+			}
+		})
+
+		It("restores the data dir and starts etcd as a new single member cluster", func() {
+			err := app.Restore(context.Background(), backupFile)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(filepath.Join(dataDir, "member", "wal", "0.wal"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-wal"))
+
+			Expect(fakeCommand.StartCall.CallCount).To(Equal(1))
+			Expect(fakeCommand.StartCall.Receives.CommandPath).To(Equal("path-to-etcd"))
+			Expect(fakeCommand.StartCall.Receives.CommandArgs).To(gomegamatchers.ContainSequence([]string{
+				"--initial-cluster", "some-name-3=http://some-external-ip:7001",
+				"--initial-cluster-state", "new",
+				"--force-new-cluster",
+			}))
+			Expect(fakeSyncController.VerifySyncedCall.CallCount).To(Equal(1))
+			Expect(fakeSyncController.VerifySyncedCall.Receives.InitialClusterState).To(Equal("new"))
+			Expect(fakeSelfEtcdClient.MemberUpdateCall.CallCount).To(Equal(0))
+			Expect(fakeSelfEtcdClient.CloseCall.CallCount).To(Equal(1))
+			Expect(fakeEtcdClient.CloseCall.CallCount).To(Equal(1))
+
+			pidFileContents, err := ioutil.ReadFile(filepath.Join(runDir, "etcd.pid"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(pidFileContents)).To(Equal(fmt.Sprintf("%d", etcdPid)))
+
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.restore.extract.success",
+				Data: []lager.Data{{
+					"cluster-id":   "some-cluster-id",
+					"etcd-version": "",
+					"raft-index":   uint64(1234),
+					"created-at":   "0001-01-01 00:00:00 +0000 UTC",
+				}},
+			}))
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.restore.success",
+			}))
+		})
+
+		It("records the id of the restored cluster", func() {
+			fakeEtcdClient.EndpointStatusCall.Returns.EndpointStatus = client.EndpointStatus{ClusterID: "some-restored-cluster-id"}
+			Expect(ioutil.WriteFile(filepath.Join(runDir, "cluster-state.json"), []byte(`{"cluster_id": "some-cluster-id"}`), 0644)).To(Succeed())
+
+			err := app.Restore(context.Background(), backupFile)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.ReadFile(filepath.Join(runDir, "cluster-state.json"))).To(MatchJSON(`{"cluster_id": "some-restored-cluster-id"}`))
+		})
+
+		Context("when a peer rejoins the restored cluster", func() {
+			var (
+				peerTmpDir  string
+				peerRunDir  string
+				peerDataDir string
+
+				fakePeerCommand *fakes.CommandWrapper
+
+				peerApp application.Application
+			)
+
+			BeforeEach(func() {
+				fakeEtcdClient.EndpointStatusCall.Returns.EndpointStatus = client.EndpointStatus{ClusterID: "some-restored-cluster-id"}
+
+				var err error
+				peerTmpDir, err = ioutil.TempDir("", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				peerRunDir = filepath.Join(peerTmpDir, "run")
+				Expect(os.Mkdir(peerRunDir, os.ModePerm)).To(Succeed())
+
+				peerDataDir = filepath.Join(peerTmpDir, "data")
+				Expect(os.Mkdir(peerDataDir, os.ModePerm)).To(Succeed())
+
+				fakePeerCommand = &fakes.CommandWrapper{}
+				fakePeerCommand.StartCall.Returns.Pid = etcdPid
+				fakePeerEtcdClient := &fakes.EtcdClient{}
+				fakePeerEtcdClient.EndpointStatusCall.Returns.EndpointStatus = client.EndpointStatus{ClusterID: "some-restored-cluster-id"}
+				fakePeerClusterController := &fakes.ClusterController{}
+				fakePeerClusterController.GetInitialClusterStateCall.Returns.InitialClusterState = cluster.InitialClusterState{
+					Members: "some-name-3=http://some-external-ip:7001,some-name-4=http://some-peer-external-ip:7001",
+					State:   "existing",
+				}
+				Expect(ioutil.WriteFile(filepath.Join(peerRunDir, "cluster-state.json"), []byte(`{"cluster_id": "some-cluster-id"}`), 0644)).To(Succeed())
+
+				peerApp = application.New(application.NewArgs{
+					Command: fakePeerCommand,
+					ConfigFilePath: createConfig(peerTmpDir, "config-file", map[string]interface{}{
+						"node": map[string]interface{}{
+							"name":        "some_name",
+							"index":       3,
+							"external_ip": "some-external-ip",
+						},
+						"etcd": map[string]interface{}{
+							"run_dir":  peerRunDir,
+							"data_dir": peerDataDir,
+							"machines": []string{"some-external-ip"},
+						},
+					}),
+					LinkConfigFilePath: createConfig(peerTmpDir, "config-link-file", map[string]interface{}{}),
+					EtcdClient:         fakePeerEtcdClient,
+					ClusterController:  fakePeerClusterController,
+					SyncController:     &fakes.SyncController{},
+					Preflight:          &fakes.Preflight{},
+					OutWriter:          ioutil.Discard,
+					ErrWriter:          ioutil.Discard,
+					Logger:             &fakes.Logger{},
+					Sleep:              func(time.Duration) {},
+				})
+
+				err = app.Restore(context.Background(), backupFile)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(peerTmpDir)).To(Succeed())
+			})
+
+			It("starts the peer once its data dir has been wiped", func() {
+				err := peerApp.Start(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakePeerCommand.StartCall.CallCount).To(Equal(1))
+				Expect(ioutil.ReadFile(filepath.Join(peerRunDir, "cluster-state.json"))).To(MatchJSON(`{"cluster_id": "some-restored-cluster-id"}`))
+			})
+
+			It("refuses to start the peer while it still holds the data of the old cluster", func() {
+				Expect(os.MkdirAll(filepath.Join(peerDataDir, "member", "wal"), os.ModePerm)).To(Succeed())
+
+				err := peerApp.Start(context.Background())
+				Expect(err).To(MatchError(ContainSubstring("refusing to join cluster some-restored-cluster-id")))
+
+				Expect(fakePeerCommand.StartCall.CallCount).To(Equal(0))
+			})
+		})
+
+		Context("when the backup was taken on a different node", func() {
+			BeforeEach(func() {
+				fakeSelfEtcdClient.MemberListCall.Returns.MemberList[0].PeerURLs = []string{"http://some-other-ip:7001"}
+			})
+
+			It("updates the peer url of the restored member", func() {
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(fakeSelfEtcdClient.MemberUpdateCall.CallCount).To(Equal(1))
+				Expect(fakeSelfEtcdClient.MemberUpdateCall.Receives.MemberID).To(Equal("some-id"))
+				Expect(fakeSelfEtcdClient.MemberUpdateCall.Receives.PeerURL).To(Equal("http://some-external-ip:7001"))
+			})
+
+			It("returns an error when the peer url cannot be updated", func() {
+				fakeSelfEtcdClient.MemberUpdateCall.Returns.Error = errors.New("failed to update member")
+
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).To(MatchError("failed to update member"))
+
+				Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+				Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(filepath.Join(runDir, "etcd.pid")).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("failure cases", func() {
+			It("refuses to restore while etcd is running", func() {
+				Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte("1234"), 0644)).To(Succeed())
+
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).To(MatchError(fmt.Sprintf("etcd must be stopped before restoring, found pid file %s", filepath.Join(runDir, "etcd.pid"))))
+				Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+			})
+
+			It("refuses to restore into a data dir that is not empty", func() {
+				Expect(ioutil.WriteFile(filepath.Join(dataDir, "some-data"), []byte("data"), 0644)).To(Succeed())
+
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).To(MatchError(fmt.Sprintf("data dir %s must be empty before restoring", dataDir)))
+				Expect(filepath.Join(dataDir, "some-data")).To(BeARegularFile())
+				Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+			})
+
+			It("cleans up the data dir when the backup cannot be extracted", func() {
+				Expect(ioutil.WriteFile(backupFile, []byte("not-an-archive"), 0644)).To(Succeed())
+
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).To(HaveOccurred())
+				Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+
+				files, err := ioutil.ReadDir(dataDir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(files).To(BeEmpty())
+			})
+
+			It("kills etcd when the restored member does not sync", func() {
+				fakeSyncController.VerifySyncedCall.Returns.Error = errors.New("failed to verify synced")
+
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).To(MatchError("failed to verify synced"))
+
+				Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+				Expect(fakeCommand.KillCall.Receives.Pid).To(Equal(etcdPid))
+				Expect(filepath.Join(runDir, "etcd.pid")).NotTo(BeAnExistingFile())
+			})
+
+			It("returns an error when etcd cannot be started", func() {
+				fakeCommand.StartCall.Returns.Error = errors.New("failed to start etcd")
+
+				err := app.Restore(context.Background(), backupFile)
+				Expect(err).To(MatchError("failed to start etcd"))
+			})
+		})
+	})
+})
@@ -0,0 +1,133 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type clusterState struct {
+	ClusterID string `json:"cluster_id"`
+}
+
+// verifyClusterID refuses to start when the cluster answering at the client
+// endpoints is not the cluster this member joined before. There is nothing to
+// compare against before the first successful start or when no cluster
+// answers, which is the case while a new cluster is being bootstrapped.
+//
+// The recorded ID belongs to the data in the data dir. Once that is gone this
+// member joins whichever cluster it finds as a new member, so the ID is
+// forgotten. This is how the other members rejoin a cluster restored from a
+// backup, which has a new ID, or a cluster rebuilt after wiping every member.
+func (a Application) verifyClusterID(ctx context.Context, cfg config.Config) error {
+	state, err := readClusterState(cfg.ClusterStateFile())
+	if err != nil {
+		a.logger.Error("application.verify-cluster-id.failed", err)
+		return err
+	}
+
+	if state.ClusterID == "" {
+		return nil
+	}
+
+	_, err = os.Stat(cfg.MemberDir())
+	if os.IsNotExist(err) {
+		return a.forgetClusterID(cfg, state.ClusterID)
+	}
+	if err != nil {
+		a.logger.Error("application.verify-cluster-id.failed", err)
+		return err
+	}
+
+	for _, endpoint := range cfg.EtcdClientEndpoints() {
+		status, err := a.etcdClient.EndpointStatus(ctx, endpoint)
+		if err != nil || status.ClusterID == "" {
+			continue
+		}
+
+		if status.ClusterID != state.ClusterID {
+			err = fmt.Errorf("refusing to join cluster %s at %s: this member joined cluster %s, wipe %s if that cluster was replaced on purpose",
+				status.ClusterID, endpoint, state.ClusterID, cfg.Etcd.DataDir)
+			a.logger.Error("application.verify-cluster-id.failed", err)
+			return err
+		}
+
+		a.logger.Info("application.verify-cluster-id.success", lager.Data{
+			"cluster-id": state.ClusterID,
+			"endpoint":   endpoint,
+		})
+		return nil
+	}
+
+	a.logger.Info("application.verify-cluster-id.no-cluster-found", lager.Data{
+		"cluster-id": state.ClusterID,
+	})
+	return nil
+}
+
+func (a Application) forgetClusterID(cfg config.Config, clusterID string) error {
+	a.logger.Info("application.forget-cluster-id", lager.Data{
+		"cluster-id": clusterID,
+		"path":       cfg.ClusterStateFile(),
+	})
+	err := os.Remove(cfg.ClusterStateFile())
+	if err != nil {
+		a.logger.Error("application.forget-cluster-id.failed", err)
+		return err
+	}
+
+	return nil
+}
+
+// recordClusterID is best effort: etcd is already running when it is called,
+// so failing to record the ID only means the next start cannot verify it.
+func (a Application) recordClusterID(ctx context.Context, cfg config.Config) {
+	status, err := a.etcdClient.EndpointStatus(ctx, cfg.EtcdClientSelfEndpoint())
+	if err != nil {
+		a.logger.Error("application.record-cluster-id.failed", err)
+		return
+	}
+
+	if status.ClusterID == "" {
+		return
+	}
+
+	stateJSON, err := json.Marshal(clusterState{ClusterID: status.ClusterID})
+	if err != nil {
+		a.logger.Error("application.record-cluster-id.failed", err)
+		return
+	}
+
+	a.logger.Info("application.record-cluster-id", lager.Data{
+		"cluster-id": status.ClusterID,
+		"path":       cfg.ClusterStateFile(),
+	})
+	err = ioutil.WriteFile(cfg.ClusterStateFile(), stateJSON, 0644)
+	if err != nil {
+		a.logger.Error("application.record-cluster-id.failed", err)
+	}
+}
+
+func readClusterState(path string) (clusterState, error) {
+	stateJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return clusterState{}, nil
+		}
+		return clusterState{}, err
+	}
+
+	var state clusterState
+	err = json.Unmarshal(stateJSON, &state)
+	if err != nil {
+		return clusterState{}, fmt.Errorf("invalid cluster state file %s: %s", path, err)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,212 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/gomegamatchers"
+)
+
+var _ = Describe("cluster id", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+
+		clusterStatePath string
+		endpointStatuses map[string]client.EndpointStatus
+
+		app application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		fakeClusterController.GetInitialClusterStateCall.Returns.InitialClusterState = cluster.InitialClusterState{
+			Members: "some-name-3=http://some-external-ip:7001",
+			State:   "new",
+		}
+
+		endpointStatuses = map[string]client.EndpointStatus{}
+		fakeEtcdClient.EndpointStatusCall.Stub = func(endpoint string) (client.EndpointStatus, error) {
+			status, ok := endpointStatuses[endpoint]
+			if !ok {
+				return client.EndpointStatus{}, errors.New("connection refused")
+			}
+			return status, nil
+		}
+
+		clusterStatePath = filepath.Join(runDir, "cluster-state.json")
+
+		app = newApp(map[string]interface{}{
+			"machines":              []string{"some-ip-1", "some-ip-2"},
+			"initial_cluster_token": "some-deployment",
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("passes the initial cluster token to etcd", func() {
+		err := app.Start(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeCommand.StartCall.Receives.CommandArgs).To(gomegamatchers.ContainSequence([]string{
+			"--initial-cluster-token", "some-deployment",
+		}))
+	})
+
+	It("records the id of the cluster it joined", func() {
+		endpointStatuses["http://some-external-ip:4001"] = client.EndpointStatus{ClusterID: "some-cluster-id"}
+
+		err := app.Start(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.ReadFile(clusterStatePath)).To(MatchJSON(`{"cluster_id": "some-cluster-id"}`))
+		Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+			Action: "application.record-cluster-id",
+			Data: []lager.Data{{
+				"cluster-id": "some-cluster-id",
+				"path":       clusterStatePath,
+			}},
+		}))
+	})
+
+	Context("when a cluster id has been recorded", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(clusterStatePath, []byte(`{"cluster_id": "some-cluster-id"}`), 0644)).To(Succeed())
+			Expect(os.Mkdir(filepath.Join(dataDir, "member"), os.ModePerm)).To(Succeed())
+		})
+
+		It("starts when the cluster has the recorded id", func() {
+			endpointStatuses["http://some-ip-2:4001"] = client.EndpointStatus{ClusterID: "some-cluster-id"}
+
+			err := app.Start(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.verify-cluster-id.success",
+				Data: []lager.Data{{
+					"cluster-id": "some-cluster-id",
+					"endpoint":   "http://some-ip-2:4001",
+				}},
+			}))
+		})
+
+		It("starts when no cluster answers", func() {
+			err := app.Start(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeCommand.StartCall.CallCount).To(Equal(1))
+		})
+
+		It("refuses to join a cluster with a different id", func() {
+			endpointStatuses["http://some-ip-1:4001"] = client.EndpointStatus{ClusterID: "some-other-cluster-id"}
+
+			err := app.Start(context.Background())
+			Expect(err).To(MatchError("refusing to join cluster some-other-cluster-id at http://some-ip-1:4001: " +
+				"this member joined cluster some-cluster-id, wipe " + dataDir + " if that cluster was replaced on purpose"))
+
+			Expect(fakeClusterController.GetInitialClusterStateCall.CallCount).To(Equal(0))
+			Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.verify-cluster-id.failed",
+				Error:  err,
+			}))
+		})
+
+		Context("when the data dir holds no member data", func() {
+			BeforeEach(func() {
+				Expect(os.RemoveAll(filepath.Join(dataDir, "member"))).To(Succeed())
+			})
+
+			It("forgets the recorded id and records the id of the cluster it joins", func() {
+				endpointStatuses["http://some-ip-1:4001"] = client.EndpointStatus{ClusterID: "some-other-cluster-id"}
+				endpointStatuses["http://some-external-ip:4001"] = client.EndpointStatus{ClusterID: "some-other-cluster-id"}
+
+				err := app.Start(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(ioutil.ReadFile(clusterStatePath)).To(MatchJSON(`{"cluster_id": "some-other-cluster-id"}`))
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.forget-cluster-id",
+					Data: []lager.Data{{
+						"cluster-id": "some-cluster-id",
+						"path":       clusterStatePath,
+					}},
+				}))
+			})
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package application
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const quarantineTimestampFormat = "20060102T150405.000000000Z"
+
+// cleanUpDataDir applies the configured data dir policy. "wipe" removes the
+// contents of the data dir, "quarantine" moves them aside into a timestamped
+// directory and "preserve" leaves them in place. Unknown policies are
+// rejected when the config is loaded; should one get here anyway it leaves
+// the data dir alone rather than guessing.
+func (a Application) cleanUpDataDir(cfg config.Config) error {
+	switch cfg.Etcd.DataDirPolicy {
+	case "wipe":
+		return a.removeDataDir(cfg)
+	case "quarantine":
+		return a.quarantineDataDir(cfg)
+	case "preserve":
+		a.logger.Info("application.preserve-data-dir", lager.Data{"data-dir": cfg.Etcd.DataDir})
+		return nil
+	default:
+		err := fmt.Errorf("unknown data dir policy %q", cfg.Etcd.DataDirPolicy)
+		a.logger.Error("application.clean-up-data-dir.failed", err)
+		return err
+	}
+}
+
+func (a Application) removeDataDir(cfg config.Config) error {
+	a.logger.Info("application.remove-data-dir", lager.Data{"data-dir": cfg.Etcd.DataDir})
+	files, err := readDirNames(cfg.Etcd.DataDir)
+	if err != nil {
+		a.logger.Error("application.remove-data-dir.failed", err)
+		return err
+	}
+
+	for _, file := range files {
+		err = os.RemoveAll(filepath.Join(cfg.Etcd.DataDir, file))
+		if err != nil {
+			a.logger.Error("application.remove-data-dir.failed", err)
+			return err
+		}
+	}
+	a.metrics.Inc(metrics.DataDirWipes, metrics.Labels{"policy": "wipe"})
+
+	return nil
+}
+
+func (a Application) quarantineDataDir(cfg config.Config) error {
+	files, err := readDirNames(cfg.Etcd.DataDir)
+	if err != nil {
+		a.logger.Error("application.quarantine-data-dir.failed", err)
+		return err
+	}
+
+	if len(files) == 0 {
+		a.logger.Info("application.quarantine-data-dir.empty", lager.Data{"data-dir": cfg.Etcd.DataDir})
+		return nil
+	}
+
+	quarantineDir := filepath.Join(cfg.QuarantineDir(), time.Now().UTC().Format(quarantineTimestampFormat))
+	a.logger.Info("application.quarantine-data-dir", lager.Data{
+		"data-dir":       cfg.Etcd.DataDir,
+		"quarantine-dir": quarantineDir,
+	})
+
+	err = os.MkdirAll(quarantineDir, 0700)
+	if err != nil {
+		a.logger.Error("application.quarantine-data-dir.failed", err)
+		return err
+	}
+
+	for _, file := range files {
+		err = os.Rename(filepath.Join(cfg.Etcd.DataDir, file), filepath.Join(quarantineDir, file))
+		if err != nil {
+			a.logger.Error("application.quarantine-data-dir.failed", err)
+			return err
+		}
+	}
+	a.metrics.Inc(metrics.DataDirWipes, metrics.Labels{"policy": "quarantine"})
+
+	return a.pruneQuarantineDir(cfg)
+}
+
+// pruneQuarantineDir removes the oldest quarantined data dirs so that at most
+// DataDirQuarantineRetention of them are kept. A retention of zero keeps them
+// all.
+func (a Application) pruneQuarantineDir(cfg config.Config) error {
+	retention := cfg.Etcd.DataDirQuarantineRetention
+	if retention <= 0 {
+		return nil
+	}
+
+	quarantined, err := readDirNames(cfg.QuarantineDir())
+	if err != nil {
+		a.logger.Error("application.prune-quarantine-dir.failed", err)
+		return err
+	}
+
+	if len(quarantined) <= retention {
+		return nil
+	}
+
+	sort.Strings(quarantined)
+	for _, name := range quarantined[:len(quarantined)-retention] {
+		path := filepath.Join(cfg.QuarantineDir(), name)
+		a.logger.Info("application.prune-quarantine-dir", lager.Data{"path": path})
+		err = os.RemoveAll(path)
+		if err != nil {
+			a.logger.Error("application.prune-quarantine-dir.failed", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDirNames treats a missing directory as an empty one.
+func readDirNames(dir string) ([]string, error) {
+	d, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer d.Close()
+
+	return d.Readdirnames(-1)
+}
@@ -0,0 +1,328 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("data dir policy", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+
+		quarantineDir string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		fakeCommand.StopCall.Returns.StopResult = command.Terminated
+		fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+			{
+				ID:   "some-id",
+				Name: "some-name-3",
+			},
+			{
+				ID:   "some-other-id",
+				Name: "some-name-2",
+			},
+		}
+
+		Expect(os.Mkdir(filepath.Join(dataDir, "member"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDir, "member", "wal"), []byte("wal"), 0644)).To(Succeed())
+
+		quarantineDir = filepath.Join(tmpDir, "data-quarantine")
+
+		Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte(fmt.Sprintf("%d", etcdPid)), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Context("when the policy is quarantine", func() {
+		It("moves the contents of the data dir into a timestamped quarantine dir", func() {
+			app := newApp(map[string]interface{}{
+				"data_dir_policy": "quarantine",
+			})
+
+			err := app.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(1))
+
+			files, err := ioutil.ReadDir(dataDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+
+			quarantined, err := filepath.Glob(filepath.Join(quarantineDir, "*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quarantined).To(HaveLen(1))
+			Expect(filepath.Base(quarantined[0])).To(MatchRegexp(`^\d{8}T\d{6}\.\d{9}Z$`))
+			Expect(filepath.Join(quarantined[0], "member", "wal")).To(BeARegularFile())
+
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.quarantine-data-dir",
+				Data: []lager.Data{{
+					"data-dir":       dataDir,
+					"quarantine-dir": quarantined[0],
+				}},
+			}))
+		})
+
+		It("keeps only the configured number of quarantined data dirs", func() {
+			for _, name := range []string{"20170101T000000.000000000Z", "20170102T000000.000000000Z"} {
+				Expect(os.MkdirAll(filepath.Join(quarantineDir, name), os.ModePerm)).To(Succeed())
+			}
+
+			app := newApp(map[string]interface{}{
+				"data_dir_policy":               "quarantine",
+				"data_dir_quarantine_retention": 2,
+			})
+
+			err := app.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			quarantined, err := filepath.Glob(filepath.Join(quarantineDir, "*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(quarantined).To(HaveLen(2))
+			Expect(quarantined[0]).To(Equal(filepath.Join(quarantineDir, "20170102T000000.000000000Z")))
+
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.prune-quarantine-dir",
+				Data: []lager.Data{{
+					"path": filepath.Join(quarantineDir, "20170101T000000.000000000Z"),
+				}},
+			}))
+		})
+
+		It("does not create a quarantine dir when the data dir is empty", func() {
+			Expect(os.RemoveAll(filepath.Join(dataDir, "member"))).To(Succeed())
+
+			app := newApp(map[string]interface{}{
+				"data_dir_policy": "quarantine",
+			})
+
+			err := app.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(quarantineDir).NotTo(BeADirectory())
+		})
+
+		Context("when the data dir cannot be moved", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(quarantineDir, []byte{}, 0644)).To(Succeed())
+			})
+
+			It("still stops etcd but returns the error and leaves the data in place", func() {
+				app := newApp(map[string]interface{}{
+					"data_dir_policy": "quarantine",
+				})
+
+				err := app.Stop(context.Background())
+				Expect(err).To(HaveOccurred())
+
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+				Expect(filepath.Join(dataDir, "member", "wal")).To(BeARegularFile())
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.quarantine-data-dir.failed",
+					Error:  err,
+				}))
+			})
+		})
+	})
+
+	Context("when the policy is preserve", func() {
+		It("keeps the data and the membership on stop", func() {
+			app := newApp(map[string]interface{}{
+				"data_dir_policy": "preserve",
+			})
+
+			err := app.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(fakeEtcdClient.MemberListCall.CallCount).To(Equal(0))
+			Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+			Expect(filepath.Join(dataDir, "member", "wal")).To(BeARegularFile())
+			Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.preserve-data-dir",
+				Data: []lager.Data{{
+					"data-dir": dataDir,
+				}},
+			}))
+		})
+
+		It("keeps the data and the membership when etcd fails to sync", func() {
+			fakeSyncController.VerifySyncedCall.Returns.Error = errors.New("failed to verify synced")
+			fakeClusterController.GetInitialClusterStateCall.Returns.InitialClusterState = cluster.InitialClusterState{
+				State: "existing",
+			}
+
+			app := newApp(map[string]interface{}{
+				"data_dir_policy": "preserve",
+			})
+
+			err := app.Start(context.Background())
+			Expect(err).To(MatchError("failed to verify synced"))
+
+			Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+			Expect(filepath.Join(dataDir, "member", "wal")).To(BeARegularFile())
+			Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+		})
+	})
+
+	Context("when the policy is unknown", func() {
+		It("refuses to load the config and leaves etcd and the data dir alone", func() {
+			app := newApp(map[string]interface{}{
+				"data_dir_policy": "shred",
+			})
+
+			err := app.Stop(context.Background())
+			Expect(err).To(MatchError(`invalid data_dir_policy "shred": must be one of "wipe", "quarantine", "preserve"`))
+
+			Expect(filepath.Join(dataDir, "member", "wal")).To(BeARegularFile())
+			Expect(fakeCommand.StopCall.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("when etcd is still running", func() {
+		var walSeenByEtcd bool
+
+		BeforeEach(func() {
+			walSeenByEtcd = false
+		})
+
+		It("stops etcd before applying the policy on stop", func() {
+			fakeCommand.StopCall.Stub = func() (command.StopResult, error) {
+				_, err := os.Stat(filepath.Join(dataDir, "member", "wal"))
+				walSeenByEtcd = err == nil
+				return command.Terminated, nil
+			}
+
+			app := newApp(map[string]interface{}{
+				"data_dir_policy": "quarantine",
+			})
+
+			err := app.Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(walSeenByEtcd).To(BeTrue())
+			Expect(filepath.Join(dataDir, "member", "wal")).NotTo(BeAnExistingFile())
+		})
+
+		It("kills etcd and waits for it to exit before applying the policy when it fails to sync", func() {
+			fakeSyncController.VerifySyncedCall.Returns.Error = errors.New("failed to verify synced")
+			fakeCommand.WaitCall.Stub = func(int) error {
+				Expect(fakeCommand.KillCall.CallCount).To(Equal(1))
+				_, err := os.Stat(filepath.Join(dataDir, "member", "wal"))
+				walSeenByEtcd = err == nil
+				return errors.New("signal: killed")
+			}
+
+			app := newApp(map[string]interface{}{})
+
+			err := app.Start(context.Background())
+			Expect(err).To(MatchError("failed to verify synced"))
+
+			Expect(fakeCommand.WaitCall.Receives.Pid).To(Equal(etcdPid))
+			Expect(walSeenByEtcd).To(BeTrue())
+			Expect(filepath.Join(dataDir, "member", "wal")).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when the data dir cannot be wiped", func() {
+		BeforeEach(func() {
+			Expect(os.RemoveAll(dataDir)).To(Succeed())
+			Expect(ioutil.WriteFile(dataDir, []byte{}, 0644)).To(Succeed())
+		})
+
+		It("returns the error after stopping etcd", func() {
+			app := newApp(map[string]interface{}{})
+
+			err := app.Stop(context.Background())
+			Expect(err).To(HaveOccurred())
+
+			Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+			Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "application.remove-data-dir.failed",
+				Error:  err,
+			}))
+		})
+	})
+})
@@ -0,0 +1,191 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("deadlines", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+
+		app application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		fakeCommand.StopCall.Returns.StopResult = command.Terminated
+
+		app = newApp(map[string]interface{}{
+			"start_deadline_in_seconds":                 5,
+			"stop_deadline_in_seconds":                  10,
+			"stop_timeout_in_seconds":                   5,
+			"member_removal_quorum_policy":              "wait",
+			"member_add_quorum_wait_timeout_in_seconds": 1,
+			"join_lock_timeout_in_seconds":              1,
+			"join_lock_ttl_in_seconds":                  5,
+			"member_add_settle_delay_in_milliseconds":   100,
+			"member_list_backoff": map[string]interface{}{
+				"deadline_in_milliseconds": 1000,
+			},
+			"sync_backoff": map[string]interface{}{
+				"deadline_in_milliseconds": 1000,
+			},
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Describe("Start", func() {
+		It("gives the cluster and sync controllers the start deadline", func() {
+			Expect(app.Start(context.Background())).To(Succeed())
+
+			deadline, ok := fakeClusterController.GetInitialClusterStateCall.Receives.Context.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now().Add(5*time.Second), time.Second))
+
+			deadline, ok = fakeSyncController.VerifySyncedCall.Receives.Context.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now().Add(5*time.Second), time.Second))
+		})
+
+		It("cancels the context it hands out when the given context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			app.Start(ctx)
+
+			Expect(fakeClusterController.GetInitialClusterStateCall.Receives.Context.Err()).To(Equal(context.Canceled))
+		})
+	})
+
+	Describe("Stop", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte(fmt.Sprintf("%d", etcdPid)), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dataDir, "some-file"), []byte{}, 0644)).To(Succeed())
+
+			fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+				{ID: "some-id", Name: "some-name-3"},
+				{ID: "some-other-id", Name: "some-name-2"},
+			}
+			fakeClusterController.GetRemovalQuorumCall.Returns.RemovalQuorum = cluster.RemovalQuorum{
+				RemainingMembers:        1,
+				HealthyRemainingMembers: 0,
+				Quorum:                  1,
+			}
+		})
+
+		It("gives the cluster controller the stop deadline", func() {
+			fakeClusterController.GetRemovalQuorumCall.Returns.RemovalQuorum.HealthyRemainingMembers = 1
+
+			Expect(app.Stop(context.Background())).To(Succeed())
+
+			deadline, ok := fakeClusterController.GetRemovalQuorumCall.Receives.Context.Deadline()
+			Expect(ok).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now().Add(10*time.Second), time.Second))
+		})
+
+		Context("when the context is done while waiting for quorum", func() {
+			It("stays in the cluster with its data and still stops etcd", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				Expect(app.Stop(ctx)).To(Succeed())
+
+				Expect(fakeClusterController.GetRemovalQuorumCall.CallCount).To(Equal(1))
+				Expect(fakeEtcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+				Expect(filepath.Join(dataDir, "some-file")).To(BeAnExistingFile())
+				Expect(fakeCommand.StopCall.CallCount).To(Equal(1))
+
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.remove-self-from-cluster.refused",
+					Error:  context.Canceled,
+					Data: []lager.Data{{
+						"policy":                    "wait",
+						"waited":                    "0s",
+						"remaining-members":         1,
+						"healthy-remaining-members": 0,
+						"quorum":                    1,
+					}},
+				}))
+			})
+		})
+	})
+})
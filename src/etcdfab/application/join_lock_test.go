@@ -0,0 +1,128 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("join lock", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+
+		app application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		fakeClusterController.GetInitialClusterStateCall.Returns.InitialClusterState = cluster.InitialClusterState{
+			Members: "some-name-1=http://some-ip-1:7001,some-name-3=http://some-external-ip:7001",
+			State:   "existing",
+		}
+
+		app = newApp(map[string]interface{}{})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("releases the join lock once etcd has synced", func() {
+		Expect(app.Start(context.Background())).To(Succeed())
+
+		Expect(fakeClusterController.ReleaseJoinLockCall.CallCount).To(Equal(1))
+		Expect(fakeClusterController.ReleaseJoinLockCall.Receives.Config.NodeName()).To(Equal("some-name-3"))
+	})
+
+	It("releases the join lock when etcd does not sync", func() {
+		fakeSyncController.VerifySyncedCall.Returns.Error = errors.New("failed to sync")
+		Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte(fmt.Sprintf("%d", etcdPid)), 0644)).To(Succeed())
+
+		Expect(app.Start(context.Background())).To(MatchError("failed to sync"))
+
+		Expect(fakeClusterController.ReleaseJoinLockCall.CallCount).To(Equal(1))
+	})
+
+	Context("when a new cluster is started", func() {
+		BeforeEach(func() {
+			fakeClusterController.GetInitialClusterStateCall.Returns.InitialClusterState.State = "new"
+		})
+
+		It("does not touch the join lock", func() {
+			Expect(app.Start(context.Background())).To(Succeed())
+
+			Expect(fakeClusterController.ReleaseJoinLockCall.CallCount).To(Equal(0))
+		})
+	})
+})
@@ -0,0 +1,162 @@
+package application_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("metrics", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newArgs func(etcdConfiguration map[string]interface{}) application.NewArgs
+
+		textfilePath string
+		registry     *metrics.Registry
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newArgs = func(etcdConfiguration map[string]interface{}) application.NewArgs {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			}
+		}
+
+		fakeCommand.StopCall.Returns.StopResult = command.Killed
+		fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+			{
+				ID:   "some-id",
+				Name: "some-name-3",
+			},
+		}
+		registry = metrics.NewRegistry()
+
+		Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte(fmt.Sprintf("%d", etcdPid)), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDir, "wal"), []byte("wal"), 0644)).To(Succeed())
+
+		textfilePath = filepath.Join(tmpDir, "etcdfab.prom")
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			args := newArgs(etcdConfiguration)
+			args.Metrics = registry
+			return application.New(args)
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Context("when stopping etcd", func() {
+		It("records the stop duration, the data dir wipe and the kill escalation", func() {
+			err := newApp(map[string]interface{}{}).Stop(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(registry.Value(metrics.StopDuration+"_count", nil)).To(Equal(1.0))
+			Expect(registry.Value(metrics.DataDirWipes, metrics.Labels{"policy": "wipe"})).To(Equal(1.0))
+			Expect(registry.Value(metrics.KillEscalations, nil)).To(Equal(1.0))
+			Expect(textfilePath).NotTo(BeAnExistingFile())
+		})
+
+		Context("when a metrics textfile path is configured", func() {
+			It("adds the metrics to the textfile", func() {
+				Expect(ioutil.WriteFile(textfilePath, []byte("etcdfab_kill_escalations_total 2\n"), 0644)).To(Succeed())
+
+				err := newApp(map[string]interface{}{
+					"metrics_textfile_path": textfilePath,
+				}).Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(textfilePath)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("etcdfab_kill_escalations_total 3\n"))
+				Expect(string(contents)).To(ContainSubstring("etcdfab_data_dir_wipes_total{policy=\"wipe\"} 1\n"))
+				Expect(string(contents)).To(ContainSubstring("etcdfab_stop_duration_seconds_count 1\n"))
+			})
+
+			It("logs the error without failing the stop when the textfile cannot be written", func() {
+				textfilePath = filepath.Join(tmpDir, "missing", "etcdfab.prom")
+
+				err := newApp(map[string]interface{}{
+					"metrics_textfile_path": textfilePath,
+				}).Stop(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				messages := fakeLogger.Messages()
+				lastMessage := messages[len(messages)-1]
+				Expect(lastMessage.Action).To(Equal("application.write-metrics.failed"))
+				Expect(lastMessage.Data).To(Equal([]lager.Data{{"path": textfilePath}}))
+			})
+		})
+	})
+})
@@ -0,0 +1,158 @@
+package application_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("orphaned members", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+
+		etcdConfiguration map[string]interface{}
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		etcdConfiguration = map[string]interface{}{
+			"machines": []string{"some-ip-1", "some-ip-2"},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	start := func() error {
+		return newApp(etcdConfiguration).Start(context.Background())
+	}
+
+	It("does not prune orphaned members by default", func() {
+		Expect(start()).To(Succeed())
+
+		Expect(fakeClusterController.PruneOrphanedMembersCall.CallCount).To(Equal(0))
+	})
+
+	Context("when pruning orphaned members is enabled", func() {
+		BeforeEach(func() {
+			etcdConfiguration["prune_orphaned_members"] = true
+		})
+
+		It("prunes them after etcd has started", func() {
+			Expect(start()).To(Succeed())
+
+			Expect(fakeClusterController.PruneOrphanedMembersCall.CallCount).To(Equal(1))
+			Expect(fakeClusterController.PruneOrphanedMembersCall.Receives.Config.Etcd.Machines).To(Equal([]string{"some-ip-1", "some-ip-2"}))
+			Expect(fakeClusterController.PruneOrphanedMembersCall.Receives.Now).NotTo(BeZero())
+		})
+
+		It("keeps looking for them while etcd runs", func() {
+			etcdConfiguration["orphaned_member_grace_period_in_seconds"] = 1
+
+			ctx, cancel := context.WithCancel(context.Background())
+			waiting := make(chan struct{})
+			defer close(waiting)
+			fakeCommand.WaitCall.Stub = func(int) error {
+				<-waiting
+				return nil
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- newApp(etcdConfiguration).Run(ctx)
+			}()
+
+			Eventually(func() int {
+				return fakeClusterController.PruneOrphanedMembersCall.CallCount
+			}, "3s").Should(BeNumerically(">=", 2))
+
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		Context("when pruning fails", func() {
+			BeforeEach(func() {
+				fakeClusterController.PruneOrphanedMembersCall.Returns.Error = errors.New("failed to prune")
+			})
+
+			It("logs the error and still starts", func() {
+				Expect(start()).To(Succeed())
+
+				Expect(fakeLogger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "application.cluster-controller.prune-orphaned-members.failed",
+					Error:  errors.New("failed to prune"),
+				}))
+			})
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+type StatusReport struct {
+	Name               string         `json:"name"`
+	ID                 string         `json:"id"`
+	Registered         bool           `json:"registered"`
+	PidFile            string         `json:"pid_file"`
+	Pid                int            `json:"pid"`
+	PidAlive           bool           `json:"pid_alive"`
+	AdvertisePeerURL   string         `json:"advertise_peer_url"`
+	RegisteredPeerURLs []string       `json:"registered_peer_urls"`
+	PeerURLMismatch    bool           `json:"peer_url_mismatch"`
+	Leader             string         `json:"leader"`
+	Members            []MemberStatus `json:"members"`
+	Errors             []string       `json:"errors"`
+}
+
+type MemberStatus struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peer_urls"`
+	ClientURLs []string `json:"client_urls"`
+	Leader     bool     `json:"leader"`
+	Reachable  bool     `json:"reachable"`
+	Healthy    bool     `json:"healthy"`
+	Errors     []string `json:"errors"`
+}
+
+// Status writes a JSON report about the local member and the cluster it
+// belongs to. Problems talking to the cluster are part of the report rather
+// than errors, so the report is printed even when the cluster is down.
+func (a Application) Status(ctx context.Context) error {
+	cfg, err := a.configure()
+	if err != nil {
+		return err
+	}
+	defer a.etcdClient.Close()
+
+	report := a.buildStatusReport(ctx, cfg)
+
+	encoder := json.NewEncoder(a.outWriter)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+func (a Application) buildStatusReport(ctx context.Context, cfg config.Config) StatusReport {
+	report := StatusReport{
+		Name:               cfg.NodeName(),
+		PidFile:            cfg.PidFile(),
+		AdvertisePeerURL:   cfg.AdvertisePeerURL(),
+		RegisteredPeerURLs: []string{},
+		Members:            []MemberStatus{},
+		Errors:             []string{},
+	}
+
+	pidFileContents, err := ioutil.ReadFile(cfg.PidFile())
+	if err == nil {
+		report.Pid, err = strconv.Atoi(strings.TrimSpace(string(pidFileContents)))
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("invalid pid file: %s", err))
+		} else {
+			report.PidAlive = a.command.Running(report.Pid)
+		}
+	}
+
+	memberList, err := a.etcdClient.MemberList(ctx)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list members: %s", err))
+		return report
+	}
+
+	leader, err := a.etcdClient.Leader(ctx)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to get leader: %s", err))
+		leader = client.Member{}
+	} else {
+		report.Leader = leader.Name
+	}
+
+	for _, member := range memberList {
+		if member.Name == report.Name {
+			report.ID = member.ID
+			report.Registered = true
+			report.RegisteredPeerURLs = member.PeerURLs
+			report.PeerURLMismatch = len(member.PeerURLs) == 0 || member.PeerURLs[0] != report.AdvertisePeerURL
+		}
+
+		report.Members = append(report.Members, a.memberStatus(ctx, member, leader))
+	}
+
+	return report
+}
+
+func (a Application) memberStatus(ctx context.Context, member client.Member, leader client.Member) MemberStatus {
+	memberStatus := MemberStatus{
+		ID:         member.ID,
+		Name:       member.Name,
+		PeerURLs:   member.PeerURLs,
+		ClientURLs: member.ClientURLs,
+		Leader:     member.ID != "" && member.ID == leader.ID,
+		Errors:     []string{},
+	}
+
+	for _, clientURL := range member.ClientURLs {
+		healthy, err := a.etcdClient.EndpointHealth(ctx, clientURL)
+		if err != nil {
+			memberStatus.Errors = append(memberStatus.Errors, fmt.Sprintf("%s: %s", clientURL, err))
+			continue
+		}
+
+		memberStatus.Reachable = true
+		memberStatus.Healthy = memberStatus.Healthy || healthy
+	}
+
+	return memberStatus
+}
@@ -0,0 +1,270 @@
+package application_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Status", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newArgs func(etcdConfiguration map[string]interface{}) application.NewArgs
+
+		outWriter bytes.Buffer
+
+		app application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newArgs = func(etcdConfiguration map[string]interface{}) application.NewArgs {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			}
+		}
+
+		fakeCommand.RunningCall.Returns.Running = true
+		outWriter = bytes.Buffer{}
+
+		fakeEtcdClient.MemberListCall.Returns.MemberList = []client.Member{
+			{
+				ID:         "some-id-2",
+				Name:       "some-name-2",
+				PeerURLs:   []string{"http://some-ip-2:7001"},
+				ClientURLs: []string{"http://some-ip-2:4001"},
+			},
+			{
+				ID:         "some-id-3",
+				Name:       "some-name-3",
+				PeerURLs:   []string{"http://some-external-ip:7001"},
+				ClientURLs: []string{"http://some-external-ip:4001"},
+			},
+		}
+		fakeEtcdClient.LeaderCall.Returns.Leader = fakeEtcdClient.MemberListCall.Returns.MemberList[0]
+		fakeEtcdClient.EndpointHealthCall.Stub = func(endpoint string) (bool, error) {
+			if endpoint == "http://some-ip-2:4001" {
+				return false, errors.New("connection refused")
+			}
+			return true, nil
+		}
+
+		Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte("12345"), 0644)).To(Succeed())
+
+		args := newArgs(map[string]interface{}{})
+		args.OutWriter = &outWriter
+		app = application.New(args)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	report := func() application.StatusReport {
+		var report application.StatusReport
+		Expect(json.Unmarshal(outWriter.Bytes(), &report)).To(Succeed())
+		return report
+	}
+
+	It("prints a json report about the member and the cluster", func() {
+		err := app.Status(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeCommand.RunningCall.Receives.Pid).To(Equal(12345))
+		Expect(report()).To(Equal(application.StatusReport{
+			Name:               "some-name-3",
+			ID:                 "some-id-3",
+			Registered:         true,
+			PidFile:            filepath.Join(runDir, "etcd.pid"),
+			Pid:                12345,
+			PidAlive:           true,
+			AdvertisePeerURL:   "http://some-external-ip:7001",
+			RegisteredPeerURLs: []string{"http://some-external-ip:7001"},
+			PeerURLMismatch:    false,
+			Leader:             "some-name-2",
+			Members: []application.MemberStatus{
+				{
+					ID:         "some-id-2",
+					Name:       "some-name-2",
+					PeerURLs:   []string{"http://some-ip-2:7001"},
+					ClientURLs: []string{"http://some-ip-2:4001"},
+					Leader:     true,
+					Reachable:  false,
+					Healthy:    false,
+					Errors:     []string{"http://some-ip-2:4001: connection refused"},
+				},
+				{
+					ID:         "some-id-3",
+					Name:       "some-name-3",
+					PeerURLs:   []string{"http://some-external-ip:7001"},
+					ClientURLs: []string{"http://some-external-ip:4001"},
+					Leader:     false,
+					Reachable:  true,
+					Healthy:    true,
+					Errors:     []string{},
+				},
+			},
+			Errors: []string{},
+		}))
+	})
+
+	Context("when the registered peer url does not match the advertised one", func() {
+		BeforeEach(func() {
+			fakeEtcdClient.MemberListCall.Returns.MemberList[1].PeerURLs = []string{"http://some-old-ip:7001"}
+		})
+
+		It("reports the mismatch", func() {
+			Expect(app.Status(context.Background())).To(Succeed())
+
+			Expect(report().PeerURLMismatch).To(BeTrue())
+			Expect(report().RegisteredPeerURLs).To(Equal([]string{"http://some-old-ip:7001"}))
+		})
+	})
+
+	Context("when the member is not registered in the cluster", func() {
+		BeforeEach(func() {
+			fakeEtcdClient.MemberListCall.Returns.MemberList = fakeEtcdClient.MemberListCall.Returns.MemberList[:1]
+		})
+
+		It("reports it as unregistered", func() {
+			Expect(app.Status(context.Background())).To(Succeed())
+
+			Expect(report().Registered).To(BeFalse())
+			Expect(report().ID).To(BeEmpty())
+			Expect(report().PeerURLMismatch).To(BeFalse())
+		})
+	})
+
+	Context("when etcd is not running", func() {
+		BeforeEach(func() {
+			Expect(os.Remove(filepath.Join(runDir, "etcd.pid"))).To(Succeed())
+		})
+
+		It("reports that there is no pid", func() {
+			Expect(app.Status(context.Background())).To(Succeed())
+
+			Expect(report().Pid).To(Equal(0))
+			Expect(report().PidAlive).To(BeFalse())
+			Expect(fakeCommand.RunningCall.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("when the pid file is invalid", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte("not-a-pid"), 0644)).To(Succeed())
+		})
+
+		It("reports the error", func() {
+			Expect(app.Status(context.Background())).To(Succeed())
+
+			Expect(report().PidAlive).To(BeFalse())
+			Expect(report().Errors).To(ConsistOf(ContainSubstring("invalid pid file")))
+		})
+	})
+
+	Context("when the cluster cannot be reached", func() {
+		BeforeEach(func() {
+			fakeEtcdClient.MemberListCall.Returns.Error = errors.New("cluster is unavailable")
+		})
+
+		It("still prints a report with the error", func() {
+			Expect(app.Status(context.Background())).To(Succeed())
+
+			Expect(report().PidAlive).To(BeTrue())
+			Expect(report().Members).To(BeEmpty())
+			Expect(report().Errors).To(Equal([]string{"failed to list members: cluster is unavailable"}))
+		})
+	})
+
+	Context("when the leader cannot be determined", func() {
+		BeforeEach(func() {
+			fakeEtcdClient.LeaderCall.Returns.Error = errors.New("no leader")
+		})
+
+		It("reports the error and the members", func() {
+			Expect(app.Status(context.Background())).To(Succeed())
+
+			Expect(report().Leader).To(BeEmpty())
+			Expect(report().Members).To(HaveLen(2))
+			Expect(report().Members[0].Leader).To(BeFalse())
+			Expect(report().Errors).To(Equal([]string{"failed to get leader: no leader"}))
+		})
+	})
+
+	Context("when it cannot read the config file", func() {
+		It("returns the error", func() {
+			app = application.New(application.NewArgs{
+				ConfigFilePath: "/path/to/missing/file",
+				Logger:         &fakes.Logger{},
+			})
+
+			err := app.Status(context.Background())
+			Expect(err).To(MatchError(ContainSubstring("error reading config file")))
+		})
+	})
+})
@@ -0,0 +1,63 @@
+package application
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+// buildTuningArgs returns the flags for the tuning properties that are set
+// followed by extra_args in flag order. Unset properties are left to the etcd
+// defaults.
+func buildTuningArgs(cfg config.Config) []string {
+	var etcdArgs []string
+
+	if cfg.Etcd.SnapshotCount > 0 {
+		etcdArgs = append(etcdArgs, "--snapshot-count")
+		etcdArgs = append(etcdArgs, fmt.Sprintf("%d", cfg.Etcd.SnapshotCount))
+	}
+
+	if cfg.Etcd.QuotaBackendBytes > 0 {
+		etcdArgs = append(etcdArgs, "--quota-backend-bytes")
+		etcdArgs = append(etcdArgs, fmt.Sprintf("%d", cfg.Etcd.QuotaBackendBytes))
+	}
+
+	if cfg.Etcd.AutoCompactionRetention > 0 {
+		etcdArgs = append(etcdArgs, "--auto-compaction-retention")
+		etcdArgs = append(etcdArgs, fmt.Sprintf("%d", cfg.Etcd.AutoCompactionRetention))
+	}
+
+	if cfg.Etcd.MaxWALs > 0 {
+		etcdArgs = append(etcdArgs, "--max-wals")
+		etcdArgs = append(etcdArgs, fmt.Sprintf("%d", cfg.Etcd.MaxWALs))
+	}
+
+	if cfg.Etcd.MaxSnapshots > 0 {
+		etcdArgs = append(etcdArgs, "--max-snapshots")
+		etcdArgs = append(etcdArgs, fmt.Sprintf("%d", cfg.Etcd.MaxSnapshots))
+	}
+
+	if len(cfg.Etcd.CipherSuites) > 0 {
+		etcdArgs = append(etcdArgs, "--cipher-suites")
+		etcdArgs = append(etcdArgs, strings.Join(cfg.Etcd.CipherSuites, ","))
+	}
+
+	var flags []string
+	for flag := range cfg.Etcd.ExtraArgs {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	for _, flag := range flags {
+		value := cfg.Etcd.ExtraArgs[flag]
+		if value == "" {
+			etcdArgs = append(etcdArgs, fmt.Sprintf("--%s", flag))
+			continue
+		}
+		etcdArgs = append(etcdArgs, fmt.Sprintf("--%s=%s", flag, value))
+	}
+
+	return etcdArgs
+}
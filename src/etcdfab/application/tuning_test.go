@@ -0,0 +1,148 @@
+package application_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/gomegamatchers"
+)
+
+var _ = Describe("etcd tuning", func() {
+	var (
+		tmpDir  string
+		runDir  string
+		dataDir string
+
+		fakeCommand           *fakes.CommandWrapper
+		fakeEtcdClient        *fakes.EtcdClient
+		fakeClusterController *fakes.ClusterController
+		fakeSyncController    *fakes.SyncController
+		fakeLogger            *fakes.Logger
+
+		newApp func(etcdConfiguration map[string]interface{}) application.Application
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		runDir = filepath.Join(tmpDir, "run")
+		Expect(os.Mkdir(runDir, os.ModePerm)).To(Succeed())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.Mkdir(dataDir, os.ModePerm)).To(Succeed())
+
+		fakeCommand = &fakes.CommandWrapper{}
+		fakeCommand.StartCall.Returns.Pid = etcdPid
+		fakeEtcdClient = &fakes.EtcdClient{}
+		fakeClusterController = &fakes.ClusterController{}
+		fakeSyncController = &fakes.SyncController{}
+		fakeLogger = &fakes.Logger{}
+
+		newApp = func(etcdConfiguration map[string]interface{}) application.Application {
+			etcd := map[string]interface{}{
+				"run_dir":  runDir,
+				"data_dir": dataDir,
+			}
+			for property, value := range etcdConfiguration {
+				etcd[property] = value
+			}
+
+			configFileName := createConfig(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "some_name",
+					"index":       3,
+					"external_ip": "some-external-ip",
+				},
+				"etcd": etcd,
+			})
+			linkConfigFileName := createConfig(tmpDir, "config-link-file", map[string]interface{}{})
+
+			return application.New(application.NewArgs{
+				Command:            fakeCommand,
+				ConfigFilePath:     configFileName,
+				LinkConfigFilePath: linkConfigFileName,
+				EtcdClient:         fakeEtcdClient,
+				ClusterController:  fakeClusterController,
+				SyncController:     fakeSyncController,
+				Preflight:          &fakes.Preflight{},
+				OutWriter:          ioutil.Discard,
+				ErrWriter:          ioutil.Discard,
+				Logger:             fakeLogger,
+				Sleep:              func(time.Duration) {},
+			})
+		}
+
+		fakeClusterController.GetInitialClusterStateCall.Returns.InitialClusterState = cluster.InitialClusterState{
+			Members: "some-name-3=http://some-external-ip:7001",
+			State:   "new",
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("passes the tuning properties and extra args to etcd", func() {
+		app := newApp(map[string]interface{}{
+			"snapshot_count":                     5000,
+			"quota_backend_bytes":                4294967296,
+			"auto_compaction_retention_in_hours": 1,
+			"max_wals":                           10,
+			"max_snapshots":                      3,
+			"cipher_suites":                      []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+			"extra_args": map[string]string{
+				"strict-reconfig-check": "",
+				"metrics":               "extensive",
+			},
+		})
+
+		err := app.Start(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeCommand.StartCall.Receives.CommandArgs).To(gomegamatchers.ContainSequence([]string{
+			"--snapshot-count", "5000",
+			"--quota-backend-bytes", "4294967296",
+			"--auto-compaction-retention", "1",
+			"--max-wals", "10",
+			"--max-snapshots", "3",
+			"--cipher-suites", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			"--metrics=extensive",
+			"--strict-reconfig-check",
+			"--initial-cluster", "some-name-3=http://some-external-ip:7001",
+		}))
+	})
+
+	It("leaves unset tuning properties to the etcd defaults", func() {
+		app := newApp(map[string]interface{}{})
+
+		err := app.Start(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(fakeCommand.StartCall.Receives.CommandArgs).NotTo(ContainElement("--snapshot-count"))
+		Expect(fakeCommand.StartCall.Receives.CommandArgs).NotTo(ContainElement("--cipher-suites"))
+	})
+
+	It("refuses to start etcd when extra args set a managed flag", func() {
+		app := newApp(map[string]interface{}{
+			"extra_args": map[string]string{
+				"data-dir": "/somewhere/else",
+			},
+		})
+
+		err := app.Start(context.Background())
+		Expect(err).To(MatchError(`invalid extra_args flag "data-dir": it is managed by etcdfab`))
+
+		Expect(fakeCommand.StartCall.CallCount).To(Equal(0))
+	})
+})
@@ -0,0 +1,87 @@
+package backoff
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+var (
+	random      = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomMutex sync.Mutex
+)
+
+// Policy decides how long to wait between attempts of an operation and when
+// to give up on it.
+type Policy struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+	Deadline   time.Duration
+}
+
+func NewPolicy(b config.Backoff) Policy {
+	return Policy{
+		Initial:    time.Duration(b.Initial) * time.Millisecond,
+		Max:        time.Duration(b.Max) * time.Millisecond,
+		Multiplier: b.Multiplier,
+		Jitter:     b.Jitter,
+		Deadline:   time.Duration(b.Deadline) * time.Millisecond,
+	}
+}
+
+// Delay returns the time to wait after the given attempt, counted from zero,
+// before jitter is applied.
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := float64(p.Initial) * math.Pow(p.Multiplier, float64(attempt))
+	if delay > float64(p.Max) {
+		return p.Max
+	}
+	return time.Duration(delay)
+}
+
+// Retry calls attempt with the attempt number until it succeeds, sleeping
+// after every failure. It gives up once the sleeps add up to the deadline
+// and returns the error of the last attempt. Only the sleeps count towards
+// the deadline, so a slow attempt does not cut the retries short. It also
+// gives up with the context's error once the context is done.
+func (p Policy) Retry(ctx context.Context, sleep func(time.Duration), attempt func(int) error) error {
+	var waited time.Duration
+	for i := 0; ; i++ {
+		err := attempt(i)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		delay := p.jitter(p.Delay(i))
+		sleep(delay)
+
+		waited += delay
+		if waited >= p.Deadline {
+			return err
+		}
+	}
+}
+
+// jitter spreads the delay evenly by up to Jitter times the delay in either
+// direction, so nodes that fail at the same time do not retry in lockstep.
+func (p Policy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter == 0 {
+		return delay
+	}
+
+	randomMutex.Lock()
+	factor := 2*random.Float64() - 1
+	randomMutex.Unlock()
+
+	return delay + time.Duration(factor*p.Jitter*float64(delay))
+}
@@ -0,0 +1,134 @@
+package backoff_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/backoff"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	var (
+		policy backoff.Policy
+		sleeps []time.Duration
+		sleep  func(time.Duration)
+	)
+
+	BeforeEach(func() {
+		policy = backoff.NewPolicy(config.Backoff{
+			Initial:    100,
+			Max:        1000,
+			Multiplier: 3,
+			Deadline:   2000,
+		})
+
+		sleeps = nil
+		sleep = func(duration time.Duration) {
+			sleeps = append(sleeps, duration)
+		}
+	})
+
+	Describe("NewPolicy", func() {
+		It("converts the configured milliseconds", func() {
+			Expect(policy).To(Equal(backoff.Policy{
+				Initial:    100 * time.Millisecond,
+				Max:        time.Second,
+				Multiplier: 3,
+				Deadline:   2 * time.Second,
+			}))
+		})
+	})
+
+	Describe("Delay", func() {
+		It("grows the delay by the multiplier up to the max", func() {
+			Expect(policy.Delay(0)).To(Equal(100 * time.Millisecond))
+			Expect(policy.Delay(1)).To(Equal(300 * time.Millisecond))
+			Expect(policy.Delay(2)).To(Equal(900 * time.Millisecond))
+			Expect(policy.Delay(3)).To(Equal(time.Second))
+			Expect(policy.Delay(50)).To(Equal(time.Second))
+		})
+	})
+
+	Describe("Retry", func() {
+		It("does not sleep when the first attempt succeeds", func() {
+			err := policy.Retry(context.Background(), sleep, func(int) error {
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sleeps).To(BeEmpty())
+		})
+
+		It("retries with growing delays until an attempt succeeds", func() {
+			var attempts []int
+			err := policy.Retry(context.Background(), sleep, func(attempt int) error {
+				attempts = append(attempts, attempt)
+				if attempt < 2 {
+					return errors.New("not yet")
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal([]int{0, 1, 2}))
+			Expect(sleeps).To(Equal([]time.Duration{100 * time.Millisecond, 300 * time.Millisecond}))
+		})
+
+		It("returns the last error once the sleeps reach the deadline", func() {
+			calls := 0
+			err := policy.Retry(context.Background(), sleep, func(int) error {
+				calls++
+				return errors.New("still failing")
+			})
+			Expect(err).To(MatchError("still failing"))
+			Expect(calls).To(Equal(4))
+			Expect(sleeps).To(Equal([]time.Duration{
+				100 * time.Millisecond,
+				300 * time.Millisecond,
+				900 * time.Millisecond,
+				time.Second,
+			}))
+		})
+
+		It("stops retrying once the context is done", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			calls := 0
+			err := policy.Retry(ctx, sleep, func(int) error {
+				calls++
+				cancel()
+				return errors.New("still failing")
+			})
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(calls).To(Equal(1))
+			Expect(sleeps).To(BeEmpty())
+		})
+
+		Context("when jitter is configured", func() {
+			BeforeEach(func() {
+				policy.Multiplier = 1
+				policy.Jitter = 0.5
+				policy.Deadline = time.Minute
+			})
+
+			It("keeps every delay within the jitter of the unjittered delay", func() {
+				calls := 0
+				policy.Retry(context.Background(), sleep, func(int) error {
+					calls++
+					if calls == 100 {
+						return nil
+					}
+					return errors.New("still failing")
+				})
+				Expect(sleeps).To(HaveLen(99))
+				for _, duration := range sleeps {
+					Expect(duration).To(BeNumerically(">=", 50*time.Millisecond))
+					Expect(duration).To(BeNumerically("<=", 150*time.Millisecond))
+				}
+			})
+		})
+	})
+})
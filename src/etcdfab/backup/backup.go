@@ -0,0 +1,318 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+)
+
+const (
+	metadataFileName = "metadata.json"
+	dataPrefix       = "data/"
+)
+
+// Metadata is stored alongside the data dir in every backup archive. Files
+// maps the slash separated path of every file relative to the data dir to
+// its hex encoded sha256 checksum.
+type Metadata struct {
+	ClusterID   string            `json:"cluster_id"`
+	EtcdVersion string            `json:"etcd_version"`
+	RaftIndex   uint64            `json:"raft_index"`
+	Members     []client.Member   `json:"members"`
+	CreatedAt   time.Time         `json:"created_at"`
+	Files       map[string]string `json:"files"`
+}
+
+// Create writes the contents of dataDir and the metadata to a gzipped tarball
+// at archivePath. The archive is written to a temporary file first, so
+// archivePath only ever contains a complete backup. The returned metadata has
+// Files filled in.
+func Create(archivePath, dataDir string, metadata Metadata) (Metadata, error) {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(archivePath), fmt.Sprintf(".%s", filepath.Base(archivePath)))
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	metadata, err = writeArchive(tmpFile, dataDir, metadata)
+	if err != nil {
+		tmpFile.Close()
+		return Metadata{}, err
+	}
+
+	err = tmpFile.Sync()
+	if err != nil {
+		tmpFile.Close()
+		return Metadata{}, err
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	err = os.Rename(tmpFile.Name(), archivePath)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return metadata, nil
+}
+
+func writeArchive(w io.Writer, dataDir string, metadata Metadata) (Metadata, error) {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	metadata.Files = map[string]string{}
+	err := filepath.Walk(dataDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dataDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = dataPrefix + relPath
+
+		switch {
+		case info.IsDir():
+			header.Name += "/"
+			return tarWriter.WriteHeader(header)
+		case info.Mode().IsRegular():
+			checksum, err := addFile(tarWriter, header, filePath)
+			if err != nil {
+				return err
+			}
+			metadata.Files[relPath] = checksum
+			return nil
+		default:
+			return fmt.Errorf("cannot back up %s: not a regular file or directory", filePath)
+		}
+	})
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	err = tarWriter.WriteHeader(&tar.Header{
+		Name:     metadataFileName,
+		Mode:     0644,
+		Size:     int64(len(metadataJSON)),
+		ModTime:  metadata.CreatedAt,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	_, err = tarWriter.Write(metadataJSON)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	err = gzipWriter.Close()
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return metadata, nil
+}
+
+// addFile copies exactly as many bytes as the header announces, so a file
+// that grows while it is archived cannot corrupt the archive. dataDir must
+// not be written to while Create runs, which is why Backup archives the copy
+// etcdctl takes instead of the data dir of the running member.
+func addFile(tarWriter *tar.Writer, header *tar.Header, filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	err = tarWriter.WriteHeader(header)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	_, err = io.CopyN(io.MultiWriter(tarWriter, hash), file, header.Size)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Extract unpacks the data dir stored in the archive at archivePath into
+// dataDir and verifies every file against the checksums in the metadata.
+// When it returns an error dataDir may contain a partial restore.
+func Extract(archivePath, dataDir string) (Metadata, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	var metadata *Metadata
+	checksums := map[string]string{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Metadata{}, err
+		}
+
+		if header.Name == metadataFileName {
+			metadata = &Metadata{}
+			err = json.NewDecoder(tarReader).Decode(metadata)
+			if err != nil {
+				return Metadata{}, fmt.Errorf("invalid backup metadata: %s", err)
+			}
+			continue
+		}
+
+		relPath, err := dataPath(header.Name)
+		if err != nil {
+			return Metadata{}, err
+		}
+		target := filepath.Join(dataDir, filepath.FromSlash(relPath))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, header.FileInfo().Mode().Perm()|0700)
+			if err != nil {
+				return Metadata{}, err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			checksums[relPath], err = extractFile(tarReader, target, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return Metadata{}, err
+			}
+		default:
+			return Metadata{}, fmt.Errorf("unsupported entry %q in backup archive", header.Name)
+		}
+	}
+
+	if metadata == nil {
+		return Metadata{}, errors.New("backup archive does not contain any metadata")
+	}
+
+	err = verifyChecksums(metadata.Files, checksums)
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return *metadata, nil
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) (string, error) {
+	err := os.MkdirAll(filepath.Dir(target), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		return "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// dataPath strips the data prefix from an archive entry and rejects entries
+// that would end up outside of the data dir.
+func dataPath(name string) (string, error) {
+	cleaned := path.Clean(name)
+	if !strings.HasPrefix(cleaned, dataPrefix) {
+		return "", fmt.Errorf("unexpected entry %q in backup archive", name)
+	}
+
+	return strings.TrimPrefix(cleaned, dataPrefix), nil
+}
+
+func verifyChecksums(expected, actual map[string]string) error {
+	var names []string
+	for name := range expected {
+		names = append(names, name)
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expectedChecksum, ok := expected[name]
+		if !ok {
+			return fmt.Errorf("backup archive contains %s which is not listed in its metadata", name)
+		}
+
+		actualChecksum, ok := actual[name]
+		if !ok {
+			return fmt.Errorf("backup archive is missing %s", name)
+		}
+
+		if actualChecksum != expectedChecksum {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, expectedChecksum, actualChecksum)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/backup"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type archiveEntry struct {
+	name     string
+	contents string
+}
+
+func sha256Hex(contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeArchive(archivePath string, entries []archiveEntry) {
+	file, err := os.Create(archivePath)
+	Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Mode:     0644,
+			Size:     int64(len(entry.contents)),
+			Typeflag: tar.TypeReg,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = tarWriter.Write([]byte(entry.contents))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tarWriter.Close()).To(Succeed())
+	Expect(gzipWriter.Close()).To(Succeed())
+}
+
+var _ = Describe("Backup", func() {
+	var (
+		tmpDir      string
+		dataDir     string
+		restoreDir  string
+		archivePath string
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		dataDir = filepath.Join(tmpDir, "data")
+		Expect(os.MkdirAll(filepath.Join(dataDir, "member", "snap"), os.ModePerm)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dataDir, "member", "wal"), os.ModePerm)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDir, "member", "snap", "0000000000000002-0000000000000005.snap"), []byte("some-snapshot"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dataDir, "member", "wal", "0000000000000000-0000000000000000.wal"), []byte("some-wal"), 0600)).To(Succeed())
+
+		restoreDir = filepath.Join(tmpDir, "restore")
+		Expect(os.Mkdir(restoreDir, os.ModePerm)).To(Succeed())
+
+		archivePath = filepath.Join(tmpDir, "etcd-backup.tgz")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	Describe("Create", func() {
+		It("archives the data dir with checksums and metadata that Extract restores", func() {
+			createdAt := time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+			metadata, err := backup.Create(archivePath, dataDir, backup.Metadata{
+				ClusterID:   "some-cluster-id",
+				EtcdVersion: "2.3.8",
+				RaftIndex:   1234,
+				Members: []client.Member{
+					{ID: "some-id", Name: "some-name-0"},
+				},
+				CreatedAt: createdAt,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(metadata.Files).To(Equal(map[string]string{
+				"member/snap/0000000000000002-0000000000000005.snap": sha256Hex("some-snapshot"),
+				"member/wal/0000000000000000-0000000000000000.wal":   sha256Hex("some-wal"),
+			}))
+
+			restored, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(restored).To(Equal(metadata))
+			Expect(restored.CreatedAt).To(Equal(createdAt))
+
+			contents, err := ioutil.ReadFile(filepath.Join(restoreDir, "member", "wal", "0000000000000000-0000000000000000.wal"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-wal"))
+
+			info, err := os.Stat(filepath.Join(restoreDir, "member", "wal", "0000000000000000-0000000000000000.wal"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			contents, err = ioutil.ReadFile(filepath.Join(restoreDir, "member", "snap", "0000000000000002-0000000000000005.snap"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal("some-snapshot"))
+		})
+
+		It("does not leave temporary files behind", func() {
+			_, err := backup.Create(archivePath, dataDir, backup.Metadata{})
+			Expect(err).NotTo(HaveOccurred())
+
+			files, err := filepath.Glob(filepath.Join(tmpDir, ".*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+
+		Context("when the data dir does not exist", func() {
+			It("returns an error and does not create the archive", func() {
+				_, err := backup.Create(archivePath, "/path/to/missing/data/dir", backup.Metadata{})
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+				Expect(archivePath).NotTo(BeAnExistingFile())
+			})
+		})
+
+		Context("when the archive cannot be written", func() {
+			It("returns an error", func() {
+				_, err := backup.Create("/path/to/missing/dir/backup.tgz", dataDir, backup.Metadata{})
+				Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+			})
+		})
+	})
+
+	Describe("Extract", func() {
+		It("returns an error when a file does not match its checksum", func() {
+			writeArchive(archivePath, []archiveEntry{
+				{name: "data/member/wal/0.wal", contents: "tampered"},
+				{name: "metadata.json", contents: `{"files": {"member/wal/0.wal": "` + sha256Hex("some-wal") + `"}}`},
+			})
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(MatchError(ContainSubstring("checksum mismatch for member/wal/0.wal")))
+		})
+
+		It("returns an error when a file listed in the metadata is missing", func() {
+			writeArchive(archivePath, []archiveEntry{
+				{name: "metadata.json", contents: `{"files": {"member/wal/0.wal": "` + sha256Hex("some-wal") + `"}}`},
+			})
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(MatchError("backup archive is missing member/wal/0.wal"))
+		})
+
+		It("returns an error when the archive contains a file not listed in the metadata", func() {
+			writeArchive(archivePath, []archiveEntry{
+				{name: "data/member/wal/0.wal", contents: "some-wal"},
+				{name: "metadata.json", contents: `{"files": {}}`},
+			})
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(MatchError("backup archive contains member/wal/0.wal which is not listed in its metadata"))
+		})
+
+		It("returns an error when the archive has no metadata", func() {
+			writeArchive(archivePath, []archiveEntry{
+				{name: "data/member/wal/0.wal", contents: "some-wal"},
+			})
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(MatchError("backup archive does not contain any metadata"))
+		})
+
+		It("returns an error when the metadata is invalid", func() {
+			writeArchive(archivePath, []archiveEntry{
+				{name: "metadata.json", contents: "%%%"},
+			})
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(MatchError(ContainSubstring("invalid backup metadata")))
+		})
+
+		It("refuses entries outside of the data dir", func() {
+			writeArchive(archivePath, []archiveEntry{
+				{name: "data/../../etc/passwd", contents: "evil"},
+			})
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(MatchError(`unexpected entry "data/../../etc/passwd" in backup archive`))
+			Expect(filepath.Join(tmpDir, "etc", "passwd")).NotTo(BeAnExistingFile())
+		})
+
+		It("returns an error when the archive is not a gzipped tarball", func() {
+			Expect(ioutil.WriteFile(archivePath, []byte("not-an-archive"), 0644)).To(Succeed())
+
+			_, err := backup.Extract(archivePath, restoreDir)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error when the archive does not exist", func() {
+			_, err := backup.Extract("/path/to/missing/backup.tgz", restoreDir)
+			Expect(err).To(MatchError(ContainSubstring("no such file or directory")))
+		})
+	})
+})
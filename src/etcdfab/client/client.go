@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type etcdAPI interface {
+	Configure(Config) error
+	Self() (EtcdClientInterface, error)
+	Close() error
+	MemberList(context.Context) ([]Member, error)
+	MemberAdd(context.Context, string) (Member, error)
+	MemberRemove(context.Context, string) error
+	Leader(context.Context) (Member, error)
+	MemberUpdate(context.Context, string, string) error
+	Keys(context.Context) error
+	KeyCreate(context.Context, string, string, time.Duration) (bool, error)
+	KeyGet(context.Context, string) (string, error)
+	KeyCompareAndDelete(context.Context, string, string) (bool, error)
+	Health(context.Context) (bool, error)
+	Version(context.Context) (Version, error)
+	SelfStats(context.Context) (SelfStats, error)
+	LeaderStats(context.Context) (LeaderStats, error)
+	EndpointHealth(context.Context, string) (bool, error)
+	EndpointVersion(context.Context, string) (Version, error)
+	EndpointSelfStats(context.Context, string) (SelfStats, error)
+	EndpointLeaderStats(context.Context, string) (LeaderStats, error)
+	EndpointLeader(context.Context, string) (string, error)
+	EndpointStatus(context.Context, string) (EndpointStatus, error)
+}
+
+// Client talks to etcd through the v2 or the v3 API. Which one is decided
+// when it is configured, since the config is only read after the client is
+// handed to the controllers.
+type Client struct {
+	etcdAPI
+
+	v2 *EtcdClient
+	v3 *EtcdV3Client
+}
+
+func NewClient(logger logger) *Client {
+	return &Client{
+		v2: NewEtcdClient(logger),
+		v3: NewEtcdV3Client(logger),
+	}
+}
+
+func (c *Client) Configure(etcdfabConfig Config) error {
+	switch etcdfabConfig.EtcdClientAPI() {
+	case "", "v2":
+		c.etcdAPI = c.v2
+	case "v3":
+		c.etcdAPI = c.v3
+	default:
+		return fmt.Errorf("unknown client api %q", etcdfabConfig.EtcdClientAPI())
+	}
+
+	return c.etcdAPI.Configure(etcdfabConfig)
+}
+
+func (c *Client) Close() error {
+	if c.etcdAPI == nil {
+		return nil
+	}
+
+	return c.etcdAPI.Close()
+}
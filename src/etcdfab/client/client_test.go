@@ -0,0 +1,94 @@
+package client_test
+
+import (
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		etcdClient *client.Client
+
+		logger *fakes.Logger
+		cfg    *fakes.Config
+	)
+
+	BeforeEach(func() {
+		logger = &fakes.Logger{}
+		cfg = &fakes.Config{}
+		cfg.EtcdClientEndpointsCall.Returns.Endpoints = []string{"http://127.0.0.1:4001"}
+		cfg.EtcdClientSelfEndpointCall.Returns.Endpoint = "http://127.0.0.1:4001"
+
+		etcdClient = client.NewClient(logger)
+	})
+
+	Describe("Configure", func() {
+		Context("when the client api is v2", func() {
+			It("configures the v2 client", func() {
+				cfg.EtcdClientAPICall.Returns.API = "v2"
+
+				err := etcdClient.Configure(cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger.Messages()).To(Equal([]fakes.LoggerMessage{
+					{
+						Action: "etcd-client.configure.config",
+						Data: []lager.Data{
+							{
+								"endpoints":     []string{"http://127.0.0.1:4001"},
+								"self-endpoint": "http://127.0.0.1:4001",
+							},
+						},
+					},
+				}))
+			})
+		})
+
+		Context("when the client api is not set", func() {
+			It("configures the v2 client", func() {
+				err := etcdClient.Configure(cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger.Messages()[0].Action).To(Equal("etcd-client.configure.config"))
+			})
+		})
+
+		Context("when the client api is v3", func() {
+			It("configures the v3 client", func() {
+				cfg.EtcdClientAPICall.Returns.API = "v3"
+
+				err := etcdClient.Configure(cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger.Messages()).To(Equal([]fakes.LoggerMessage{
+					{
+						Action: "etcd-v3-client.configure.config",
+						Data: []lager.Data{
+							{
+								"endpoints":     []string{"http://127.0.0.1:4001"},
+								"self-endpoint": "http://127.0.0.1:4001",
+							},
+						},
+					},
+				}))
+			})
+		})
+
+		Context("failure cases", func() {
+			Context("when the client api is unknown", func() {
+				It("returns an error", func() {
+					cfg.EtcdClientAPICall.Returns.API = "v4"
+
+					err := etcdClient.Configure(cfg)
+					Expect(err).To(MatchError(`unknown client api "v4"`))
+					Expect(logger.Messages()).To(BeEmpty())
+				})
+			})
+		})
+	})
+})
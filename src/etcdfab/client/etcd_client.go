@@ -2,7 +2,13 @@ package client
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -13,15 +19,29 @@ import (
 )
 
 type EtcdClientInterface interface {
-	MemberList() ([]Member, error)
-	MemberAdd(string) (Member, error)
-	Keys() error
+	MemberList(context.Context) ([]Member, error)
+	MemberAdd(context.Context, string) (Member, error)
+	MemberUpdate(context.Context, string, string) error
+	Keys(context.Context) error
+	Leader(context.Context) (Member, error)
+	Health(context.Context) (bool, error)
+	Version(context.Context) (Version, error)
+	SelfStats(context.Context) (SelfStats, error)
+	LeaderStats(context.Context) (LeaderStats, error)
+	Close() error
 }
 
 type EtcdClient struct {
 	coreosEtcdClient coreosetcdclient.Client
 	clientConfig     coreosetcdclient.Config
+	httpClient       *http.Client
 	selfEndpoint     string
+	transport        coreosetcdclient.CancelableTransport
+
+	// endpointsSynced is read and set by calls that can run concurrently, as
+	// when the admin endpoints are served next to a running member.
+	endpointsMutex  sync.Mutex
+	endpointsSynced bool
 
 	logger logger
 }
@@ -33,9 +53,61 @@ type Member struct {
 	ClientURLs []string
 }
 
+type EndpointStatus struct {
+	ClusterID   string
+	EtcdVersion string
+	RaftIndex   uint64
+	RaftTerm    uint64
+}
+
+type Version struct {
+	EtcdServer  string `json:"etcdserver"`
+	EtcdCluster string `json:"etcdcluster"`
+}
+
+// SelfStats is what a member reports about itself, including the leader it
+// follows.
+type SelfStats struct {
+	Name                 string     `json:"name"`
+	ID                   string     `json:"id"`
+	State                string     `json:"state"`
+	StartTime            time.Time  `json:"startTime"`
+	LeaderInfo           LeaderInfo `json:"leaderInfo"`
+	RecvAppendRequestCnt uint64     `json:"recvAppendRequestCnt"`
+	SendAppendRequestCnt uint64     `json:"sendAppendRequestCnt"`
+}
+
+type LeaderInfo struct {
+	Leader    string    `json:"leader"`
+	Uptime    string    `json:"uptime"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// LeaderStats is what the leader reports about its followers. Only the leader
+// serves it.
+type LeaderStats struct {
+	Leader    string                   `json:"leader"`
+	Followers map[string]FollowerStats `json:"followers"`
+}
+
+type FollowerStats struct {
+	Latency struct {
+		Current           float64 `json:"current"`
+		Average           float64 `json:"average"`
+		StandardDeviation float64 `json:"standardDeviation"`
+		Minimum           float64 `json:"minimum"`
+		Maximum           float64 `json:"maximum"`
+	} `json:"latency"`
+	Counts struct {
+		Fail    uint64 `json:"fail"`
+		Success uint64 `json:"success"`
+	} `json:"counts"`
+}
+
 type Config interface {
 	EtcdClientEndpoints() []string
 	EtcdClientSelfEndpoint() string
+	EtcdClientAPI() string
 	RequireSSL() bool
 	CertDir() string
 }
@@ -83,11 +155,19 @@ func (e *EtcdClient) Configure(etcdfabConfig Config) error {
 		}
 	}
 
+	e.transport = tns
+	e.endpointsMutex.Lock()
+	e.endpointsSynced = false
+	e.endpointsMutex.Unlock()
 	e.clientConfig = coreosetcdclient.Config{
 		Endpoints:               endpoints,
-		Transport:               tns,
+		Transport:               e.transport,
 		HeaderTimeoutPerRequest: time.Second,
 	}
+	e.httpClient = &http.Client{
+		Transport: tns,
+		Timeout:   time.Second,
+	}
 	e.coreosEtcdClient, err = coreosetcdclient.New(e.clientConfig)
 	if err != nil {
 		return err
@@ -97,9 +177,14 @@ func (e *EtcdClient) Configure(etcdfabConfig Config) error {
 }
 
 func (e *EtcdClient) Self() (EtcdClientInterface, error) {
-	var selfEtcdClient = &EtcdClient{}
-	*selfEtcdClient = *e
-
+	selfEtcdClient := &EtcdClient{
+		clientConfig:    e.clientConfig,
+		httpClient:      e.httpClient,
+		selfEndpoint:    e.selfEndpoint,
+		transport:       e.transport,
+		endpointsSynced: true,
+		logger:          e.logger,
+	}
 	selfEtcdClient.clientConfig.Endpoints = []string{e.selfEndpoint}
 
 	var err error
@@ -111,12 +196,23 @@ func (e *EtcdClient) Self() (EtcdClientInterface, error) {
 	return selfEtcdClient, nil
 }
 
-func (e *EtcdClient) MemberList() ([]Member, error) {
-	membersAPI := coreosetcdclient.NewMembersAPI(e.coreosEtcdClient)
-	memberList, err := membersAPI.List(context.Background())
+// Close does nothing, since the v2 client talks plain HTTP over a transport
+// it shares with the clients made by Self and holds no connections of its own.
+func (e *EtcdClient) Close() error {
+	return nil
+}
+
+func (e *EtcdClient) MemberList(ctx context.Context) ([]Member, error) {
+	callClient, recorder, err := e.call()
 	if err != nil {
 		return []Member{}, err
 	}
+	membersAPI := coreosetcdclient.NewMembersAPI(callClient)
+	memberList, err := membersAPI.List(ctx)
+	if err != nil {
+		return []Member{}, err
+	}
+	e.served(ctx, "member-list", recorder.Endpoint())
 
 	var members []Member
 	for _, m := range memberList {
@@ -131,12 +227,18 @@ func (e *EtcdClient) MemberList() ([]Member, error) {
 	return members, nil
 }
 
-func (e *EtcdClient) MemberAdd(peerURL string) (Member, error) {
-	membersAPI := coreosetcdclient.NewMembersAPI(e.coreosEtcdClient)
-	m, err := membersAPI.Add(context.Background(), peerURL)
+func (e *EtcdClient) MemberAdd(ctx context.Context, peerURL string) (Member, error) {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return Member{}, err
+	}
+	membersAPI := coreosetcdclient.NewMembersAPI(callClient)
+	m, err := membersAPI.Add(ctx, peerURL)
 	if err != nil {
 		return Member{}, err
 	}
+	e.served(ctx, "member-add", recorder.Endpoint())
+
 	return Member{
 		ID:         m.ID,
 		Name:       m.Name,
@@ -145,17 +247,403 @@ func (e *EtcdClient) MemberAdd(peerURL string) (Member, error) {
 	}, nil
 }
 
-func (e *EtcdClient) MemberRemove(memberID string) error {
-	membersAPI := coreosetcdclient.NewMembersAPI(e.coreosEtcdClient)
-	err := membersAPI.Remove(context.Background(), memberID)
+func (e *EtcdClient) MemberRemove(ctx context.Context, memberID string) error {
+	callClient, recorder, err := e.call()
 	if err != nil {
 		return err
 	}
+	membersAPI := coreosetcdclient.NewMembersAPI(callClient)
+	err = membersAPI.Remove(ctx, memberID)
+	if err != nil {
+		return err
+	}
+	e.served(ctx, "member-remove", recorder.Endpoint())
+
 	return nil
 }
 
-func (e *EtcdClient) Keys() error {
-	keysAPI := coreosetcdclient.NewKeysAPI(e.coreosEtcdClient)
-	_, err := keysAPI.Get(context.Background(), "", &coreosetcdclient.GetOptions{})
+func (e *EtcdClient) Leader(ctx context.Context) (Member, error) {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return Member{}, err
+	}
+	membersAPI := coreosetcdclient.NewMembersAPI(callClient)
+	m, err := membersAPI.Leader(ctx)
+	if err != nil {
+		return Member{}, err
+	}
+	e.served(ctx, "leader", recorder.Endpoint())
+
+	if m == nil {
+		return Member{}, errors.New("cluster has no leader")
+	}
+
+	return Member{
+		ID:         m.ID,
+		Name:       m.Name,
+		PeerURLs:   m.PeerURLs,
+		ClientURLs: m.ClientURLs,
+	}, nil
+}
+
+func (e *EtcdClient) MemberUpdate(ctx context.Context, memberID, peerURL string) error {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return err
+	}
+	membersAPI := coreosetcdclient.NewMembersAPI(callClient)
+	err = membersAPI.Update(ctx, memberID, []string{peerURL})
+	if err != nil {
+		return err
+	}
+	e.served(ctx, "member-update", recorder.Endpoint())
+
+	return nil
+}
+
+func (e *EtcdClient) Keys(ctx context.Context) error {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return err
+	}
+	keysAPI := coreosetcdclient.NewKeysAPI(callClient)
+	_, err = keysAPI.Get(ctx, "", &coreosetcdclient.GetOptions{})
+	if err != nil {
+		return err
+	}
+	e.served(ctx, "keys", recorder.Endpoint())
+
+	return nil
+}
+
+// KeyCreate sets key to value with the given TTL unless the key already
+// exists, in which case it returns false without an error.
+func (e *EtcdClient) KeyCreate(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return false, err
+	}
+	keysAPI := coreosetcdclient.NewKeysAPI(callClient)
+	_, err = keysAPI.Set(ctx, key, value, &coreosetcdclient.SetOptions{
+		PrevExist: coreosetcdclient.PrevNoExist,
+		TTL:       ttl,
+	})
+	if isEtcdError(err, coreosetcdclient.ErrorCodeNodeExist) {
+		e.served(ctx, "key-create", recorder.Endpoint())
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.served(ctx, "key-create", recorder.Endpoint())
+
+	return true, nil
+}
+
+// KeyGet returns the value of key, or an empty string when it does not exist.
+func (e *EtcdClient) KeyGet(ctx context.Context, key string) (string, error) {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return "", err
+	}
+	keysAPI := coreosetcdclient.NewKeysAPI(callClient)
+	response, err := keysAPI.Get(ctx, key, &coreosetcdclient.GetOptions{Quorum: true})
+	if isEtcdError(err, coreosetcdclient.ErrorCodeKeyNotFound) {
+		e.served(ctx, "key-get", recorder.Endpoint())
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	e.served(ctx, "key-get", recorder.Endpoint())
+
+	return response.Node.Value, nil
+}
+
+// KeyCompareAndDelete deletes key if it still holds value. It returns false
+// without an error when the key is gone or holds another value.
+func (e *EtcdClient) KeyCompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	callClient, recorder, err := e.call()
+	if err != nil {
+		return false, err
+	}
+	keysAPI := coreosetcdclient.NewKeysAPI(callClient)
+	_, err = keysAPI.Delete(ctx, key, &coreosetcdclient.DeleteOptions{PrevValue: value})
+	if isEtcdError(err, coreosetcdclient.ErrorCodeKeyNotFound) || isEtcdError(err, coreosetcdclient.ErrorCodeTestFailed) {
+		e.served(ctx, "key-compare-and-delete", recorder.Endpoint())
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.served(ctx, "key-compare-and-delete", recorder.Endpoint())
+
+	return true, nil
+}
+
+// call returns a client for a single call over the endpoints of e, along
+// with a recorder of the endpoint that answers it. Each call gets its own
+// recorder, since calls can run concurrently and the coreos client picks and
+// rotates endpoints internally.
+func (e *EtcdClient) call() (coreosetcdclient.Client, *endpointRecorder, error) {
+	recorder := &endpointRecorder{CancelableTransport: e.transport}
+
+	callConfig := e.clientConfig
+	callConfig.Endpoints = e.coreosEtcdClient.Endpoints()
+	callConfig.Transport = recorder
+
+	callClient, err := coreosetcdclient.New(callConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return callClient, recorder, nil
+}
+
+// served logs the endpoint that answered a call. Until a sync succeeds, a call
+// that gets through also swaps the configured endpoints, which in TLS mode is
+// a single DNS name, for the client URLs of the members, so that later calls
+// fail over between members instead of waiting on a dead node behind that
+// name.
+func (e *EtcdClient) served(ctx context.Context, action, endpoint string) {
+	e.logger.Info(fmt.Sprintf("etcd-client.%s", action), lager.Data{
+		"endpoint": endpoint,
+	})
+
+	e.endpointsMutex.Lock()
+	defer e.endpointsMutex.Unlock()
+	if e.endpointsSynced {
+		return
+	}
+
+	err := e.coreosEtcdClient.Sync(ctx)
+	if err != nil {
+		e.logger.Error("etcd-client.sync-endpoints.failed", err)
+		return
+	}
+	e.endpointsSynced = true
+
+	e.logger.Info("etcd-client.sync-endpoints", lager.Data{
+		"endpoints": e.coreosEtcdClient.Endpoints(),
+	})
+}
+
+// endpointRecorder remembers the endpoint that answered the request of a
+// single call.
+type endpointRecorder struct {
+	coreosetcdclient.CancelableTransport
+
+	mutex    sync.Mutex
+	endpoint string
+}
+
+func (r *endpointRecorder) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := r.CancelableTransport.RoundTrip(request)
+	if err == nil {
+		r.mutex.Lock()
+		r.endpoint = fmt.Sprintf("%s://%s", request.URL.Scheme, request.URL.Host)
+		r.mutex.Unlock()
+	}
+
+	return response, err
+}
+
+func (r *endpointRecorder) Endpoint() string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.endpoint
+}
+
+func isEtcdError(err error, code int) bool {
+	etcdErr, ok := err.(coreosetcdclient.Error)
+	return ok && etcdErr.Code == code
+}
+
+func (e *EtcdClient) EndpointHealth(ctx context.Context, endpoint string) (bool, error) {
+	var health struct {
+		Health string `json:"health"`
+	}
+	err := e.getJSON(ctx, fmt.Sprintf("%s/health", endpoint), &health)
+	if err != nil {
+		return false, err
+	}
+
+	return health.Health == "true", nil
+}
+
+// Health reports the health of the first member endpoint that answers.
+func (e *EtcdClient) Health(ctx context.Context) (bool, error) {
+	var healthy bool
+	err := e.eachEndpoint(func(endpoint string) error {
+		var err error
+		healthy, err = e.EndpointHealth(ctx, endpoint)
+		return err
+	})
+
+	return healthy, err
+}
+
+// Version reports the version of the first member endpoint that answers.
+func (e *EtcdClient) Version(ctx context.Context) (Version, error) {
+	var version Version
+	err := e.eachEndpoint(func(endpoint string) error {
+		var err error
+		version, err = e.EndpointVersion(ctx, endpoint)
+		return err
+	})
+
+	return version, err
+}
+
+// SelfStats reports the stats of the first member endpoint that answers.
+func (e *EtcdClient) SelfStats(ctx context.Context) (SelfStats, error) {
+	var stats SelfStats
+	err := e.eachEndpoint(func(endpoint string) error {
+		var err error
+		stats, err = e.EndpointSelfStats(ctx, endpoint)
+		return err
+	})
+
+	return stats, err
+}
+
+// LeaderStats finds the leader and asks it for its follower stats.
+func (e *EtcdClient) LeaderStats(ctx context.Context) (LeaderStats, error) {
+	leader, err := e.Leader(ctx)
+	if err != nil {
+		return LeaderStats{}, err
+	}
+
+	if len(leader.ClientURLs) == 0 {
+		return LeaderStats{}, fmt.Errorf("leader %s has no client urls", leader.Name)
+	}
+
+	var stats LeaderStats
+	for _, clientURL := range leader.ClientURLs {
+		stats, err = e.EndpointLeaderStats(ctx, clientURL)
+		if err == nil {
+			return stats, nil
+		}
+	}
+
+	return LeaderStats{}, err
+}
+
+func (e *EtcdClient) EndpointVersion(ctx context.Context, endpoint string) (Version, error) {
+	var version Version
+	err := e.getJSON(ctx, fmt.Sprintf("%s/version", endpoint), &version)
+	if err != nil {
+		return Version{}, err
+	}
+
+	return version, nil
+}
+
+func (e *EtcdClient) EndpointSelfStats(ctx context.Context, endpoint string) (SelfStats, error) {
+	var stats SelfStats
+	err := e.getJSON(ctx, fmt.Sprintf("%s/v2/stats/self", endpoint), &stats)
+	if err != nil {
+		return SelfStats{}, err
+	}
+
+	return stats, nil
+}
+
+// EndpointLeaderStats asks a single endpoint for its follower stats, which
+// fails unless the endpoint is the leader.
+func (e *EtcdClient) EndpointLeaderStats(ctx context.Context, endpoint string) (LeaderStats, error) {
+	var stats LeaderStats
+	err := e.getJSON(ctx, fmt.Sprintf("%s/v2/stats/leader", endpoint), &stats)
+	if err != nil {
+		return LeaderStats{}, err
+	}
+
+	return stats, nil
+}
+
+// EndpointLeader asks a single endpoint for the ID of the member it currently
+// follows as leader. It is empty while the endpoint knows of no leader.
+func (e *EtcdClient) EndpointLeader(ctx context.Context, endpoint string) (string, error) {
+	stats, err := e.EndpointSelfStats(ctx, endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	return stats.LeaderInfo.Leader, nil
+}
+
+// EndpointStatus asks a single endpoint for its version and reads the cluster
+// ID and raft position from the headers etcd attaches to every keys response.
+func (e *EtcdClient) EndpointStatus(ctx context.Context, endpoint string) (EndpointStatus, error) {
+	version, err := e.EndpointVersion(ctx, endpoint)
+	if err != nil {
+		return EndpointStatus{}, err
+	}
+
+	response, err := e.get(ctx, fmt.Sprintf("%s/v2/keys", endpoint))
+	if err != nil {
+		return EndpointStatus{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return EndpointStatus{}, fmt.Errorf("unexpected status code %d from %s/v2/keys", response.StatusCode, endpoint)
+	}
+
+	raftIndex, err := strconv.ParseUint(response.Header.Get("X-Raft-Index"), 10, 64)
+	if err != nil {
+		return EndpointStatus{}, fmt.Errorf("invalid X-Raft-Index header from %s: %s", endpoint, err)
+	}
+
+	raftTerm, err := strconv.ParseUint(response.Header.Get("X-Raft-Term"), 10, 64)
+	if err != nil {
+		return EndpointStatus{}, fmt.Errorf("invalid X-Raft-Term header from %s: %s", endpoint, err)
+	}
+
+	return EndpointStatus{
+		ClusterID:   response.Header.Get("X-Etcd-Cluster-Id"),
+		EtcdVersion: version.EtcdServer,
+		RaftIndex:   raftIndex,
+		RaftTerm:    raftTerm,
+	}, nil
+}
+
+// eachEndpoint calls f with the endpoints of the client in turn until one of
+// them answers, and returns the last error when none does. Once the endpoints
+// are synced these are the client URLs of the members rather than the
+// configured ones.
+func (e *EtcdClient) eachEndpoint(f func(string) error) error {
+	err := errors.New("no endpoints configured")
+	for _, endpoint := range e.coreosEtcdClient.Endpoints() {
+		err = f(endpoint)
+		if err == nil {
+			return nil
+		}
+	}
+
 	return err
 }
+
+func (e *EtcdClient) getJSON(ctx context.Context, url string, v interface{}) error {
+	response, err := e.get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from %s", response.StatusCode, url)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+func (e *EtcdClient) get(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.httpClient.Do(request.WithContext(ctx))
+}
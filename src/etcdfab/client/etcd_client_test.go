@@ -1,9 +1,11 @@
 package client_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -175,10 +177,29 @@ var _ = Describe("EtcdClient", func() {
 
 			Expect(selfEtcdClient).ToNot(BeNil())
 
-			_, err = selfEtcdClient.MemberList()
+			_, err = selfEtcdClient.MemberList(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("keeps the self client on the self endpoint", func() {
+			selfEtcdClient, err := etcdClient.Self()
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = selfEtcdClient.MemberList(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logger.Messages()[1:]).To(Equal([]fakes.LoggerMessage{
+				{
+					Action: "etcd-client.member-list",
+					Data: []lager.Data{
+						{
+							"endpoint": etcdServer.URL(),
+						},
+					},
+				},
+			}))
+		})
+
 		Context("failure cases", func() {
 			BeforeEach(func() {
 				client.SetCoreOSEtcdClientNew(func(cfg coreosetcdclient.Config) (coreosetcdclient.Client, error) {
@@ -217,7 +238,7 @@ var _ = Describe("EtcdClient", func() {
 		})
 
 		It("returns a list of members in the cluster", func() {
-			members, err := etcdClient.MemberList()
+			members, err := etcdClient.MemberList(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(members).To(Equal([]client.Member{
 				{
@@ -233,14 +254,103 @@ var _ = Describe("EtcdClient", func() {
 			}))
 		})
 
+		It("logs the endpoint that served the call and syncs the endpoints with the members", func() {
+			_, err := etcdClient.MemberList(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(logger.Messages()[1:]).To(Equal([]fakes.LoggerMessage{
+				{
+					Action: "etcd-client.member-list",
+					Data: []lager.Data{
+						{
+							"endpoint": etcdServer.URL(),
+						},
+					},
+				},
+				{
+					Action: "etcd-client.sync-endpoints",
+					Data: []lager.Data{
+						{
+							"endpoints": []string{"http://some-node-url:4001"},
+						},
+					},
+				},
+			}))
+		})
+
+		It("syncs the endpoints only once when called concurrently", func() {
+			etcdServer.SetMembersReturn(fmt.Sprintf(`{
+				"members": [
+					{"id": "some-id", "name": "some-node-1", "clientURLs": ["%s"]}
+				]
+			}`, etcdServer.URL()), http.StatusOK)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					_, err := etcdClient.MemberList(context.Background())
+					Expect(err).NotTo(HaveOccurred())
+				}()
+			}
+			wg.Wait()
+
+			var syncs int
+			for _, message := range logger.Messages() {
+				if message.Action == "etcd-client.sync-endpoints" {
+					syncs++
+				}
+			}
+			Expect(syncs).To(Equal(1))
+		})
+
+		Context("when the members advertise several client urls", func() {
+			BeforeEach(func() {
+				etcdServer.SetMembersReturn(`{
+					"members": [
+						{"id": "some-id-1", "name": "some-node-1", "clientURLs": ["http://127.0.0.1:1"]},
+						{"id": "some-id-2", "name": "some-node-2", "clientURLs": ["http://localhost:4001"]}
+					]
+				}`, http.StatusOK)
+			})
+
+			It("fails over to a member that answers", func() {
+				for i := 0; i < 5; i++ {
+					_, err := etcdClient.MemberList(context.Background())
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				messages := logger.Messages()
+				Expect(messages[len(messages)-1]).To(Equal(fakes.LoggerMessage{
+					Action: "etcd-client.member-list",
+					Data: []lager.Data{
+						{
+							"endpoint": "http://localhost:4001",
+						},
+					},
+				}))
+			})
+		})
+
+		It("returns the context error when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := etcdClient.MemberList(ctx)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
 		Context("when members api list fails", func() {
 			BeforeEach(func() {
 				etcdServer.SetMembersReturn("", http.StatusInternalServerError)
 			})
 
 			It("returns an error", func() {
-				_, err := etcdClient.MemberList()
-				Expect(err).To(MatchError("client: etcd cluster is unavailable or misconfigured"))
+				_, err := etcdClient.MemberList(context.Background())
+				Expect(err).To(MatchError(HavePrefix("client: etcd cluster is unavailable or misconfigured")))
 			})
 		})
 	})
@@ -273,7 +383,7 @@ var _ = Describe("EtcdClient", func() {
 		})
 
 		It("returns a list of members in the cluster", func() {
-			member, err := etcdClient.MemberAdd("http://some-node-url-1:7001")
+			member, err := etcdClient.MemberAdd(context.Background(), "http://some-node-url-1:7001")
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(member).To(Equal(client.Member{
@@ -290,8 +400,8 @@ var _ = Describe("EtcdClient", func() {
 			})
 
 			It("returns an error", func() {
-				_, err := etcdClient.MemberAdd("http://fake-peer-url:111")
-				Expect(err).To(MatchError("client: etcd cluster is unavailable or misconfigured"))
+				_, err := etcdClient.MemberAdd(context.Background(), "http://fake-peer-url:111")
+				Expect(err).To(MatchError(HavePrefix("client: etcd cluster is unavailable or misconfigured")))
 			})
 		})
 	})
@@ -319,7 +429,7 @@ var _ = Describe("EtcdClient", func() {
 		})
 
 		It("removes the member from the cluster", func() {
-			err := etcdClient.MemberRemove("member-id")
+			err := etcdClient.MemberRemove(context.Background(), "member-id")
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -329,8 +439,360 @@ var _ = Describe("EtcdClient", func() {
 			})
 
 			It("returns an error", func() {
-				err := etcdClient.MemberRemove("member-id")
-				Expect(err).To(MatchError("client: etcd cluster is unavailable or misconfigured"))
+				err := etcdClient.MemberRemove(context.Background(), "member-id")
+				Expect(err).To(MatchError(HavePrefix("client: etcd cluster is unavailable or misconfigured")))
+			})
+		})
+	})
+
+	Describe("Leader", func() {
+		BeforeEach(func() {
+			etcdServer.SetLeaderReturn(`{
+				"id": "some-id",
+				"name": "some-node-1",
+				"peerURLs": [
+					"http://some-node-url:7001"
+				],
+				"clientURLs": [
+					"http://some-node-url:4001"
+				]
+			}`, http.StatusOK)
+
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the leader of the cluster", func() {
+			leader, err := etcdClient.Leader(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(leader).To(Equal(client.Member{
+				ID:         "some-id",
+				Name:       "some-node-1",
+				PeerURLs:   []string{"http://some-node-url:7001"},
+				ClientURLs: []string{"http://some-node-url:4001"},
+			}))
+		})
+
+		Context("when members api leader fails", func() {
+			BeforeEach(func() {
+				etcdServer.SetLeaderReturn("", http.StatusServiceUnavailable)
+			})
+
+			It("returns an error", func() {
+				_, err := etcdClient.Leader(context.Background())
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("MemberUpdate", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("updates the peer url of the member", func() {
+			err := etcdClient.MemberUpdate(context.Background(), "member-id", "http://some-node-url-1:7001")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when members api update fails", func() {
+			BeforeEach(func() {
+				etcdServer.SetUpdateMemberReturn(http.StatusConflict)
+			})
+
+			It("returns an error", func() {
+				err := etcdClient.MemberUpdate(context.Background(), "member-id", "http://some-node-url-1:7001")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("EndpointStatus", func() {
+		BeforeEach(func() {
+			etcdServer.SetKeysReturn(http.StatusOK)
+
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the version, cluster id and raft position of the endpoint", func() {
+			status, err := etcdClient.EndpointStatus(context.Background(), etcdServer.URL())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(status).To(Equal(client.EndpointStatus{
+				ClusterID:   "cdf818194e3a8c32",
+				EtcdVersion: "2.3.8",
+				RaftIndex:   1234,
+				RaftTerm:    5,
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the version cannot be retrieved", func() {
+				etcdServer.SetVersionReturn("", http.StatusInternalServerError)
+
+				_, err := etcdClient.EndpointStatus(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 500 from %s/version", etcdServer.URL())))
+			})
+
+			It("returns an error when the keys api fails", func() {
+				etcdServer.SetKeysReturn(http.StatusInternalServerError)
+
+				_, err := etcdClient.EndpointStatus(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 500 from %s/v2/keys", etcdServer.URL())))
+			})
+
+			It("returns an error when the raft index header is invalid", func() {
+				etcdServer.SetRaftStatus("some-cluster-id", "not-a-number", "5")
+
+				_, err := etcdClient.EndpointStatus(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(ContainSubstring("invalid X-Raft-Index header")))
+			})
+
+			It("returns an error when the raft term header is invalid", func() {
+				etcdServer.SetRaftStatus("some-cluster-id", "1234", "")
+
+				_, err := etcdClient.EndpointStatus(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(ContainSubstring("invalid X-Raft-Term header")))
+			})
+		})
+	})
+
+	Describe("EndpointHealth", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("reports a healthy endpoint", func() {
+			healthy, err := etcdClient.EndpointHealth(context.Background(), etcdServer.URL())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(healthy).To(BeTrue())
+		})
+
+		Context("when the endpoint reports that it is unhealthy", func() {
+			BeforeEach(func() {
+				etcdServer.SetHealthReturn(`{"health": "false"}`, http.StatusOK)
+			})
+
+			It("reports an unhealthy endpoint", func() {
+				healthy, err := etcdClient.EndpointHealth(context.Background(), etcdServer.URL())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(healthy).To(BeFalse())
+			})
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the endpoint returns an unexpected status code", func() {
+				etcdServer.SetHealthReturn("", http.StatusServiceUnavailable)
+
+				_, err := etcdClient.EndpointHealth(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 503 from %s/health", etcdServer.URL())))
+			})
+
+			It("returns an error when the response is not valid json", func() {
+				etcdServer.SetHealthReturn("%%%", http.StatusOK)
+
+				_, err := etcdClient.EndpointHealth(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(ContainSubstring("invalid character")))
+			})
+
+			It("returns an error when the endpoint cannot be reached", func() {
+				_, err := etcdClient.EndpointHealth(context.Background(), "http://127.0.0.1:1")
+				Expect(err).To(HaveOccurred())
+			})
+
+			It("returns an error when the context is cancelled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := etcdClient.EndpointHealth(ctx, etcdServer.URL())
+				Expect(err).To(MatchError(ContainSubstring("context canceled")))
+			})
+		})
+	})
+
+	Describe("EndpointLeader", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the leader the endpoint follows", func() {
+			leader, err := etcdClient.EndpointLeader(context.Background(), etcdServer.URL())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(leader).To(Equal("some-leader-id"))
+		})
+
+		Context("when the endpoint knows of no leader", func() {
+			BeforeEach(func() {
+				etcdServer.SetSelfStatsReturn(`{"id": "some-id", "leaderInfo": {}}`, http.StatusOK)
+			})
+
+			It("returns an empty leader", func() {
+				leader, err := etcdClient.EndpointLeader(context.Background(), etcdServer.URL())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(leader).To(BeEmpty())
+			})
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the endpoint returns an unexpected status code", func() {
+				etcdServer.SetSelfStatsReturn("", http.StatusServiceUnavailable)
+
+				_, err := etcdClient.EndpointLeader(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 503 from %s/v2/stats/self", etcdServer.URL())))
+			})
+		})
+	})
+
+	Describe("Health", func() {
+		BeforeEach(func() {
+			cfg.EtcdClientEndpointsCall.Returns.Endpoints = []string{"http://127.0.0.1:1", etcdServer.URL()}
+
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the health of the first endpoint that answers", func() {
+			healthy, err := etcdClient.Health(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(healthy).To(BeTrue())
+		})
+
+		It("asks the client urls of the members once the endpoints are synced", func() {
+			cfg.EtcdClientEndpointsCall.Returns.Endpoints = []string{etcdServer.URL()}
+			Expect(etcdClient.Configure(cfg)).To(Succeed())
+
+			etcdServer.SetMembersReturn(`{
+				"members": [
+					{"id": "some-id-1", "name": "some-node-1", "clientURLs": ["http://localhost:4001"]}
+				]
+			}`, http.StatusOK)
+			_, err := etcdClient.MemberList(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+
+			etcdServer.SetHealthReturn("", http.StatusServiceUnavailable)
+
+			_, err = etcdClient.Health(context.Background())
+			Expect(err).To(MatchError("unexpected status code 503 from http://localhost:4001/health"))
+		})
+
+		Context("failure cases", func() {
+			It("returns the last error when no endpoint answers", func() {
+				etcdServer.SetHealthReturn("", http.StatusServiceUnavailable)
+
+				_, err := etcdClient.Health(context.Background())
+				Expect(err).To(Or(
+					MatchError(fmt.Sprintf("unexpected status code 503 from %s/health", etcdServer.URL())),
+					MatchError(ContainSubstring("connection refused")),
+				))
+			})
+		})
+	})
+
+	Describe("Version", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the server and cluster versions", func() {
+			version, err := etcdClient.Version(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(version).To(Equal(client.Version{
+				EtcdServer:  "2.3.8",
+				EtcdCluster: "2.3.0",
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the endpoint returns an unexpected status code", func() {
+				etcdServer.SetVersionReturn("", http.StatusServiceUnavailable)
+
+				_, err := etcdClient.EndpointVersion(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 503 from %s/version", etcdServer.URL())))
+			})
+		})
+	})
+
+	Describe("SelfStats", func() {
+		BeforeEach(func() {
+			etcdServer.SetSelfStatsReturn(`{
+				"name": "some-node-1",
+				"id": "some-id",
+				"state": "StateFollower",
+				"leaderInfo": {"leader": "some-leader-id", "uptime": "1m0s"},
+				"recvAppendRequestCnt": 12,
+				"sendAppendRequestCnt": 3
+			}`, http.StatusOK)
+
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the stats of the endpoint", func() {
+			stats, err := etcdClient.SelfStats(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats).To(Equal(client.SelfStats{
+				Name:  "some-node-1",
+				ID:    "some-id",
+				State: "StateFollower",
+				LeaderInfo: client.LeaderInfo{
+					Leader: "some-leader-id",
+					Uptime: "1m0s",
+				},
+				RecvAppendRequestCnt: 12,
+				SendAppendRequestCnt: 3,
+			}))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the endpoint returns an unexpected status code", func() {
+				etcdServer.SetSelfStatsReturn("", http.StatusServiceUnavailable)
+
+				_, err := etcdClient.EndpointSelfStats(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 503 from %s/v2/stats/self", etcdServer.URL())))
+			})
+		})
+	})
+
+	Describe("LeaderStats", func() {
+		BeforeEach(func() {
+			etcdServer.SetLeaderReturn(fmt.Sprintf(`{
+				"id": "some-leader-id",
+				"name": "some-node-1",
+				"peerURLs": ["http://some-node-url:7001"],
+				"clientURLs": ["%s"]
+			}`, etcdServer.URL()), http.StatusOK)
+
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("asks the leader for its follower stats", func() {
+			stats, err := etcdClient.LeaderStats(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Leader).To(Equal("some-leader-id"))
+			Expect(stats.Followers).To(HaveLen(1))
+			Expect(stats.Followers["some-follower-id"].Latency.Current).To(Equal(0.5))
+			Expect(stats.Followers["some-follower-id"].Counts.Fail).To(Equal(uint64(1)))
+			Expect(stats.Followers["some-follower-id"].Counts.Success).To(Equal(uint64(42)))
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the leader has no client urls", func() {
+				etcdServer.SetLeaderReturn(`{"id": "some-leader-id", "name": "some-node-1", "clientURLs": []}`, http.StatusOK)
+
+				_, err := etcdClient.LeaderStats(context.Background())
+				Expect(err).To(MatchError("leader some-node-1 has no client urls"))
+			})
+
+			It("returns an error when the endpoint is not the leader", func() {
+				etcdServer.SetLeaderStatsReturn(`{"message": "not current leader"}`, http.StatusForbidden)
+
+				_, err := etcdClient.EndpointLeaderStats(context.Background(), etcdServer.URL())
+				Expect(err).To(MatchError(fmt.Sprintf("unexpected status code 403 from %s/v2/stats/leader", etcdServer.URL())))
 			})
 		})
 	})
@@ -347,8 +809,57 @@ var _ = Describe("EtcdClient", func() {
 			})
 
 			It("does not return an error", func() {
-				err := etcdClient.Keys()
+				err := etcdClient.Keys(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("keeps the configured endpoints when the members cannot be listed", func() {
+				etcdServer.SetMembersReturn("", http.StatusInternalServerError)
+
+				err := etcdClient.Keys(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				messages := logger.Messages()
+				Expect(messages).To(HaveLen(3))
+				Expect(messages[1].Action).To(Equal("etcd-client.keys"))
+				Expect(messages[2].Action).To(Equal("etcd-client.sync-endpoints.failed"))
+				Expect(messages[2].Error).To(HaveOccurred())
+
+				err = etcdClient.Keys(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(logger.Messages()[3]).To(Equal(fakes.LoggerMessage{
+					Action: "etcd-client.keys",
+					Data: []lager.Data{
+						{
+							"endpoint": etcdServer.URL(),
+						},
+					},
+				}))
+			})
+
+			It("syncs the endpoints on a later call once the members can be listed", func() {
+				etcdServer.SetMembersReturn("", http.StatusInternalServerError)
+
+				err := etcdClient.Keys(context.Background())
 				Expect(err).NotTo(HaveOccurred())
+				Expect(logger.Messages()[2].Action).To(Equal("etcd-client.sync-endpoints.failed"))
+
+				etcdServer.SetMembersReturn(fmt.Sprintf(`{
+					"members": [
+						{"id": "some-id", "name": "some-node-1", "clientURLs": ["%s"]}
+					]
+				}`, etcdServer.URL()), http.StatusOK)
+
+				err = etcdClient.Keys(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(logger.Messages()[4]).To(Equal(fakes.LoggerMessage{
+					Action: "etcd-client.sync-endpoints",
+					Data: []lager.Data{
+						{
+							"endpoints": []string{etcdServer.URL()},
+						},
+					},
+				}))
 			})
 		})
 
@@ -358,9 +869,95 @@ var _ = Describe("EtcdClient", func() {
 			})
 
 			It("returns an error", func() {
-				err := etcdClient.Keys()
-				Expect(err).To(MatchError("client: etcd cluster is unavailable or misconfigured"))
+				err := etcdClient.Keys(context.Background())
+				Expect(err).To(MatchError(HavePrefix("client: etcd cluster is unavailable or misconfigured")))
 			})
 		})
 	})
+
+	Describe("KeyCreate", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("creates the key", func() {
+			created, err := etcdClient.KeyCreate(context.Background(), "/some/key", "some-value", time.Minute)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created).To(BeTrue())
+
+			value, ok := etcdServer.GetKey("/some/key")
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal("some-value"))
+		})
+
+		Context("when the key already exists", func() {
+			BeforeEach(func() {
+				etcdServer.SetKey("/some/key", "some-other-value")
+			})
+
+			It("leaves the key alone", func() {
+				created, err := etcdClient.KeyCreate(context.Background(), "/some/key", "some-value", time.Minute)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(created).To(BeFalse())
+
+				value, _ := etcdServer.GetKey("/some/key")
+				Expect(value).To(Equal("some-other-value"))
+			})
+		})
+	})
+
+	Describe("KeyGet", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns the value of the key", func() {
+			etcdServer.SetKey("/some/key", "some-value")
+
+			value, err := etcdClient.KeyGet(context.Background(), "/some/key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(Equal("some-value"))
+		})
+
+		It("returns an empty value when the key does not exist", func() {
+			value, err := etcdClient.KeyGet(context.Background(), "/some/key")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(value).To(BeEmpty())
+		})
+	})
+
+	Describe("KeyCompareAndDelete", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			etcdServer.SetKey("/some/key", "some-value")
+		})
+
+		It("deletes the key when it holds the value", func() {
+			deleted, err := etcdClient.KeyCompareAndDelete(context.Background(), "/some/key", "some-value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeTrue())
+
+			_, ok := etcdServer.GetKey("/some/key")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("keeps the key when it holds another value", func() {
+			deleted, err := etcdClient.KeyCompareAndDelete(context.Background(), "/some/key", "some-other-value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeFalse())
+
+			_, ok := etcdServer.GetKey("/some/key")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("does nothing when the key does not exist", func() {
+			deleted, err := etcdClient.KeyCompareAndDelete(context.Background(), "/some/other/key", "some-value")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(deleted).To(BeFalse())
+		})
+	})
 })
@@ -0,0 +1,506 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/pkg/transport"
+
+	etcdserverpb "github.com/coreos/etcd/etcdserver/etcdserverpb"
+)
+
+const v3RequestTimeout = time.Second
+
+var errLeaderStatsUnavailable = errors.New("leader stats are not served over the v3 api")
+
+// EtcdV3Client talks to etcd over the v3 gRPC API, so that etcdfab keeps
+// working on clusters that have the v2 API disabled. Member IDs are rendered
+// in hex, the way the v2 API reports them.
+type EtcdV3Client struct {
+	client       *clientv3.Client
+	clientConfig clientv3.Config
+	selfEndpoint string
+
+	// endpointsSynced is read and set by calls that can run concurrently, as
+	// when the admin endpoints are served next to a running member.
+	endpointsMutex  sync.Mutex
+	endpointsSynced bool
+
+	logger logger
+}
+
+func NewEtcdV3Client(logger logger) *EtcdV3Client {
+	return &EtcdV3Client{
+		logger: logger,
+	}
+}
+
+func (e *EtcdV3Client) Configure(etcdfabConfig Config) error {
+	endpoints := etcdfabConfig.EtcdClientEndpoints()
+	e.selfEndpoint = etcdfabConfig.EtcdClientSelfEndpoint()
+	e.logger.Info("etcd-v3-client.configure.config", lager.Data{
+		"endpoints":     endpoints,
+		"self-endpoint": e.selfEndpoint,
+	})
+
+	e.clientConfig = clientv3.Config{
+		Endpoints: endpoints,
+	}
+
+	if etcdfabConfig.RequireSSL() {
+		tlsInfo := transport.TLSInfo{
+			CAFile:         filepath.Join(etcdfabConfig.CertDir(), "server-ca.crt"),
+			CertFile:       filepath.Join(etcdfabConfig.CertDir(), "client.crt"),
+			KeyFile:        filepath.Join(etcdfabConfig.CertDir(), "client.key"),
+			ClientCertAuth: etcdfabConfig.RequireSSL(),
+		}
+
+		tlsConfig, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return err
+		}
+		e.clientConfig.TLS = tlsConfig
+	}
+
+	// A reconfigured client replaces the connection it had, which must not keep
+	// it from configuring.
+	if e.client != nil {
+		err := e.client.Close()
+		if err != nil {
+			e.logger.Error("etcd-v3-client.configure.close.failed", err)
+		}
+	}
+
+	e.endpointsMutex.Lock()
+	e.endpointsSynced = false
+	e.endpointsMutex.Unlock()
+
+	var err error
+	e.client, err = clientv3.New(e.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (e *EtcdV3Client) Self() (EtcdClientInterface, error) {
+	selfEtcdClient := &EtcdV3Client{
+		clientConfig:    e.clientConfig,
+		selfEndpoint:    e.selfEndpoint,
+		endpointsSynced: true,
+		logger:          e.logger,
+	}
+	selfEtcdClient.clientConfig.Endpoints = []string{e.selfEndpoint}
+
+	var err error
+	selfEtcdClient.client, err = clientv3.New(selfEtcdClient.clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return selfEtcdClient, nil
+}
+
+// Close closes the gRPC connection of the client, if it has been configured.
+// The client returned by Self has a connection of its own and has to be closed
+// separately.
+func (e *EtcdV3Client) Close() error {
+	if e.client == nil {
+		return nil
+	}
+
+	return e.client.Close()
+}
+
+func (e *EtcdV3Client) MemberList(ctx context.Context) ([]Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.MemberList(ctx)
+	if err != nil {
+		return []Member{}, err
+	}
+	e.served(ctx, "member-list", response.Header)
+
+	var members []Member
+	for _, m := range response.Members {
+		members = append(members, newV3Member(m))
+	}
+
+	return members, nil
+}
+
+func (e *EtcdV3Client) MemberAdd(ctx context.Context, peerURL string) (Member, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.MemberAdd(ctx, []string{peerURL})
+	if err != nil {
+		return Member{}, err
+	}
+	e.served(ctx, "member-add", response.Header)
+
+	return newV3Member(response.Member), nil
+}
+
+func (e *EtcdV3Client) MemberRemove(ctx context.Context, memberID string) error {
+	id, err := parseMemberID(memberID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.MemberRemove(ctx, id)
+	if err != nil {
+		return err
+	}
+	e.served(ctx, "member-remove", response.Header)
+
+	return nil
+}
+
+// Leader asks each member in turn which member it follows as leader, since
+// the v3 API has no single call for it.
+func (e *EtcdV3Client) Leader(ctx context.Context) (Member, error) {
+	members, err := e.MemberList(ctx)
+	if err != nil {
+		return Member{}, err
+	}
+
+	for _, m := range members {
+		for _, clientURL := range m.ClientURLs {
+			leaderID, err := e.EndpointLeader(ctx, clientURL)
+			if err != nil || leaderID == "" {
+				continue
+			}
+
+			for _, leader := range members {
+				if leader.ID == leaderID {
+					return leader, nil
+				}
+			}
+		}
+	}
+
+	return Member{}, errors.New("cluster has no leader")
+}
+
+func (e *EtcdV3Client) MemberUpdate(ctx context.Context, memberID, peerURL string) error {
+	id, err := parseMemberID(memberID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.MemberUpdate(ctx, id, []string{peerURL})
+	if err != nil {
+		return err
+	}
+	e.served(ctx, "member-update", response.Header)
+
+	return nil
+}
+
+func (e *EtcdV3Client) Keys(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Get(ctx, "/", clientv3.WithSerializable())
+	if err != nil {
+		return err
+	}
+	e.served(ctx, "keys", response.Header)
+
+	return nil
+}
+
+// KeyCreate sets key to value under a lease of the given TTL unless the key
+// already exists, in which case it returns false without an error.
+func (e *EtcdV3Client) KeyCreate(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	ttlInSeconds := int64(ttl / time.Second)
+	if ttlInSeconds < 1 {
+		ttlInSeconds = 1
+	}
+
+	lease, err := e.client.Grant(ctx, ttlInSeconds)
+	if err != nil {
+		return false, err
+	}
+
+	response, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		e.revoke(lease.ID)
+		return false, err
+	}
+	e.served(ctx, "key-create", response.Header)
+
+	if !response.Succeeded {
+		e.revoke(lease.ID)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// revoke gives back a lease no key was put under. It gets a request timeout
+// of its own, as the call that granted the lease may have failed because its
+// context ran out.
+func (e *EtcdV3Client) revoke(leaseID clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), v3RequestTimeout)
+	defer cancel()
+
+	_, err := e.client.Revoke(ctx, leaseID)
+	if err != nil {
+		e.logger.Error("etcd-v3-client.revoke.failed", err, lager.Data{
+			"lease-id": int64(leaseID),
+		})
+	}
+}
+
+// KeyGet returns the value of key, or an empty string when it does not exist.
+func (e *EtcdV3Client) KeyGet(ctx context.Context, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	e.served(ctx, "key-get", response.Header)
+
+	if len(response.Kvs) == 0 {
+		return "", nil
+	}
+
+	return string(response.Kvs[0].Value), nil
+}
+
+// KeyCompareAndDelete deletes key if it still holds value. It returns false
+// without an error when the key is gone or holds another value.
+func (e *EtcdV3Client) KeyCompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(key), "=", value)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	e.served(ctx, "key-compare-and-delete", response.Header)
+
+	return response.Succeeded, nil
+}
+
+// EndpointHealth reports an endpoint healthy when its own status names a
+// leader it follows, which it stops doing once it loses touch with a quorum. An
+// endpoint that cannot be reached at all is an error.
+func (e *EtcdV3Client) EndpointHealth(ctx context.Context, endpoint string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Status(ctx, endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	return response.Leader != 0, nil
+}
+
+// Health reports the health of the first member endpoint that answers.
+func (e *EtcdV3Client) Health(ctx context.Context) (bool, error) {
+	var healthy bool
+	err := e.eachEndpoint(func(endpoint string) error {
+		var err error
+		healthy, err = e.EndpointHealth(ctx, endpoint)
+		return err
+	})
+
+	return healthy, err
+}
+
+// Version reports the version of the first member endpoint that answers.
+func (e *EtcdV3Client) Version(ctx context.Context) (Version, error) {
+	var version Version
+	err := e.eachEndpoint(func(endpoint string) error {
+		var err error
+		version, err = e.EndpointVersion(ctx, endpoint)
+		return err
+	})
+
+	return version, err
+}
+
+// SelfStats reports the stats of the first member endpoint that answers.
+func (e *EtcdV3Client) SelfStats(ctx context.Context) (SelfStats, error) {
+	var stats SelfStats
+	err := e.eachEndpoint(func(endpoint string) error {
+		var err error
+		stats, err = e.EndpointSelfStats(ctx, endpoint)
+		return err
+	})
+
+	return stats, err
+}
+
+func (e *EtcdV3Client) LeaderStats(ctx context.Context) (LeaderStats, error) {
+	return LeaderStats{}, errLeaderStatsUnavailable
+}
+
+// EndpointVersion only knows the server version, since the v3 API does not
+// report the cluster version.
+func (e *EtcdV3Client) EndpointVersion(ctx context.Context, endpoint string) (Version, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Status(ctx, endpoint)
+	if err != nil {
+		return Version{}, err
+	}
+
+	return Version{
+		EtcdServer: response.Version,
+	}, nil
+}
+
+// EndpointSelfStats builds what it can from the status of the endpoint: its
+// ID, whether it leads and the leader it follows. The v3 API keeps no raft
+// traffic counters.
+func (e *EtcdV3Client) EndpointSelfStats(ctx context.Context, endpoint string) (SelfStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Status(ctx, endpoint)
+	if err != nil {
+		return SelfStats{}, err
+	}
+
+	stats := SelfStats{
+		ID:    formatMemberID(response.Header.MemberId),
+		State: "StateFollower",
+	}
+	if response.Leader != 0 {
+		stats.LeaderInfo.Leader = formatMemberID(response.Leader)
+	}
+	if response.Leader == response.Header.MemberId {
+		stats.State = "StateLeader"
+	}
+
+	return stats, nil
+}
+
+func (e *EtcdV3Client) EndpointLeaderStats(ctx context.Context, endpoint string) (LeaderStats, error) {
+	return LeaderStats{}, errLeaderStatsUnavailable
+}
+
+// EndpointLeader asks a single endpoint for the ID of the member it currently
+// follows as leader. It is empty while the endpoint knows of no leader.
+func (e *EtcdV3Client) EndpointLeader(ctx context.Context, endpoint string) (string, error) {
+	stats, err := e.EndpointSelfStats(ctx, endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	return stats.LeaderInfo.Leader, nil
+}
+
+func (e *EtcdV3Client) EndpointStatus(ctx context.Context, endpoint string) (EndpointStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, v3RequestTimeout)
+	defer cancel()
+
+	response, err := e.client.Status(ctx, endpoint)
+	if err != nil {
+		return EndpointStatus{}, err
+	}
+
+	return EndpointStatus{
+		ClusterID:   formatMemberID(response.Header.ClusterId),
+		EtcdVersion: response.Version,
+		RaftIndex:   response.RaftIndex,
+		RaftTerm:    response.RaftTerm,
+	}, nil
+}
+
+// served logs the member that answered a call, as the gRPC balancer does
+// not say which endpoint it used. The first call that gets through also swaps
+// the configured endpoints for the client URLs of the members.
+func (e *EtcdV3Client) served(ctx context.Context, action string, header *etcdserverpb.ResponseHeader) {
+	e.logger.Info(fmt.Sprintf("etcd-v3-client.%s", action), lager.Data{
+		"member-id": formatMemberID(header.MemberId),
+	})
+
+	e.endpointsMutex.Lock()
+	synced := e.endpointsSynced
+	e.endpointsSynced = true
+	e.endpointsMutex.Unlock()
+	if synced {
+		return
+	}
+
+	err := e.client.Sync(ctx)
+	if err != nil {
+		e.logger.Error("etcd-v3-client.sync-endpoints.failed", err)
+		return
+	}
+
+	e.logger.Info("etcd-v3-client.sync-endpoints", lager.Data{
+		"endpoints": e.client.Endpoints(),
+	})
+}
+
+// eachEndpoint calls f with the endpoints of the client in turn until one of
+// them answers, and returns the last error when none does. Once the endpoints
+// are synced these are the client URLs of the members rather than the
+// configured ones.
+func (e *EtcdV3Client) eachEndpoint(f func(string) error) error {
+	err := errors.New("no endpoints configured")
+	for _, endpoint := range e.client.Endpoints() {
+		err = f(endpoint)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func newV3Member(m *etcdserverpb.Member) Member {
+	return Member{
+		ID:         formatMemberID(m.ID),
+		Name:       m.Name,
+		PeerURLs:   m.PeerURLs,
+		ClientURLs: m.ClientURLs,
+	}
+}
+
+func formatMemberID(id uint64) string {
+	return strconv.FormatUint(id, 16)
+}
+
+func parseMemberID(memberID string) (uint64, error) {
+	id, err := strconv.ParseUint(memberID, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid member id %q", memberID)
+	}
+	return id, nil
+}
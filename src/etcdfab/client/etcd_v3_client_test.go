@@ -0,0 +1,482 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/coreos/etcd/embed"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("EtcdV3Client", func() {
+	var (
+		etcd    *embed.Etcd
+		dataDir string
+
+		clientURL string
+		peerURL   string
+		peerPort  int
+		memberID  string
+		clusterID string
+
+		etcdClient *client.EtcdV3Client
+
+		logger *fakes.Logger
+		cfg    *fakes.Config
+	)
+
+	BeforeEach(func() {
+		var err error
+		dataDir, err = ioutil.TempDir("", "etcd-v3-client")
+		Expect(err).NotTo(HaveOccurred())
+
+		clientURL = fmt.Sprintf("http://127.0.0.1:%d", freePort())
+		peerPort = freePort()
+		peerURL = fmt.Sprintf("http://127.0.0.1:%d", peerPort)
+
+		etcdConfig := embed.NewConfig()
+		etcdConfig.Name = "etcd-z1-0"
+		etcdConfig.Dir = dataDir
+		etcdConfig.LCUrls = []url.URL{mustParseURL(clientURL)}
+		etcdConfig.ACUrls = []url.URL{mustParseURL(clientURL)}
+		etcdConfig.LPUrls = []url.URL{mustParseURL(peerURL)}
+		etcdConfig.APUrls = []url.URL{mustParseURL(peerURL)}
+		etcdConfig.InitialCluster = fmt.Sprintf("etcd-z1-0=%s", peerURL)
+		etcdConfig.StrictReconfigCheck = false
+
+		etcd, err = embed.StartEtcd(etcdConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		select {
+		case <-etcd.Server.ReadyNotify():
+		case <-time.After(10 * time.Second):
+			Fail("embedded etcd did not become ready")
+		}
+
+		memberID = fmt.Sprintf("%x", uint64(etcd.Server.ID()))
+		clusterID = fmt.Sprintf("%x", uint64(etcd.Server.Cluster().ID()))
+
+		logger = &fakes.Logger{}
+		cfg = &fakes.Config{}
+		cfg.EtcdClientEndpointsCall.Returns.Endpoints = []string{clientURL}
+		cfg.EtcdClientSelfEndpointCall.Returns.Endpoint = clientURL
+
+		etcdClient = client.NewEtcdV3Client(logger)
+	})
+
+	AfterEach(func() {
+		Expect(etcdClient.Close()).To(Succeed())
+		etcd.Close()
+		Expect(os.RemoveAll(dataDir)).To(Succeed())
+	})
+
+	Describe("Configure", func() {
+		It("configures the etcd client with etcdfab config", func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.EtcdClientEndpointsCall.CallCount).To(Equal(1))
+			Expect(cfg.EtcdClientSelfEndpointCall.CallCount).To(Equal(1))
+			Expect(logger.Messages()).To(Equal([]fakes.LoggerMessage{
+				{
+					Action: "etcd-v3-client.configure.config",
+					Data: []lager.Data{
+						{
+							"endpoints":     []string{clientURL},
+							"self-endpoint": clientURL,
+						},
+					},
+				},
+			}))
+		})
+
+		Context("when etcdfabConfig.RequireSSL() is true", func() {
+			BeforeEach(func() {
+				cfg.RequireSSLCall.Returns.RequireSSL = true
+			})
+
+			It("loads the client certs from the cert dir", func() {
+				cfg.CertDirCall.Returns.CertDir = "../fixtures"
+
+				err := etcdClient.Configure(cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(cfg.CertDirCall.CallCount).To(Equal(3))
+			})
+
+			Context("when the certs cannot be loaded", func() {
+				It("returns an error", func() {
+					cfg.CertDirCall.Returns.CertDir = "some/missing/cert/dir"
+
+					err := etcdClient.Configure(cfg)
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when there are no endpoints", func() {
+			It("returns an error", func() {
+				cfg.EtcdClientEndpointsCall.Returns.Endpoints = []string{}
+
+				err := etcdClient.Configure(cfg)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when configured", func() {
+		BeforeEach(func() {
+			err := etcdClient.Configure(cfg)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Describe("Self", func() {
+			It("returns a client that talks to the self endpoint", func() {
+				cfg.EtcdClientEndpointsCall.Returns.Endpoints = []string{"http://127.0.0.1:1"}
+				err := etcdClient.Configure(cfg)
+				Expect(err).NotTo(HaveOccurred())
+
+				selfEtcdClient, err := etcdClient.Self()
+				Expect(err).NotTo(HaveOccurred())
+				defer selfEtcdClient.Close()
+
+				members, err := selfEtcdClient.MemberList(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(members).To(HaveLen(1))
+			})
+
+			It("returns a client with a connection of its own", func() {
+				selfEtcdClient, err := etcdClient.Self()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(selfEtcdClient.Close()).To(Succeed())
+
+				_, err = etcdClient.MemberList(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				_, err = selfEtcdClient.MemberList(context.Background())
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
+		Describe("Close", func() {
+			It("closes the connection of the client", func() {
+				Expect(etcdClient.Close()).To(Succeed())
+
+				_, err := etcdClient.MemberList(context.Background())
+				Expect(err).To(HaveOccurred())
+
+				Expect(etcdClient.Configure(cfg)).To(Succeed())
+			})
+		})
+
+		Describe("MemberList", func() {
+			It("returns the members with hex ids", func() {
+				members, err := etcdClient.MemberList(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(members).To(Equal([]client.Member{
+					{
+						ID:         memberID,
+						Name:       "etcd-z1-0",
+						PeerURLs:   []string{peerURL},
+						ClientURLs: []string{clientURL},
+					},
+				}))
+			})
+
+			It("logs the member that served the call and syncs the endpoints with the members", func() {
+				_, err := etcdClient.MemberList(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(logger.Messages()[1:]).To(Equal([]fakes.LoggerMessage{
+					{
+						Action: "etcd-v3-client.member-list",
+						Data: []lager.Data{
+							{
+								"member-id": memberID,
+							},
+						},
+					},
+					{
+						Action: "etcd-v3-client.sync-endpoints",
+						Data: []lager.Data{
+							{
+								"endpoints": []string{clientURL},
+							},
+						},
+					},
+				}))
+			})
+
+			It("syncs the endpoints only once when called concurrently", func() {
+				var wg sync.WaitGroup
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func() {
+						defer GinkgoRecover()
+						defer wg.Done()
+
+						_, err := etcdClient.MemberList(context.Background())
+						Expect(err).NotTo(HaveOccurred())
+					}()
+				}
+				wg.Wait()
+
+				var syncs int
+				for _, message := range logger.Messages() {
+					if message.Action == "etcd-v3-client.sync-endpoints" {
+						syncs++
+					}
+				}
+				Expect(syncs).To(Equal(1))
+			})
+
+			Context("when the context is cancelled", func() {
+				It("returns the context error", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+
+					_, err := etcdClient.MemberList(ctx)
+					Expect(err).To(MatchError(context.Canceled))
+				})
+			})
+		})
+
+		Describe("MemberAdd", func() {
+			It("adds an unstarted member", func() {
+				member, err := etcdClient.MemberAdd(context.Background(), "http://127.0.0.2:7001")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(member.ID).NotTo(BeEmpty())
+				Expect(member.Name).To(BeEmpty())
+				Expect(member.PeerURLs).To(Equal([]string{"http://127.0.0.2:7001"}))
+			})
+		})
+
+		Describe("MemberUpdate", func() {
+			It("updates the peer url of the member", func() {
+				updatedPeerURL := fmt.Sprintf("http://localhost:%d", peerPort)
+
+				err := etcdClient.MemberUpdate(context.Background(), memberID, updatedPeerURL)
+				Expect(err).NotTo(HaveOccurred())
+
+				members, err := etcdClient.MemberList(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(members[0].PeerURLs).To(Equal([]string{updatedPeerURL}))
+			})
+
+			Context("when the member id is not hex", func() {
+				It("returns an error", func() {
+					err := etcdClient.MemberUpdate(context.Background(), "some-member-id", peerURL)
+					Expect(err).To(MatchError(`invalid member id "some-member-id"`))
+				})
+			})
+		})
+
+		Describe("MemberRemove", func() {
+			Context("when the member does not exist", func() {
+				It("returns an error", func() {
+					err := etcdClient.MemberRemove(context.Background(), "abc123")
+					Expect(err).To(HaveOccurred())
+				})
+			})
+
+			Context("when the member id is not hex", func() {
+				It("returns an error", func() {
+					err := etcdClient.MemberRemove(context.Background(), "some-member-id")
+					Expect(err).To(MatchError(`invalid member id "some-member-id"`))
+				})
+			})
+		})
+
+		Describe("Leader", func() {
+			It("returns the leader", func() {
+				leader, err := etcdClient.Leader(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(leader.ID).To(Equal(memberID))
+				Expect(leader.Name).To(Equal("etcd-z1-0"))
+			})
+		})
+
+		Describe("Keys", func() {
+			It("reads from the keyspace", func() {
+				err := etcdClient.Keys(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Describe("KeyCreate", func() {
+			It("creates the key", func() {
+				created, err := etcdClient.KeyCreate(context.Background(), "some-key", "some-value", time.Minute)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(created).To(BeTrue())
+
+				value, err := etcdClient.KeyGet(context.Background(), "some-key")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(value).To(Equal("some-value"))
+			})
+
+			It("expires the key after the ttl", func() {
+				_, err := etcdClient.KeyCreate(context.Background(), "some-key", "some-value", time.Second)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(func() (string, error) {
+					return etcdClient.KeyGet(context.Background(), "some-key")
+				}, "5s", "100ms").Should(BeEmpty())
+			})
+
+			Context("when the key already exists", func() {
+				It("leaves the key alone and returns false", func() {
+					_, err := etcdClient.KeyCreate(context.Background(), "some-key", "some-value", time.Minute)
+					Expect(err).NotTo(HaveOccurred())
+
+					created, err := etcdClient.KeyCreate(context.Background(), "some-key", "other-value", time.Minute)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(created).To(BeFalse())
+
+					value, err := etcdClient.KeyGet(context.Background(), "some-key")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(value).To(Equal("some-value"))
+				})
+			})
+		})
+
+		Describe("KeyGet", func() {
+			Context("when the key does not exist", func() {
+				It("returns an empty value", func() {
+					value, err := etcdClient.KeyGet(context.Background(), "missing-key")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(value).To(BeEmpty())
+				})
+			})
+		})
+
+		Describe("KeyCompareAndDelete", func() {
+			BeforeEach(func() {
+				_, err := etcdClient.KeyCreate(context.Background(), "some-key", "some-value", time.Minute)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("deletes the key when it holds the value", func() {
+				deleted, err := etcdClient.KeyCompareAndDelete(context.Background(), "some-key", "some-value")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(deleted).To(BeTrue())
+
+				value, err := etcdClient.KeyGet(context.Background(), "some-key")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(value).To(BeEmpty())
+			})
+
+			Context("when the key holds another value", func() {
+				It("leaves the key alone and returns false", func() {
+					deleted, err := etcdClient.KeyCompareAndDelete(context.Background(), "some-key", "other-value")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(deleted).To(BeFalse())
+
+					value, err := etcdClient.KeyGet(context.Background(), "some-key")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(value).To(Equal("some-value"))
+				})
+			})
+
+			Context("when the key does not exist", func() {
+				It("returns false", func() {
+					deleted, err := etcdClient.KeyCompareAndDelete(context.Background(), "missing-key", "some-value")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(deleted).To(BeFalse())
+				})
+			})
+		})
+
+		Describe("EndpointHealth", func() {
+			It("reports the endpoint healthy", func() {
+				healthy, err := etcdClient.EndpointHealth(context.Background(), clientURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(healthy).To(BeTrue())
+			})
+
+			Context("when the endpoint cannot be reached", func() {
+				It("returns an error", func() {
+					_, err := etcdClient.EndpointHealth(context.Background(), "http://127.0.0.1:1")
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+
+		Describe("EndpointLeader", func() {
+			It("returns the id of the leader the endpoint follows", func() {
+				leaderID, err := etcdClient.EndpointLeader(context.Background(), clientURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(leaderID).To(Equal(memberID))
+			})
+		})
+
+		Describe("Version", func() {
+			It("returns the server version", func() {
+				version, err := etcdClient.Version(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version.EtcdServer).NotTo(BeEmpty())
+			})
+		})
+
+		Describe("SelfStats", func() {
+			It("returns the id, state and leader of the endpoint", func() {
+				stats, err := etcdClient.SelfStats(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stats.ID).To(Equal(memberID))
+				Expect(stats.State).To(Equal("StateLeader"))
+				Expect(stats.LeaderInfo.Leader).To(Equal(memberID))
+			})
+		})
+
+		Describe("LeaderStats", func() {
+			It("returns an error", func() {
+				_, err := etcdClient.LeaderStats(context.Background())
+				Expect(err).To(MatchError("leader stats are not served over the v3 api"))
+			})
+		})
+
+		Describe("EndpointStatus", func() {
+			It("returns the cluster id, version and raft position", func() {
+				status, err := etcdClient.EndpointStatus(context.Background(), clientURL)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(status.ClusterID).To(Equal(clusterID))
+				Expect(status.EtcdVersion).NotTo(BeEmpty())
+				Expect(status.RaftIndex).To(BeNumerically(">", 0))
+				Expect(status.RaftTerm).To(BeNumerically(">", 0))
+			})
+
+			Context("when the endpoint cannot be reached", func() {
+				It("returns an error", func() {
+					_, err := etcdClient.EndpointStatus(context.Background(), "http://127.0.0.1:1")
+					Expect(err).To(HaveOccurred())
+				})
+			})
+		})
+	})
+})
+
+func freePort() int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func mustParseURL(rawURL string) url.URL {
+	u, err := url.Parse(rawURL)
+	Expect(err).NotTo(HaveOccurred())
+
+	return *u
+}
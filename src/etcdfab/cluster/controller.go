@@ -1,14 +1,18 @@
 package cluster
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/backoff"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
 )
 
 type InitialClusterState struct {
@@ -19,12 +23,20 @@ type InitialClusterState struct {
 type Controller struct {
 	etcdClient etcdClient
 	logger     logger
+	metrics    *metrics.Registry
 	sleep      func(time.Duration)
 }
 
 type etcdClient interface {
-	MemberList() ([]client.Member, error)
-	MemberAdd(string) (client.Member, error)
+	MemberList(context.Context) ([]client.Member, error)
+	MemberAdd(context.Context, string) (client.Member, error)
+	MemberUpdate(context.Context, string, string) error
+	MemberRemove(context.Context, string) error
+	EndpointHealth(context.Context, string) (bool, error)
+	EndpointLeader(context.Context, string) (string, error)
+	KeyCreate(context.Context, string, string, time.Duration) (bool, error)
+	KeyGet(context.Context, string) (string, error)
+	KeyCompareAndDelete(context.Context, string, string) (bool, error)
 }
 
 type logger interface {
@@ -32,27 +44,38 @@ type logger interface {
 	Error(string, error, ...lager.Data)
 }
 
-func NewController(etcdClient etcdClient, logger logger, sleep func(time.Duration)) Controller {
+func NewController(etcdClient etcdClient, logger logger, registry *metrics.Registry, sleep func(time.Duration)) Controller {
 	return Controller{
 		etcdClient: etcdClient,
 		logger:     logger,
+		metrics:    registry,
 		sleep:      sleep,
 	}
 }
 
-func (c Controller) GetInitialClusterState(etcdfabConfig config.Config) (InitialClusterState, error) {
+func (c Controller) GetInitialClusterState(ctx context.Context, etcdfabConfig config.Config) (InitialClusterState, error) {
 	var priorMemberList []client.Member
-	for i := 0; i < 5; i++ {
+	policy := backoff.NewPolicy(etcdfabConfig.Etcd.MemberListBackoff)
+	policy.Retry(ctx, c.sleep, func(i int) error {
+		if i > 0 {
+			c.metrics.Inc(metrics.MemberListRetries, nil)
+		}
+
 		c.logger.Info("cluster.get-initial-cluster-state.member-list")
 		var err error
-		priorMemberList, err = c.etcdClient.MemberList()
+		priorMemberList, err = c.etcdClient.MemberList(ctx)
 		if err != nil {
 			c.logger.Error("cluster.get-initial-cluster-state.member-list.failed", err)
-			c.sleep(1 * time.Second)
-			continue
 		}
+		return err
+	})
 
-		break
+	// Without a member list this node would start a cluster of its own, which
+	// is only right when the members could not be listed for long enough, not
+	// when it was told to give up.
+	if ctx.Err() != nil {
+		c.logger.Error("cluster.get-initial-cluster-state.failed", ctx.Err())
+		return InitialClusterState{}, ctx.Err()
 	}
 
 	if len(priorMemberList) == 0 {
@@ -69,9 +92,32 @@ func (c Controller) GetInitialClusterState(etcdfabConfig config.Config) (Initial
 			"prior_members": priorMemberList,
 		})
 		initialCluster.State = "existing"
+
+		staleMember, err := findStaleMember(etcdfabConfig, priorMemberList)
+		if err != nil {
+			c.logger.Error("cluster.get-initial-cluster-state.member-update.failed", err)
+			return InitialClusterState{}, err
+		}
+
+		staleMemberKept := false
+		if staleMember.ID != "" {
+			staleMemberKept, err = c.replaceStaleMember(ctx, etcdfabConfig, staleMember)
+			if err != nil {
+				return InitialClusterState{}, err
+			}
+		}
+
 		for _, member := range priorMemberList {
-			members = append(members, fmt.Sprintf("%s=%s", member.Name, member.PeerURLs[0]))
-			if member.PeerURLs[0] == etcdfabConfig.AdvertisePeerURL() {
+			peerURL := firstPeerURL(member)
+			if member.ID != "" && member.ID == staleMember.ID {
+				if !staleMemberKept {
+					continue
+				}
+				peerURL = etcdfabConfig.AdvertisePeerURL()
+			}
+
+			members = append(members, fmt.Sprintf("%s=%s", member.Name, peerURL))
+			if peerURL == etcdfabConfig.AdvertisePeerURL() {
 				selfIsPartOfPriorMembers = true
 			}
 		}
@@ -79,11 +125,11 @@ func (c Controller) GetInitialClusterState(etcdfabConfig config.Config) (Initial
 
 	if !selfIsPartOfPriorMembers {
 		if len(priorMemberList) > 0 {
-			_, err := c.etcdClient.MemberAdd(etcdfabConfig.AdvertisePeerURL())
+			var err error
+			members, err = c.addSelf(ctx, etcdfabConfig)
 			if err != nil {
 				return InitialClusterState{}, err
 			}
-			c.sleep(2 * time.Second)
 		}
 		members = append(members, fmt.Sprintf("%s=%s", etcdfabConfig.NodeName(), etcdfabConfig.AdvertisePeerURL()))
 	}
@@ -95,3 +141,186 @@ func (c Controller) GetInitialClusterState(etcdfabConfig config.Config) (Initial
 	})
 	return initialCluster, nil
 }
+
+// addSelf adds this node to the cluster while holding the join lock. The
+// members are listed again once the lock is held, because a node that joined
+// while this one was waiting belongs in the initial cluster too. The lock is
+// released here when adding fails and by ReleaseJoinLock once etcd has synced
+// otherwise.
+func (c Controller) addSelf(ctx context.Context, etcdfabConfig config.Config) ([]string, error) {
+	err := c.acquireJoinLock(ctx, etcdfabConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := c.addSelfWithJoinLock(ctx, etcdfabConfig)
+	if err != nil {
+		// The lock is released even when ctx is done, so that the other nodes
+		// do not have to wait for it to expire.
+		c.ReleaseJoinLock(context.Background(), etcdfabConfig)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (c Controller) addSelfWithJoinLock(ctx context.Context, etcdfabConfig config.Config) ([]string, error) {
+	c.logger.Info("cluster.get-initial-cluster-state.join-lock.member-list")
+	memberList, err := c.etcdClient.MemberList(ctx)
+	if err != nil {
+		c.logger.Error("cluster.get-initial-cluster-state.join-lock.member-list.failed", err)
+		return nil, err
+	}
+
+	err = c.waitForJoinQuorum(ctx, etcdfabConfig, memberList)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = c.etcdClient.MemberAdd(ctx, etcdfabConfig.AdvertisePeerURL())
+	if err != nil {
+		c.metrics.Inc(metrics.MemberAdds, metrics.Failure)
+		return nil, err
+	}
+	c.metrics.Inc(metrics.MemberAdds, metrics.Success)
+	c.sleep(time.Duration(etcdfabConfig.Etcd.MemberAddSettleDelay) * time.Millisecond)
+
+	var members []string
+	for _, member := range memberList {
+		members = append(members, fmt.Sprintf("%s=%s", member.Name, firstPeerURL(member)))
+	}
+
+	return members, nil
+}
+
+// waitForJoinQuorum refuses to add this node while the existing members could
+// not commit with it added. With the "wait" policy it probes the members again
+// every second until the configured timeout before giving up.
+func (c Controller) waitForJoinQuorum(ctx context.Context, etcdfabConfig config.Config, memberList []client.Member) error {
+	policy := etcdfabConfig.Etcd.MemberAddQuorumPolicy
+	timeout := time.Duration(etcdfabConfig.Etcd.MemberAddQuorumWaitTimeout) * time.Second
+
+	for waited := time.Duration(0); ; waited += time.Second {
+		joinQuorum := c.getJoinQuorum(ctx, memberList)
+		c.logger.Info("cluster.get-initial-cluster-state.join-quorum", lager.Data{
+			"join_quorum": joinQuorum,
+		})
+		if joinQuorum.Safe() {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			c.logger.Error("cluster.get-initial-cluster-state.join-quorum.failed", ctx.Err())
+			return ctx.Err()
+		}
+
+		if policy != "wait" || waited >= timeout {
+			err := fmt.Errorf("adding this member would leave the cluster without quorum: %d of %d members are healthy and follow the same leader, %d are needed",
+				joinQuorum.HealthyMembers, len(memberList), joinQuorum.Quorum)
+			c.logger.Error("cluster.get-initial-cluster-state.join-quorum.refused", err, lager.Data{
+				"policy": policy,
+				"waited": waited.String(),
+			})
+			return err
+		}
+
+		c.logger.Info("cluster.get-initial-cluster-state.join-quorum.waiting", lager.Data{
+			"waited":  waited.String(),
+			"timeout": timeout.String(),
+		})
+		c.sleep(time.Second)
+	}
+}
+
+// replaceStaleMember points the stale member at the peer URL of this node when
+// the data dir still holds the WAL and snapshots of that member. etcd cannot
+// rejoin under the ID of a member without them, for example after the
+// persistent disk was replaced, so the member is removed instead and this node
+// is added again like any new member. It reports whether the member was kept.
+func (c Controller) replaceStaleMember(ctx context.Context, etcdfabConfig config.Config, member client.Member) (bool, error) {
+	_, err := os.Stat(etcdfabConfig.MemberDir())
+	if err != nil && !os.IsNotExist(err) {
+		c.logger.Error("cluster.get-initial-cluster-state.member-update.failed", err)
+		return false, err
+	}
+
+	if os.IsNotExist(err) {
+		c.logger.Info("cluster.get-initial-cluster-state.member-remove", lager.Data{
+			"member-id": member.ID,
+			"name":      member.Name,
+			"peer-urls": member.PeerURLs,
+			"data-dir":  etcdfabConfig.Etcd.DataDir,
+		})
+		err = c.etcdClient.MemberRemove(ctx, member.ID)
+		if err != nil {
+			c.metrics.Inc(metrics.MemberRemoves, metrics.Failure)
+			c.logger.Error("cluster.get-initial-cluster-state.member-remove.failed", err)
+			return false, err
+		}
+		c.metrics.Inc(metrics.MemberRemoves, metrics.Success)
+
+		return false, nil
+	}
+
+	c.logger.Info("cluster.get-initial-cluster-state.member-update", lager.Data{
+		"member-id": member.ID,
+		"name":      member.Name,
+		"peer-urls": member.PeerURLs,
+		"peer-url":  etcdfabConfig.AdvertisePeerURL(),
+	})
+	err = c.etcdClient.MemberUpdate(ctx, member.ID, etcdfabConfig.AdvertisePeerURL())
+	if err != nil {
+		c.logger.Error("cluster.get-initial-cluster-state.member-update.failed", err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// findStaleMember returns the member registered under the name of this node
+// with a different peer URL, which is what is left behind when a VM comes
+// back with a new IP or DNS name. Updating it is only safe when it is the
+// only member with that name and no other member already uses the peer URL of
+// this node.
+func findStaleMember(etcdfabConfig config.Config, members []client.Member) (client.Member, error) {
+	var named []client.Member
+	var urlOwner client.Member
+	urlOwned := false
+	for _, member := range members {
+		if member.Name == etcdfabConfig.NodeName() {
+			named = append(named, member)
+		}
+
+		if firstPeerURL(member) == etcdfabConfig.AdvertisePeerURL() {
+			urlOwner = member
+			urlOwned = true
+		}
+	}
+
+	if len(named) == 0 {
+		return client.Member{}, nil
+	}
+
+	if len(named) > 1 {
+		return client.Member{}, fmt.Errorf("found %d members named %s, refusing to update their peer urls", len(named), etcdfabConfig.NodeName())
+	}
+
+	member := named[0]
+	if firstPeerURL(member) == etcdfabConfig.AdvertisePeerURL() {
+		return client.Member{}, nil
+	}
+
+	if urlOwned {
+		return client.Member{}, fmt.Errorf("member %s already uses peer url %s, refusing to update member %s named %s",
+			urlOwner.ID, etcdfabConfig.AdvertisePeerURL(), member.ID, member.Name)
+	}
+
+	return member, nil
+}
+
+func firstPeerURL(member client.Member) string {
+	if len(member.PeerURLs) == 0 {
+		return ""
+	}
+	return member.PeerURLs[0]
+}
@@ -1,7 +1,11 @@
 package cluster_test
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"time"
 
 	"code.cloudfoundry.org/lager"
@@ -10,9 +14,11 @@ import (
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf-experimental/gomegamatchers"
 )
 
 var _ = Describe("Controller", func() {
@@ -20,6 +26,7 @@ var _ = Describe("Controller", func() {
 		var (
 			etcdClient *fakes.EtcdClient
 			logger     *fakes.Logger
+			registry   *metrics.Registry
 
 			sleep                 func(time.Duration)
 			sleepCallCount        int
@@ -31,12 +38,13 @@ var _ = Describe("Controller", func() {
 		BeforeEach(func() {
 			etcdClient = &fakes.EtcdClient{}
 			logger = &fakes.Logger{}
+			registry = metrics.NewRegistry()
 			sleep = func(duration time.Duration) {
 				sleepCallCount++
 				sleepReceivedDuration = duration
 			}
 
-			controller = cluster.NewController(etcdClient, logger, sleep)
+			controller = cluster.NewController(etcdClient, logger, registry, sleep)
 		})
 
 		AfterEach(func() {
@@ -45,12 +53,15 @@ var _ = Describe("Controller", func() {
 
 		Context("when no prior cluster members", func() {
 			It("returns state new and the itself as the member list", func() {
-				initialClusterState, err := controller.GetInitialClusterState(config.Config{
+				initialClusterState, err := controller.GetInitialClusterState(context.Background(), config.Config{
 					Node: config.Node{
 						Name:       "some_name",
 						Index:      0,
 						ExternalIP: "some-external-ip",
 					},
+					Etcd: config.Etcd{
+						PeerPort: 7001,
+					},
 				})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(initialClusterState.Members).To(Equal("some-name-0=http://some-external-ip:7001"))
@@ -80,16 +91,26 @@ var _ = Describe("Controller", func() {
 
 			It("retries finding cluster member five times", func() {
 				etcdClient.MemberListCall.Returns.Error = errors.New("failed to call member list")
-				_, err := controller.GetInitialClusterState(config.Config{
+				_, err := controller.GetInitialClusterState(context.Background(), config.Config{
 					Node: config.Node{
 						Name:       "some_name",
 						Index:      0,
 						ExternalIP: "some-external-ip",
 					},
+					Etcd: config.Etcd{
+						PeerPort: 7001,
+						MemberListBackoff: config.Backoff{
+							Initial:    1000,
+							Max:        1000,
+							Multiplier: 1,
+							Deadline:   5000,
+						},
+					},
 				})
 				Expect(err).NotTo(HaveOccurred())
 				Expect(etcdClient.MemberListCall.CallCount).To(Equal(5))
 				Expect(sleepCallCount).To(Equal(5))
+				Expect(registry.Value(metrics.MemberListRetries, nil)).To(Equal(4.0))
 				Expect(sleepReceivedDuration).To(Equal(1 * time.Second))
 				Expect(logger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
 					{
@@ -143,29 +164,73 @@ var _ = Describe("Controller", func() {
 					},
 				}))
 			})
+
+			It("does not start a new cluster when the context is done before the members could be listed", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				etcdClient.MemberListCall.Stub = func() ([]client.Member, error) {
+					cancel()
+					return nil, errors.New("failed to call member list")
+				}
+
+				_, err := controller.GetInitialClusterState(ctx, config.Config{
+					Node: config.Node{
+						Name:       "some_name",
+						Index:      0,
+						ExternalIP: "some-external-ip",
+					},
+					Etcd: config.Etcd{
+						PeerPort: 7001,
+						MemberListBackoff: config.Backoff{
+							Initial:    1000,
+							Max:        1000,
+							Multiplier: 1,
+							Deadline:   5000,
+						},
+					},
+				})
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(etcdClient.MemberListCall.CallCount).To(Equal(1))
+				Expect(sleepCallCount).To(Equal(0))
+			})
 		})
 
 		Context("when prior cluster members exist", func() {
 			BeforeEach(func() {
 				etcdClient.MemberListCall.Returns.MemberList = []client.Member{
 					{
-						Name:     "some-prior-node",
-						PeerURLs: []string{"http://some-peer-url:7001"},
+						ID:         "some-prior-id",
+						Name:       "some-prior-node",
+						PeerURLs:   []string{"http://some-peer-url:7001"},
+						ClientURLs: []string{"http://some-client-url:4001"},
 					},
 				}
+				etcdClient.EndpointHealthCall.Returns.Healthy = true
+				etcdClient.EndpointLeaderCall.Returns.Leader = "some-prior-id"
+				etcdClient.KeyCreateCall.Returns.Created = true
 			})
 
 			It("returns state existing and all prior members plus itself as the member list", func() {
-				initialClusterState, err := controller.GetInitialClusterState(config.Config{
+				initialClusterState, err := controller.GetInitialClusterState(context.Background(), config.Config{
 					Node: config.Node{
 						Name:       "some_name",
 						Index:      0,
 						ExternalIP: "some-external-ip",
 					},
+					Etcd: config.Etcd{
+						PeerPort:             7001,
+						JoinLockTTL:          300,
+						MemberAddSettleDelay: 2000,
+					},
 				})
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(etcdClient.MemberListCall.CallCount).To(Equal(1))
+				Expect(etcdClient.KeyCreateCall.CallCount).To(Equal(1))
+				Expect(etcdClient.KeyCreateCall.Receives.Key).To(Equal("/etcdfab/join-lock"))
+				Expect(etcdClient.KeyCreateCall.Receives.Value).To(Equal("some-name-0"))
+				Expect(etcdClient.KeyCreateCall.Receives.TTL).To(Equal(300 * time.Second))
+				Expect(etcdClient.KeyCompareAndDeleteCall.CallCount).To(Equal(0))
+
+				Expect(etcdClient.MemberListCall.CallCount).To(Equal(2))
 				Expect(etcdClient.MemberAddCall.CallCount).To(Equal(1))
 				Expect(etcdClient.MemberAddCall.Receives.PeerURL).To(Equal("http://some-external-ip:7001"))
 				Expect(sleepCallCount).To(Equal(1))
@@ -183,9 +248,48 @@ var _ = Describe("Controller", func() {
 							{
 								"prior_members": []client.Member{
 									{
-										Name:     "some-prior-node",
-										PeerURLs: []string{"http://some-peer-url:7001"},
+										ID:         "some-prior-id",
+										Name:       "some-prior-node",
+										PeerURLs:   []string{"http://some-peer-url:7001"},
+										ClientURLs: []string{"http://some-client-url:4001"},
+									},
+								},
+							},
+						},
+					},
+					{
+						Action: "cluster.join-lock.acquire",
+						Data: []lager.Data{
+							{
+								"key":    "/etcdfab/join-lock",
+								"holder": "some-name-0",
+								"ttl":    "5m0s",
+							},
+						},
+					},
+					{
+						Action: "cluster.join-lock.acquired",
+						Data: []lager.Data{
+							{
+								"holder": "some-name-0",
+								"waited": "0s",
+							},
+						},
+					},
+					{
+						Action: "cluster.get-initial-cluster-state.join-lock.member-list",
+					},
+					{
+						Action: "cluster.get-initial-cluster-state.join-quorum",
+						Data: []lager.Data{
+							{
+								"join_quorum": cluster.JoinQuorum{
+									Members: []cluster.MemberHealth{
+										{ID: "some-prior-id", Name: "some-prior-node", Healthy: true, Leader: "some-prior-id"},
 									},
+									Leader:         "some-prior-id",
+									HealthyMembers: 1,
+									Quorum:         2,
 								},
 							},
 						},
@@ -202,6 +306,7 @@ var _ = Describe("Controller", func() {
 						},
 					},
 				}))
+				Expect(registry.Value(metrics.MemberAdds, metrics.Success)).To(Equal(1.0))
 			})
 
 			Context("when MemberAdd fails", func() {
@@ -210,14 +315,296 @@ var _ = Describe("Controller", func() {
 				})
 
 				It("returns the error and logs a helpful message", func() {
-					_, err := controller.GetInitialClusterState(config.Config{
+					_, err := controller.GetInitialClusterState(context.Background(), config.Config{
 						Node: config.Node{
 							Name:       "some_name",
 							Index:      0,
 							ExternalIP: "some-external-ip",
 						},
+						Etcd: config.Etcd{
+							PeerPort: 7001,
+						},
 					})
 					Expect(err).To(MatchError("failed to call member add"))
+					Expect(registry.Value(metrics.MemberAdds, metrics.Failure)).To(Equal(1.0))
+				})
+			})
+
+			Context("when the existing members could not commit with this node added", func() {
+				var etcdfabConfig config.Config
+
+				BeforeEach(func() {
+					etcdClient.MemberListCall.Returns.MemberList = []client.Member{
+						{
+							ID:         "some-id-0",
+							Name:       "some-prior-node-0",
+							PeerURLs:   []string{"http://some-peer-url-0:7001"},
+							ClientURLs: []string{"http://some-client-url-0:4001"},
+						},
+						{
+							ID:         "some-id-1",
+							Name:       "some-prior-node-1",
+							PeerURLs:   []string{"http://some-peer-url-1:7001"},
+							ClientURLs: []string{"http://some-client-url-1:4001"},
+						},
+						{
+							ID:         "some-id-2",
+							Name:       "some-prior-node-2",
+							PeerURLs:   []string{"http://some-peer-url-2:7001"},
+							ClientURLs: []string{"http://some-client-url-2:4001"},
+						},
+					}
+					etcdClient.EndpointHealthCall.Stub = func(endpoint string) (bool, error) {
+						if endpoint == "http://some-client-url-2:4001" {
+							return false, errors.New("connection refused")
+						}
+						return true, nil
+					}
+					etcdClient.EndpointLeaderCall.Returns.Leader = "some-id-0"
+
+					etcdfabConfig = config.Config{
+						Node: config.Node{
+							Name:       "some_name",
+							Index:      0,
+							ExternalIP: "some-external-ip",
+						},
+						Etcd: config.Etcd{
+							PeerPort:              7001,
+							MemberAddQuorumPolicy: "refuse",
+						},
+					}
+				})
+
+				It("refuses to add this node and logs the health of every member", func() {
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).To(MatchError("adding this member would leave the cluster without quorum: 2 of 3 members are healthy and follow the same leader, 3 are needed"))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "cluster.get-initial-cluster-state.join-quorum",
+						Data: []lager.Data{{
+							"join_quorum": cluster.JoinQuorum{
+								Members: []cluster.MemberHealth{
+									{ID: "some-id-0", Name: "some-prior-node-0", Healthy: true, Leader: "some-id-0"},
+									{ID: "some-id-1", Name: "some-prior-node-1", Healthy: true, Leader: "some-id-0"},
+									{ID: "some-id-2", Name: "some-prior-node-2", Healthy: false},
+								},
+								Leader:         "some-id-0",
+								HealthyMembers: 2,
+								Quorum:         3,
+							},
+						}},
+					}))
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "cluster.get-initial-cluster-state.join-quorum.refused",
+						Error:  err,
+						Data: []lager.Data{{
+							"policy": "refuse",
+							"waited": "0s",
+						}},
+					}))
+				})
+
+				Context("when the healthy members follow different leaders", func() {
+					BeforeEach(func() {
+						etcdClient.EndpointHealthCall.Stub = nil
+						etcdClient.EndpointHealthCall.Returns.Healthy = true
+						etcdClient.EndpointLeaderCall.Stub = func(endpoint string) (string, error) {
+							switch endpoint {
+							case "http://some-client-url-0:4001":
+								return "some-id-0", nil
+							case "http://some-client-url-1:4001":
+								return "some-id-1", nil
+							default:
+								return "", nil
+							}
+						}
+					})
+
+					It("only counts the members that agree on a leader", func() {
+						_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+						Expect(err).To(MatchError("adding this member would leave the cluster without quorum: 1 of 3 members are healthy and follow the same leader, 3 are needed"))
+						Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+					})
+				})
+
+				Context("when the policy is to wait for quorum", func() {
+					BeforeEach(func() {
+						etcdfabConfig.Etcd.MemberAddQuorumPolicy = "wait"
+						etcdfabConfig.Etcd.MemberAddQuorumWaitTimeout = 3
+					})
+
+					It("adds this node once the existing members are healthy", func() {
+						healthChecks := 0
+						etcdClient.EndpointHealthCall.Stub = func(endpoint string) (bool, error) {
+							if endpoint == "http://some-client-url-2:4001" {
+								healthChecks++
+								return healthChecks > 1, nil
+							}
+							return true, nil
+						}
+
+						initialClusterState, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+						Expect(err).NotTo(HaveOccurred())
+						Expect(initialClusterState.State).To(Equal("existing"))
+						Expect(etcdClient.MemberAddCall.CallCount).To(Equal(1))
+
+						Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+							Action: "cluster.get-initial-cluster-state.join-quorum.waiting",
+							Data: []lager.Data{{
+								"waited":  "0s",
+								"timeout": "3s",
+							}},
+						}))
+					})
+
+					It("refuses to add this node when the timeout is reached", func() {
+						_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+						Expect(err).To(MatchError(ContainSubstring("adding this member would leave the cluster without quorum")))
+						Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+						Expect(sleepCallCount).To(Equal(3))
+						Expect(sleepReceivedDuration).To(Equal(time.Second))
+					})
+				})
+			})
+
+			Context("when another node holds the join lock", func() {
+				var etcdfabConfig config.Config
+
+				BeforeEach(func() {
+					etcdClient.KeyCreateCall.Stub = func(string, string, time.Duration) (bool, error) {
+						return etcdClient.KeyCreateCall.CallCount > 2, nil
+					}
+					etcdClient.KeyGetCall.Returns.Value = "some-other-node"
+
+					etcdfabConfig = config.Config{
+						Node: config.Node{
+							Name:       "some_name",
+							Index:      0,
+							ExternalIP: "some-external-ip",
+						},
+						Etcd: config.Etcd{
+							PeerPort:        7001,
+							JoinLockTimeout: 5,
+						},
+					}
+				})
+
+				It("waits for the lock before adding this node", func() {
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(etcdClient.KeyCreateCall.CallCount).To(Equal(3))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(1))
+
+					Expect(logger.Messages()).To(gomegamatchers.ContainSequence([]fakes.LoggerMessage{
+						{
+							Action: "cluster.join-lock.held",
+							Data: []lager.Data{{
+								"holder": "some-other-node",
+								"waited": "0s",
+							}},
+						},
+						{
+							Action: "cluster.join-lock.acquired",
+							Data: []lager.Data{{
+								"holder": "some-name-0",
+								"waited": "2s",
+							}},
+						},
+					}))
+				})
+
+				It("includes the members that joined while it was waiting", func() {
+					etcdClient.MemberListCall.Stub = func() ([]client.Member, error) {
+						members := []client.Member{
+							{
+								ID:         "some-prior-id",
+								Name:       "some-prior-node",
+								PeerURLs:   []string{"http://some-peer-url:7001"},
+								ClientURLs: []string{"http://some-client-url:4001"},
+							},
+						}
+						if etcdClient.MemberListCall.CallCount > 1 {
+							members = append(members, client.Member{
+								ID:         "some-other-id",
+								Name:       "some-other-node",
+								PeerURLs:   []string{"http://some-other-peer-url:7001"},
+								ClientURLs: []string{"http://some-other-client-url:4001"},
+							})
+						}
+						return members, nil
+					}
+
+					initialClusterState, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(initialClusterState.Members).To(Equal("some-prior-node=http://some-peer-url:7001,some-other-node=http://some-other-peer-url:7001,some-name-0=http://some-external-ip:7001"))
+				})
+
+				It("takes the lock over when it already holds it from an earlier start", func() {
+					etcdClient.KeyGetCall.Returns.Value = "some-name-0"
+
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(etcdClient.KeyCreateCall.CallCount).To(Equal(1))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(1))
+				})
+
+				It("gives up when the timeout is reached", func() {
+					etcdfabConfig.Etcd.JoinLockTimeout = 1
+
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).To(MatchError("timed out after 1s waiting for the join lock held by some-other-node"))
+
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+					Expect(etcdClient.KeyCompareAndDeleteCall.CallCount).To(Equal(0))
+				})
+
+				It("stops waiting when the context is done", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					etcdClient.KeyGetCall.Returns.Value = "some-other-node"
+					etcdClient.KeyCreateCall.Stub = func(string, string, time.Duration) (bool, error) {
+						cancel()
+						return false, nil
+					}
+
+					_, err := controller.GetInitialClusterState(ctx, etcdfabConfig)
+					Expect(err).To(MatchError(context.Canceled))
+
+					Expect(etcdClient.KeyCreateCall.CallCount).To(Equal(1))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+				})
+			})
+
+			Context("when adding this node fails while it holds the join lock", func() {
+				BeforeEach(func() {
+					etcdClient.MemberAddCall.Returns.Error = errors.New("failed to call member add")
+					etcdClient.KeyCompareAndDeleteCall.Returns.Deleted = true
+				})
+
+				It("releases the lock", func() {
+					_, err := controller.GetInitialClusterState(context.Background(), config.Config{
+						Node: config.Node{
+							Name:       "some_name",
+							Index:      0,
+							ExternalIP: "some-external-ip",
+						},
+						Etcd: config.Etcd{
+							PeerPort: 7001,
+						},
+					})
+					Expect(err).To(MatchError("failed to call member add"))
+
+					Expect(etcdClient.KeyCompareAndDeleteCall.CallCount).To(Equal(1))
+					Expect(etcdClient.KeyCompareAndDeleteCall.Receives.Key).To(Equal("/etcdfab/join-lock"))
+					Expect(etcdClient.KeyCompareAndDeleteCall.Receives.Value).To(Equal("some-name-0"))
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "cluster.join-lock.released",
+						Data: []lager.Data{{
+							"holder": "some-name-0",
+						}},
+					}))
 				})
 			})
 
@@ -236,12 +623,15 @@ var _ = Describe("Controller", func() {
 				})
 
 				It("returns state existing and all prior members as the member list", func() {
-					initialClusterState, err := controller.GetInitialClusterState(config.Config{
+					initialClusterState, err := controller.GetInitialClusterState(context.Background(), config.Config{
 						Node: config.Node{
 							Name:       "some_name",
 							Index:      0,
 							ExternalIP: "some-external-ip",
 						},
+						Etcd: config.Etcd{
+							PeerPort: 7001,
+						},
 					})
 					Expect(err).NotTo(HaveOccurred())
 
@@ -288,15 +678,207 @@ var _ = Describe("Controller", func() {
 			})
 		})
 
+		Context("when this node is registered with a stale peer url", func() {
+			var (
+				dataDir       string
+				etcdfabConfig config.Config
+			)
+
+			BeforeEach(func() {
+				var err error
+				dataDir, err = ioutil.TempDir("", "")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.Mkdir(filepath.Join(dataDir, "member"), os.ModePerm)).To(Succeed())
+
+				etcdClient.MemberListCall.Returns.MemberList = []client.Member{
+					{
+						ID:       "some-prior-id",
+						Name:     "some-prior-node",
+						PeerURLs: []string{"http://some-peer-url:7001"},
+					},
+					{
+						ID:       "some-id",
+						Name:     "some-name-0",
+						PeerURLs: []string{"http://some-old-external-ip:7001"},
+					},
+				}
+
+				etcdfabConfig = config.Config{
+					Node: config.Node{
+						Name:       "some_name",
+						Index:      0,
+						ExternalIP: "some-external-ip",
+					},
+					Etcd: config.Etcd{
+						DataDir:  dataDir,
+						PeerPort: 7001,
+					},
+				}
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(dataDir)).To(Succeed())
+			})
+
+			It("updates the peer url of the existing member instead of adding a new one", func() {
+				initialClusterState, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(etcdClient.MemberUpdateCall.CallCount).To(Equal(1))
+				Expect(etcdClient.MemberUpdateCall.Receives.MemberID).To(Equal("some-id"))
+				Expect(etcdClient.MemberUpdateCall.Receives.PeerURL).To(Equal("http://some-external-ip:7001"))
+				Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+
+				Expect(initialClusterState).To(Equal(cluster.InitialClusterState{
+					Members: "some-prior-node=http://some-peer-url:7001,some-name-0=http://some-external-ip:7001",
+					State:   "existing",
+				}))
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "cluster.get-initial-cluster-state.member-update",
+					Data: []lager.Data{{
+						"member-id": "some-id",
+						"name":      "some-name-0",
+						"peer-urls": []string{"http://some-old-external-ip:7001"},
+						"peer-url":  "http://some-external-ip:7001",
+					}},
+				}))
+			})
+
+			It("updates the peer url when only the peer port changed", func() {
+				etcdClient.MemberListCall.Returns.MemberList[1].PeerURLs = []string{"http://some-external-ip:7001"}
+				etcdfabConfig.Etcd.PeerPort = 2380
+
+				_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(etcdClient.MemberUpdateCall.Receives.PeerURL).To(Equal("http://some-external-ip:2380"))
+				Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+			})
+
+			Context("when the update fails", func() {
+				BeforeEach(func() {
+					etcdClient.MemberUpdateCall.Returns.Error = errors.New("failed to update member")
+				})
+
+				It("returns the error without adding a new member", func() {
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).To(MatchError("failed to update member"))
+
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "cluster.get-initial-cluster-state.member-update.failed",
+						Error:  errors.New("failed to update member"),
+					}))
+				})
+			})
+
+			Context("when the data dir holds no member data", func() {
+				BeforeEach(func() {
+					Expect(os.RemoveAll(filepath.Join(dataDir, "member"))).To(Succeed())
+
+					etcdClient.MemberListCall.Returns.MemberList[0].ClientURLs = []string{"http://some-client-url:4001"}
+					etcdClient.MemberListCall.Stub = func() ([]client.Member, error) {
+						if etcdClient.MemberRemoveCall.CallCount == 0 {
+							return etcdClient.MemberListCall.Returns.MemberList, nil
+						}
+						return etcdClient.MemberListCall.Returns.MemberList[:1], nil
+					}
+					etcdClient.EndpointHealthCall.Returns.Healthy = true
+					etcdClient.EndpointLeaderCall.Returns.Leader = "some-prior-id"
+					etcdClient.KeyCreateCall.Returns.Created = true
+				})
+
+				It("removes the existing member and adds this node as a new one", func() {
+					initialClusterState, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(etcdClient.MemberUpdateCall.CallCount).To(Equal(0))
+					Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(1))
+					Expect(etcdClient.MemberRemoveCall.Receives.MemberID).To(Equal("some-id"))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(1))
+					Expect(etcdClient.MemberAddCall.Receives.PeerURL).To(Equal("http://some-external-ip:7001"))
+
+					Expect(initialClusterState).To(Equal(cluster.InitialClusterState{
+						Members: "some-prior-node=http://some-peer-url:7001,some-name-0=http://some-external-ip:7001",
+						State:   "existing",
+					}))
+
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "cluster.get-initial-cluster-state.member-remove",
+						Data: []lager.Data{{
+							"member-id": "some-id",
+							"name":      "some-name-0",
+							"peer-urls": []string{"http://some-old-external-ip:7001"},
+							"data-dir":  dataDir,
+						}},
+					}))
+				})
+
+				Context("when the removal fails", func() {
+					BeforeEach(func() {
+						etcdClient.MemberRemoveCall.Returns.Error = errors.New("failed to remove member")
+					})
+
+					It("returns the error without adding a new member", func() {
+						_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+						Expect(err).To(MatchError("failed to remove member"))
+
+						Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+						Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+							Action: "cluster.get-initial-cluster-state.member-remove.failed",
+							Error:  errors.New("failed to remove member"),
+						}))
+					})
+				})
+			})
+
+			Context("when several members have the name of this node", func() {
+				BeforeEach(func() {
+					etcdClient.MemberListCall.Returns.MemberList = append(etcdClient.MemberListCall.Returns.MemberList, client.Member{
+						ID:       "some-other-id",
+						Name:     "some-name-0",
+						PeerURLs: []string{"http://some-older-external-ip:7001"},
+					})
+				})
+
+				It("refuses to update or add a member", func() {
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).To(MatchError("found 2 members named some-name-0, refusing to update their peer urls"))
+
+					Expect(etcdClient.MemberUpdateCall.CallCount).To(Equal(0))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+				})
+			})
+
+			Context("when another member already uses the peer url of this node", func() {
+				BeforeEach(func() {
+					etcdClient.MemberListCall.Returns.MemberList = append(etcdClient.MemberListCall.Returns.MemberList, client.Member{
+						ID:       "some-unstarted-id",
+						PeerURLs: []string{"http://some-external-ip:7001"},
+					})
+				})
+
+				It("refuses to update or add a member", func() {
+					_, err := controller.GetInitialClusterState(context.Background(), etcdfabConfig)
+					Expect(err).To(MatchError("member some-unstarted-id already uses peer url http://some-external-ip:7001, refusing to update member some-id named some-name-0"))
+
+					Expect(etcdClient.MemberUpdateCall.CallCount).To(Equal(0))
+					Expect(etcdClient.MemberAddCall.CallCount).To(Equal(0))
+				})
+			})
+		})
+
 		Context("when the cluster requires TLS", func() {
 			It("returns the initial list of members with the correct protcol and dns suffix for this node", func() {
-				initialClusterState, err := controller.GetInitialClusterState(config.Config{
+				initialClusterState, err := controller.GetInitialClusterState(context.Background(), config.Config{
 					Node: config.Node{
 						Name:       "some_name",
 						Index:      0,
 						ExternalIP: "some-external-ip",
 					},
 					Etcd: config.Etcd{
+						PeerPort:               7001,
 						PeerRequireSSL:         true,
 						RequireSSL:             true,
 						AdvertiseURLsDNSSuffix: "some-dns-suffix",
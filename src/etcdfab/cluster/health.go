@@ -0,0 +1,159 @@
+package cluster
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+type MemberHealth struct {
+	ID      string
+	Name    string
+	Healthy bool
+	Leader  string
+}
+
+// RemovalQuorum describes the cluster as it would look after this node
+// removes itself: how many voting members remain, how many of those are
+// healthy and how many are needed for quorum.
+type RemovalQuorum struct {
+	Members                 []MemberHealth
+	RemainingMembers        int
+	HealthyRemainingMembers int
+	Quorum                  int
+}
+
+func (r RemovalQuorum) Safe() bool {
+	return r.HealthyRemainingMembers >= r.Quorum
+}
+
+// JoinQuorum describes the cluster as it would look right after a new member
+// is added: the new member counts towards the quorum but cannot vote until it
+// has started and synced, so only the existing members that are healthy and
+// follow the same leader can commit.
+type JoinQuorum struct {
+	Members        []MemberHealth
+	Leader         string
+	HealthyMembers int
+	Quorum         int
+}
+
+// Safe also allows growing a fully healthy cluster of one, which always loses
+// quorum until the second member has started.
+func (j JoinQuorum) Safe() bool {
+	return j.HealthyMembers >= j.Quorum || (len(j.Members) == 1 && j.HealthyMembers == 1)
+}
+
+func QuorumSize(members int) int {
+	return members/2 + 1
+}
+
+func (c Controller) GetRemovalQuorum(ctx context.Context, etcdfabConfig config.Config) (RemovalQuorum, error) {
+	c.logger.Info("cluster.get-removal-quorum.member-list")
+	memberList, err := c.etcdClient.MemberList(ctx)
+	if err != nil {
+		c.logger.Error("cluster.get-removal-quorum.member-list.failed", err)
+		return RemovalQuorum{}, err
+	}
+
+	var removalQuorum RemovalQuorum
+	for _, member := range memberList {
+		memberHealth := MemberHealth{
+			ID:      member.ID,
+			Name:    member.Name,
+			Healthy: c.memberHealthy(ctx, member),
+		}
+		removalQuorum.Members = append(removalQuorum.Members, memberHealth)
+
+		if member.Name == etcdfabConfig.NodeName() {
+			continue
+		}
+
+		removalQuorum.RemainingMembers++
+		if memberHealth.Healthy {
+			removalQuorum.HealthyRemainingMembers++
+		}
+	}
+	removalQuorum.Quorum = QuorumSize(removalQuorum.RemainingMembers)
+
+	c.logger.Info("cluster.get-removal-quorum.return", lager.Data{
+		"removal_quorum": removalQuorum,
+	})
+	return removalQuorum, nil
+}
+
+func (c Controller) getJoinQuorum(ctx context.Context, memberList []client.Member) JoinQuorum {
+	memberIDs := map[string]bool{}
+	for _, member := range memberList {
+		memberIDs[member.ID] = true
+	}
+
+	var joinQuorum JoinQuorum
+	followers := map[string]int{}
+	for _, member := range memberList {
+		memberHealth := MemberHealth{
+			ID:      member.ID,
+			Name:    member.Name,
+			Healthy: c.memberHealthy(ctx, member),
+		}
+		if memberHealth.Healthy {
+			memberHealth.Leader = c.memberLeader(ctx, member)
+		}
+		joinQuorum.Members = append(joinQuorum.Members, memberHealth)
+
+		if memberHealth.Leader != "" && memberIDs[memberHealth.Leader] {
+			followers[memberHealth.Leader]++
+		}
+	}
+
+	for leader, count := range followers {
+		if count > joinQuorum.HealthyMembers || (count == joinQuorum.HealthyMembers && leader < joinQuorum.Leader) {
+			joinQuorum.Leader = leader
+			joinQuorum.HealthyMembers = count
+		}
+	}
+	joinQuorum.Quorum = QuorumSize(len(memberList) + 1)
+
+	return joinQuorum
+}
+
+// A member that has not started yet has no client URLs and so is never
+// counted as healthy.
+func (c Controller) memberHealthy(ctx context.Context, member client.Member) bool {
+	for _, clientURL := range member.ClientURLs {
+		healthy, err := c.etcdClient.EndpointHealth(ctx, clientURL)
+		if err != nil {
+			c.logger.Error("cluster.member-health.failed", err, lager.Data{
+				"member":   member.Name,
+				"endpoint": clientURL,
+			})
+			continue
+		}
+
+		if healthy {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c Controller) memberLeader(ctx context.Context, member client.Member) string {
+	for _, clientURL := range member.ClientURLs {
+		leader, err := c.etcdClient.EndpointLeader(ctx, clientURL)
+		if err != nil {
+			c.logger.Error("cluster.member-leader.failed", err, lager.Data{
+				"member":   member.Name,
+				"endpoint": clientURL,
+			})
+			continue
+		}
+
+		return leader
+	}
+
+	return ""
+}
@@ -0,0 +1,175 @@
+package cluster_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	Describe("QuorumSize", func() {
+		It("returns a strict majority of the members", func() {
+			Expect(cluster.QuorumSize(0)).To(Equal(1))
+			Expect(cluster.QuorumSize(1)).To(Equal(1))
+			Expect(cluster.QuorumSize(2)).To(Equal(2))
+			Expect(cluster.QuorumSize(3)).To(Equal(2))
+			Expect(cluster.QuorumSize(4)).To(Equal(3))
+			Expect(cluster.QuorumSize(5)).To(Equal(3))
+		})
+	})
+
+	Describe("GetRemovalQuorum", func() {
+		var (
+			etcdClient *fakes.EtcdClient
+			logger     *fakes.Logger
+
+			etcdfabConfig config.Config
+			controller    cluster.Controller
+		)
+
+		BeforeEach(func() {
+			etcdClient = &fakes.EtcdClient{}
+			logger = &fakes.Logger{}
+
+			etcdClient.MemberListCall.Returns.MemberList = []client.Member{
+				{
+					ID:         "some-id-0",
+					Name:       "some-name-0",
+					ClientURLs: []string{"http://some-ip-0:4001"},
+				},
+				{
+					ID:         "some-id-1",
+					Name:       "some-name-1",
+					ClientURLs: []string{"http://some-ip-1:4001"},
+				},
+				{
+					ID:         "some-id-2",
+					Name:       "some-name-2",
+					ClientURLs: []string{"http://some-ip-2:4001"},
+				},
+			}
+
+			etcdfabConfig = config.Config{
+				Node: config.Node{
+					Name:  "some_name",
+					Index: 0,
+				},
+			}
+
+			controller = cluster.NewController(etcdClient, logger, metrics.NewRegistry(), func(time.Duration) {})
+		})
+
+		It("checks the health of every member and counts the healthy remaining members", func() {
+			etcdClient.EndpointHealthCall.Returns.Healthy = true
+
+			removalQuorum, err := controller.GetRemovalQuorum(context.Background(), etcdfabConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removalQuorum).To(Equal(cluster.RemovalQuorum{
+				Members: []cluster.MemberHealth{
+					{ID: "some-id-0", Name: "some-name-0", Healthy: true},
+					{ID: "some-id-1", Name: "some-name-1", Healthy: true},
+					{ID: "some-id-2", Name: "some-name-2", Healthy: true},
+				},
+				RemainingMembers:        2,
+				HealthyRemainingMembers: 2,
+				Quorum:                  2,
+			}))
+			Expect(removalQuorum.Safe()).To(BeTrue())
+
+			Expect(etcdClient.EndpointHealthCall.Receives.Endpoints).To(Equal([]string{
+				"http://some-ip-0:4001",
+				"http://some-ip-1:4001",
+				"http://some-ip-2:4001",
+			}))
+
+			Expect(logger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
+				{
+					Action: "cluster.get-removal-quorum.member-list",
+				},
+				{
+					Action: "cluster.get-removal-quorum.return",
+					Data: []lager.Data{{
+						"removal_quorum": removalQuorum,
+					}},
+				},
+			}))
+		})
+
+		Context("when removing the member would lose quorum", func() {
+			BeforeEach(func() {
+				etcdClient.EndpointHealthCall.Stub = func(endpoint string) (bool, error) {
+					switch endpoint {
+					case "http://some-ip-1:4001":
+						return false, errors.New("connection refused")
+					case "http://some-ip-2:4001":
+						return false, nil
+					default:
+						return true, nil
+					}
+				}
+			})
+
+			It("reports that the removal is not safe and logs the failed health check", func() {
+				removalQuorum, err := controller.GetRemovalQuorum(context.Background(), etcdfabConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(removalQuorum.RemainingMembers).To(Equal(2))
+				Expect(removalQuorum.HealthyRemainingMembers).To(Equal(0))
+				Expect(removalQuorum.Quorum).To(Equal(2))
+				Expect(removalQuorum.Safe()).To(BeFalse())
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "cluster.member-health.failed",
+					Error:  errors.New("connection refused"),
+					Data: []lager.Data{{
+						"member":   "some-name-1",
+						"endpoint": "http://some-ip-1:4001",
+					}},
+				}))
+			})
+		})
+
+		Context("when a member has not started yet", func() {
+			BeforeEach(func() {
+				etcdClient.MemberListCall.Returns.MemberList[2].Name = ""
+				etcdClient.MemberListCall.Returns.MemberList[2].ClientURLs = nil
+				etcdClient.EndpointHealthCall.Returns.Healthy = true
+			})
+
+			It("counts it as an unhealthy voter", func() {
+				removalQuorum, err := controller.GetRemovalQuorum(context.Background(), etcdfabConfig)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(removalQuorum.RemainingMembers).To(Equal(2))
+				Expect(removalQuorum.HealthyRemainingMembers).To(Equal(1))
+				Expect(removalQuorum.Safe()).To(BeFalse())
+				Expect(etcdClient.EndpointHealthCall.CallCount).To(Equal(2))
+			})
+		})
+
+		Context("when member list fails", func() {
+			BeforeEach(func() {
+				etcdClient.MemberListCall.Returns.Error = errors.New("failed to list members")
+			})
+
+			It("returns the error and logs it", func() {
+				_, err := controller.GetRemovalQuorum(context.Background(), etcdfabConfig)
+				Expect(err).To(MatchError("failed to list members"))
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "cluster.get-removal-quorum.member-list.failed",
+					Error:  errors.New("failed to list members"),
+				}))
+			})
+		})
+	})
+})
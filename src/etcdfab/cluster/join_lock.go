@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+const joinLockKey = "/etcdfab/join-lock"
+
+// acquireJoinLock makes nodes joining the same cluster add themselves one at a
+// time, since etcd copes badly with more than one added member that has not
+// started yet. The lock is a key holding the name of the node that took it.
+// It expires after the configured TTL, so a node that crashes while holding
+// it does not keep others from joining for good.
+func (c Controller) acquireJoinLock(ctx context.Context, etcdfabConfig config.Config) error {
+	holder := etcdfabConfig.NodeName()
+	ttl := time.Duration(etcdfabConfig.Etcd.JoinLockTTL) * time.Second
+	timeout := time.Duration(etcdfabConfig.Etcd.JoinLockTimeout) * time.Second
+
+	c.logger.Info("cluster.join-lock.acquire", lager.Data{
+		"key":    joinLockKey,
+		"holder": holder,
+		"ttl":    ttl.String(),
+	})
+
+	var currentHolder string
+	for waited := time.Duration(0); ; waited += time.Second {
+		created, err := c.etcdClient.KeyCreate(ctx, joinLockKey, holder, ttl)
+		if err != nil {
+			c.logger.Error("cluster.join-lock.acquire.failed", err)
+		} else if created {
+			c.logger.Info("cluster.join-lock.acquired", lager.Data{
+				"holder": holder,
+				"waited": waited.String(),
+			})
+			return nil
+		} else {
+			lockHolder, err := c.etcdClient.KeyGet(ctx, joinLockKey)
+			if err != nil {
+				c.logger.Error("cluster.join-lock.acquire.failed", err)
+			} else if lockHolder == holder {
+				// This node took the lock on an earlier start that did not
+				// get as far as releasing it.
+				c.logger.Info("cluster.join-lock.acquired", lager.Data{
+					"holder": holder,
+					"waited": waited.String(),
+				})
+				return nil
+			} else if lockHolder != currentHolder {
+				currentHolder = lockHolder
+				c.logger.Info("cluster.join-lock.held", lager.Data{
+					"holder": currentHolder,
+					"waited": waited.String(),
+				})
+			}
+		}
+
+		if ctx.Err() != nil {
+			c.logger.Error("cluster.join-lock.acquire.failed", ctx.Err())
+			return ctx.Err()
+		}
+
+		if waited >= timeout {
+			err := fmt.Errorf("timed out after %s waiting for the join lock held by %s", waited, currentHolder)
+			c.logger.Error("cluster.join-lock.acquire.failed", err)
+			return err
+		}
+
+		c.sleep(time.Second)
+	}
+}
+
+// ReleaseJoinLock releases the join lock if this node holds it. Releasing is
+// best effort, the lock expires on its own otherwise.
+func (c Controller) ReleaseJoinLock(ctx context.Context, etcdfabConfig config.Config) {
+	released, err := c.etcdClient.KeyCompareAndDelete(ctx, joinLockKey, etcdfabConfig.NodeName())
+	if err != nil {
+		c.logger.Error("cluster.join-lock.release.failed", err)
+		return
+	}
+
+	if released {
+		c.logger.Info("cluster.join-lock.released", lager.Data{
+			"holder": etcdfabConfig.NodeName(),
+		})
+	}
+}
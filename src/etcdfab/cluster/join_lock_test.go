@@ -0,0 +1,78 @@
+package cluster_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReleaseJoinLock", func() {
+	var (
+		etcdClient *fakes.EtcdClient
+		logger     *fakes.Logger
+
+		etcdfabConfig config.Config
+		controller    cluster.Controller
+	)
+
+	BeforeEach(func() {
+		etcdClient = &fakes.EtcdClient{}
+		logger = &fakes.Logger{}
+
+		etcdfabConfig = config.Config{
+			Node: config.Node{
+				Name:  "some_name",
+				Index: 1,
+			},
+		}
+
+		controller = cluster.NewController(etcdClient, logger, metrics.NewRegistry(), func(time.Duration) {})
+	})
+
+	It("deletes the lock if this node holds it", func() {
+		etcdClient.KeyCompareAndDeleteCall.Returns.Deleted = true
+
+		controller.ReleaseJoinLock(context.Background(), etcdfabConfig)
+
+		Expect(etcdClient.KeyCompareAndDeleteCall.Receives.Key).To(Equal("/etcdfab/join-lock"))
+		Expect(etcdClient.KeyCompareAndDeleteCall.Receives.Value).To(Equal("some-name-1"))
+		Expect(logger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
+			{
+				Action: "cluster.join-lock.released",
+				Data: []lager.Data{{
+					"holder": "some-name-1",
+				}},
+			},
+		}))
+	})
+
+	It("does nothing when another node holds the lock", func() {
+		controller.ReleaseJoinLock(context.Background(), etcdfabConfig)
+
+		Expect(etcdClient.KeyCompareAndDeleteCall.CallCount).To(Equal(1))
+		Expect(logger.Messages()).To(BeEmpty())
+	})
+
+	It("logs when the lock cannot be released", func() {
+		etcdClient.KeyCompareAndDeleteCall.Returns.Error = errors.New("failed to delete key")
+
+		controller.ReleaseJoinLock(context.Background(), etcdfabConfig)
+
+		Expect(logger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
+			{
+				Action: "cluster.join-lock.release.failed",
+				Error:  errors.New("failed to delete key"),
+			},
+		}))
+	})
+})
@@ -0,0 +1,225 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+)
+
+type orphanState struct {
+	FirstSeen map[string]time.Time `json:"first_seen"`
+}
+
+// PruneOrphanedMembers removes members that are neither part of the expected
+// cluster nor reachable, which is what instances deleted without a clean
+// drain leave behind. A member is only removed once it has been an orphan for
+// the configured grace period, as recorded in the orphaned members file, and
+// only while the healthy members can commit the removal, which takes a quorum
+// of the membership before the removal. Members are removed one at a time and
+// the IDs of the removed members are returned.
+//
+// Members that have not started yet have no name and are never orphans. The
+// grace period is measured between calls: a member is first seen by the call
+// that finds it and removed by the first call after the grace period.
+func (c Controller) PruneOrphanedMembers(ctx context.Context, etcdfabConfig config.Config, now time.Time) ([]string, error) {
+	if len(etcdfabConfig.Etcd.Machines) == 0 {
+		err := errors.New("no machines configured, cannot tell which members are expected")
+		c.logger.Error("cluster.prune-orphaned-members.failed", err)
+		return nil, err
+	}
+
+	if etcdfabConfig.Etcd.PeerRequireSSL && len(etcdfabConfig.Etcd.NodeNames) == 0 {
+		err := errors.New("no node names configured, cannot tell which members registered under their instance name are expected")
+		c.logger.Error("cluster.prune-orphaned-members.failed", err)
+		return nil, err
+	}
+
+	state, err := readOrphanState(etcdfabConfig.OrphanedMembersFile())
+	if err != nil {
+		c.logger.Error("cluster.prune-orphaned-members.failed", err)
+		return nil, err
+	}
+
+	c.logger.Info("cluster.prune-orphaned-members.member-list")
+	memberList, err := c.etcdClient.MemberList(ctx)
+	if err != nil {
+		c.logger.Error("cluster.prune-orphaned-members.member-list.failed", err)
+		return nil, err
+	}
+
+	expected := expectedMembers(etcdfabConfig)
+
+	var orphans []client.Member
+	healthyMembers := 0
+	firstSeen := map[string]time.Time{}
+	for _, member := range memberList {
+		if c.memberHealthy(ctx, member) {
+			healthyMembers++
+			continue
+		}
+
+		if member.ID == "" || member.Name == "" || member.Name == etcdfabConfig.NodeName() || expected.includes(member) {
+			continue
+		}
+
+		seen, ok := state.FirstSeen[member.ID]
+		if !ok {
+			seen = now
+			c.logger.Info("cluster.prune-orphaned-members.orphan-found", lager.Data{
+				"member-id": member.ID,
+				"name":      member.Name,
+				"peer-urls": member.PeerURLs,
+			})
+		}
+		firstSeen[member.ID] = seen
+		orphans = append(orphans, member)
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return firstSeen[orphans[i].ID].Before(firstSeen[orphans[j].ID])
+	})
+
+	gracePeriod := time.Duration(etcdfabConfig.Etcd.OrphanedMemberGracePeriod) * time.Second
+	currentMembers := len(memberList)
+
+	var removed []string
+	for _, orphan := range orphans {
+		if now.Sub(firstSeen[orphan.ID]) < gracePeriod {
+			continue
+		}
+
+		quorum := QuorumSize(currentMembers)
+		if healthyMembers < quorum {
+			c.logger.Info("cluster.prune-orphaned-members.refused", lager.Data{
+				"member-id":       orphan.ID,
+				"name":            orphan.Name,
+				"healthy-members": healthyMembers,
+				"members":         currentMembers,
+				"quorum":          quorum,
+			})
+			break
+		}
+
+		c.logger.Info("cluster.prune-orphaned-members.member-remove", lager.Data{
+			"member-id":  orphan.ID,
+			"name":       orphan.Name,
+			"peer-urls":  orphan.PeerURLs,
+			"first-seen": firstSeen[orphan.ID].Format(time.RFC3339),
+		})
+		err = c.etcdClient.MemberRemove(ctx, orphan.ID)
+		if err != nil {
+			c.metrics.Inc(metrics.MemberRemoves, metrics.Failure)
+			c.logger.Error("cluster.prune-orphaned-members.member-remove.failed", err)
+			break
+		}
+		c.metrics.Inc(metrics.MemberRemoves, metrics.Success)
+
+		delete(firstSeen, orphan.ID)
+		removed = append(removed, orphan.ID)
+		currentMembers--
+	}
+
+	writeErr := writeOrphanState(etcdfabConfig.OrphanedMembersFile(), orphanState{FirstSeen: firstSeen})
+	if writeErr != nil {
+		c.logger.Error("cluster.prune-orphaned-members.failed", writeErr)
+		if err == nil {
+			err = writeErr
+		}
+	}
+
+	c.logger.Info("cluster.prune-orphaned-members.return", lager.Data{
+		"removed": removed,
+	})
+	return removed, err
+}
+
+type memberSet struct {
+	names map[string]bool
+	hosts map[string]bool
+}
+
+// expectedMembers lists the members the deployment is meant to have. Without
+// TLS peers register with the address of their machine, with TLS they register
+// under the name of their instance. The names come from the etcd link rather
+// than being derived from the number of machines, since instance indexes have
+// gaps once instances were deleted.
+func expectedMembers(etcdfabConfig config.Config) memberSet {
+	expected := memberSet{
+		names: map[string]bool{},
+		hosts: map[string]bool{},
+	}
+
+	for _, name := range etcdfabConfig.Etcd.NodeNames {
+		expected.names[name] = true
+	}
+
+	for _, machine := range etcdfabConfig.Etcd.Machines {
+		expected.hosts[machine] = true
+	}
+
+	return expected
+}
+
+func (s memberSet) includes(member client.Member) bool {
+	if s.names[member.Name] {
+		return true
+	}
+
+	for _, peerURL := range member.PeerURLs {
+		parsedURL, err := url.Parse(peerURL)
+		if err != nil {
+			continue
+		}
+
+		host, _, err := net.SplitHostPort(parsedURL.Host)
+		if err != nil {
+			host = parsedURL.Host
+		}
+
+		if s.hosts[host] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func readOrphanState(path string) (orphanState, error) {
+	stateJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return orphanState{}, nil
+		}
+		return orphanState{}, err
+	}
+
+	var state orphanState
+	err = json.Unmarshal(stateJSON, &state)
+	if err != nil {
+		return orphanState{}, fmt.Errorf("invalid orphaned members file %s: %s", path, err)
+	}
+
+	return state, nil
+}
+
+func writeOrphanState(path string, state orphanState) error {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, stateJSON, 0644)
+}
@@ -0,0 +1,369 @@
+package cluster_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PruneOrphanedMembers", func() {
+	var (
+		etcdClient *fakes.EtcdClient
+		logger     *fakes.Logger
+		registry   *metrics.Registry
+
+		runDir            string
+		orphanedStatePath string
+		now               time.Time
+
+		etcdfabConfig config.Config
+		controller    cluster.Controller
+	)
+
+	BeforeEach(func() {
+		var err error
+		runDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+		orphanedStatePath = filepath.Join(runDir, "orphaned-members.json")
+
+		now = time.Date(2017, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+		etcdClient = &fakes.EtcdClient{}
+		logger = &fakes.Logger{}
+
+		etcdClient.MemberListCall.Returns.MemberList = []client.Member{
+			{
+				ID:         "some-id-0",
+				Name:       "some-name-0",
+				PeerURLs:   []string{"http://some-ip-0:7001"},
+				ClientURLs: []string{"http://some-ip-0:4001"},
+			},
+			{
+				ID:         "some-id-1",
+				Name:       "some-name-1",
+				PeerURLs:   []string{"http://some-ip-1:7001"},
+				ClientURLs: []string{"http://some-ip-1:4001"},
+			},
+			{
+				ID:         "some-id-2",
+				Name:       "some-name-2",
+				PeerURLs:   []string{"http://some-ip-2:7001"},
+				ClientURLs: []string{"http://some-ip-2:4001"},
+			},
+			{
+				ID:         "some-id-3",
+				Name:       "some-name-3",
+				PeerURLs:   []string{"http://some-ip-3:7001"},
+				ClientURLs: []string{"http://some-ip-3:4001"},
+			},
+			{
+				ID:         "some-id-4",
+				Name:       "some-name-4",
+				PeerURLs:   []string{"http://some-ip-4:7001"},
+				ClientURLs: []string{"http://some-ip-4:4001"},
+			},
+		}
+		etcdClient.EndpointHealthCall.Stub = func(endpoint string) (bool, error) {
+			switch endpoint {
+			case "http://some-ip-3:4001", "http://some-ip-4:4001":
+				return false, errors.New("connection refused")
+			default:
+				return true, nil
+			}
+		}
+
+		etcdfabConfig = config.Config{
+			Node: config.Node{
+				Name:  "some_name",
+				Index: 0,
+			},
+			Etcd: config.Etcd{
+				RunDir:                    runDir,
+				Machines:                  []string{"some-ip-0", "some-ip-1", "some-ip-2"},
+				NodeNames:                 []string{"some-name-0", "some-name-1", "some-name-2"},
+				OrphanedMemberGracePeriod: 3600,
+			},
+		}
+
+		registry = metrics.NewRegistry()
+		controller = cluster.NewController(etcdClient, logger, registry, func(time.Duration) {})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(runDir)).To(Succeed())
+	})
+
+	It("records unreachable members that are not expected without removing them", func() {
+		removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(BeEmpty())
+
+		Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+		Expect(ioutil.ReadFile(orphanedStatePath)).To(MatchJSON(`{
+			"first_seen": {
+				"some-id-3": "2017-03-01T12:00:00Z",
+				"some-id-4": "2017-03-01T12:00:00Z"
+			}
+		}`))
+
+		Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+			Action: "cluster.prune-orphaned-members.orphan-found",
+			Data: []lager.Data{{
+				"member-id": "some-id-3",
+				"name":      "some-name-3",
+				"peer-urls": []string{"http://some-ip-3:7001"},
+			}},
+		}))
+	})
+
+	Context("when the orphans have been seen for longer than the grace period", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(orphanedStatePath, []byte(`{
+				"first_seen": {
+					"some-id-3": "2017-03-01T10:30:00Z",
+					"some-id-4": "2017-03-01T10:00:00Z"
+				}
+			}`), 0644)).To(Succeed())
+		})
+
+		It("removes them one at a time, oldest first", func() {
+			removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(Equal([]string{"some-id-4", "some-id-3"}))
+
+			Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(2))
+			Expect(ioutil.ReadFile(orphanedStatePath)).To(MatchJSON(`{"first_seen": {}}`))
+			Expect(registry.Value(metrics.MemberRemoves, metrics.Success)).To(Equal(2.0))
+
+			Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "cluster.prune-orphaned-members.member-remove",
+				Data: []lager.Data{{
+					"member-id":  "some-id-4",
+					"name":       "some-name-4",
+					"peer-urls":  []string{"http://some-ip-4:7001"},
+					"first-seen": "2017-03-01T10:00:00Z",
+				}},
+			}))
+		})
+
+		Context("when removing an orphan would lose quorum", func() {
+			BeforeEach(func() {
+				etcdClient.EndpointHealthCall.Stub = func(endpoint string) (bool, error) {
+					switch endpoint {
+					case "http://some-ip-0:4001", "http://some-ip-1:4001":
+						return true, nil
+					default:
+						return false, errors.New("connection refused")
+					}
+				}
+			})
+
+			It("does not remove any member and keeps the orphans recorded", func() {
+				removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(removed).To(BeEmpty())
+
+				Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+				Expect(ioutil.ReadFile(orphanedStatePath)).To(MatchJSON(`{
+					"first_seen": {
+						"some-id-3": "2017-03-01T10:30:00Z",
+						"some-id-4": "2017-03-01T10:00:00Z"
+					}
+				}`))
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "cluster.prune-orphaned-members.refused",
+					Data: []lager.Data{{
+						"member-id":       "some-id-4",
+						"name":            "some-name-4",
+						"healthy-members": 2,
+						"members":         5,
+						"quorum":          3,
+					}},
+				}))
+			})
+		})
+
+		Context("when the healthy members are a quorum of the membership after the removal only", func() {
+			BeforeEach(func() {
+				etcdClient.MemberListCall.Returns.MemberList = append(etcdClient.MemberListCall.Returns.MemberList[:2],
+					etcdClient.MemberListCall.Returns.MemberList[3:]...)
+			})
+
+			It("does not remove any member", func() {
+				removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(removed).To(BeEmpty())
+
+				Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "cluster.prune-orphaned-members.refused",
+					Data: []lager.Data{{
+						"member-id":       "some-id-4",
+						"name":            "some-name-4",
+						"healthy-members": 2,
+						"members":         4,
+						"quorum":          3,
+					}},
+				}))
+			})
+		})
+
+		Context("when removing a member fails", func() {
+			BeforeEach(func() {
+				etcdClient.MemberRemoveCall.Returns.Error = errors.New("failed to remove member")
+			})
+
+			It("stops, returns the error and keeps the orphans recorded", func() {
+				removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+				Expect(err).To(MatchError("failed to remove member"))
+				Expect(removed).To(BeEmpty())
+				Expect(registry.Value(metrics.MemberRemoves, metrics.Failure)).To(Equal(1.0))
+
+				Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(1))
+				Expect(ioutil.ReadFile(orphanedStatePath)).To(MatchJSON(`{
+					"first_seen": {
+						"some-id-3": "2017-03-01T10:30:00Z",
+						"some-id-4": "2017-03-01T10:00:00Z"
+					}
+				}`))
+			})
+		})
+	})
+
+	Context("when a recorded orphan is reachable again", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(orphanedStatePath, []byte(`{
+				"first_seen": {
+					"some-id-3": "2017-03-01T10:00:00Z"
+				}
+			}`), 0644)).To(Succeed())
+			etcdClient.MemberListCall.Returns.MemberList = etcdClient.MemberListCall.Returns.MemberList[:4]
+			etcdClient.EndpointHealthCall.Stub = nil
+			etcdClient.EndpointHealthCall.Returns.Healthy = true
+		})
+
+		It("forgets about it", func() {
+			removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(BeEmpty())
+
+			Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+			Expect(ioutil.ReadFile(orphanedStatePath)).To(MatchJSON(`{"first_seen": {}}`))
+		})
+	})
+
+	Context("when a member has not started yet", func() {
+		BeforeEach(func() {
+			etcdClient.MemberListCall.Returns.MemberList[3].Name = ""
+			etcdfabConfig.Etcd.OrphanedMemberGracePeriod = 0
+		})
+
+		It("does not consider it an orphan", func() {
+			removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(Equal([]string{"some-id-4"}))
+
+			Expect(ioutil.ReadFile(orphanedStatePath)).To(MatchJSON(`{"first_seen": {}}`))
+		})
+	})
+
+	Context("when an expected member is unreachable", func() {
+		BeforeEach(func() {
+			etcdfabConfig.Etcd.Machines = []string{"some-ip-0", "some-ip-1", "some-ip-2", "some-ip-3", "some-ip-4"}
+			etcdfabConfig.Etcd.OrphanedMemberGracePeriod = 0
+		})
+
+		It("does not consider it an orphan", func() {
+			removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(BeEmpty())
+
+			Expect(etcdClient.MemberRemoveCall.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("when peers register under their instance name", func() {
+		BeforeEach(func() {
+			etcdClient.MemberListCall.Returns.MemberList[3].PeerURLs = []string{"https://some-name-3.some-dns-suffix:7001"}
+			etcdClient.MemberListCall.Returns.MemberList[4].PeerURLs = []string{"https://some-name-4.some-dns-suffix:7001"}
+			etcdfabConfig.Etcd.PeerRequireSSL = true
+			etcdfabConfig.Etcd.Machines = []string{"some-ip-0", "some-ip-1", "some-ip-2", "some-ip-4"}
+			etcdfabConfig.Etcd.NodeNames = []string{"some-name-0", "some-name-1", "some-name-2", "some-name-4"}
+			etcdfabConfig.Etcd.OrphanedMemberGracePeriod = 0
+		})
+
+		It("expects the members named after the instances in the link, whatever their index", func() {
+			removed, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(Equal([]string{"some-id-3"}))
+		})
+
+		Context("when no node names are configured", func() {
+			BeforeEach(func() {
+				etcdfabConfig.Etcd.NodeNames = nil
+			})
+
+			It("returns an error without listing members", func() {
+				_, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+				Expect(err).To(MatchError("no node names configured, cannot tell which members registered under their instance name are expected"))
+
+				Expect(etcdClient.MemberListCall.CallCount).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when no machines are configured", func() {
+		BeforeEach(func() {
+			etcdfabConfig.Etcd.Machines = nil
+		})
+
+		It("returns an error without listing members", func() {
+			_, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).To(MatchError("no machines configured, cannot tell which members are expected"))
+
+			Expect(etcdClient.MemberListCall.CallCount).To(Equal(0))
+		})
+	})
+
+	Context("when the orphaned members file is invalid", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(orphanedStatePath, []byte("%%%"), 0644)).To(Succeed())
+		})
+
+		It("returns an error", func() {
+			_, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).To(MatchError(ContainSubstring("invalid orphaned members file " + orphanedStatePath)))
+		})
+	})
+
+	Context("when member list fails", func() {
+		BeforeEach(func() {
+			etcdClient.MemberListCall.Returns.Error = errors.New("failed to list members")
+		})
+
+		It("returns the error and logs it", func() {
+			_, err := controller.PruneOrphanedMembers(context.Background(), etcdfabConfig, now)
+			Expect(err).To(MatchError("failed to list members"))
+
+			Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "cluster.prune-orphaned-members.member-list.failed",
+				Error:  errors.New("failed to list members"),
+			}))
+		})
+	})
+})
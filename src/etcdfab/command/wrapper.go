@@ -1,16 +1,42 @@
 package command
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type StopResult string
+
+const (
+	Terminated StopResult = "terminated"
+	Killed     StopResult = "killed"
+)
+
+var (
+	pollInterval = 100 * time.Millisecond
+	killTimeout  = time.Second
 )
 
+type logger interface {
+	Info(string, ...lager.Data)
+	Error(string, error, ...lager.Data)
+}
+
 type Wrapper struct {
+	logger logger
 }
 
-func NewWrapper() Wrapper {
-	return Wrapper{}
+func NewWrapper(logger logger) Wrapper {
+	return Wrapper{
+		logger: logger,
+	}
 }
 
 func (w Wrapper) Start(commandPath string, commandArgs []string, outWriter, errWriter io.Writer) (int, error) {
@@ -37,3 +63,91 @@ func (w Wrapper) Kill(pid int) error {
 
 	return nil
 }
+
+// Stop sends SIGTERM to the process and waits up to timeout for it to exit.
+// If it is still running after that it is sent SIGKILL, and Stop waits a
+// little longer for it to disappear. The returned StopResult says which of
+// the two ended the process.
+func (w Wrapper) Stop(pid int, timeout time.Duration) (StopResult, error) {
+	process, _ := os.FindProcess(pid)
+
+	w.logger.Info("command.stop.terminate", lager.Data{"pid": pid})
+	err := process.Signal(syscall.SIGTERM)
+	if err != nil {
+		w.logger.Error("command.stop.terminate.failed", err)
+		return "", err
+	}
+
+	w.logger.Info("command.stop.wait", lager.Data{
+		"pid":     pid,
+		"timeout": timeout.String(),
+	})
+	deadline := time.Now().Add(timeout)
+	for {
+		if !running(process) {
+			w.logger.Info("command.stop.exited", lager.Data{"pid": pid})
+			return Terminated, nil
+		}
+
+		if !time.Now().Before(deadline) {
+			break
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	w.logger.Info("command.stop.kill", lager.Data{"pid": pid})
+	err = process.Kill()
+	if err != nil {
+		if !running(process) {
+			w.logger.Info("command.stop.exited", lager.Data{"pid": pid})
+			return Terminated, nil
+		}
+
+		w.logger.Error("command.stop.kill.failed", err)
+		return "", err
+	}
+
+	// SIGKILL is delivered asynchronously, so the process is only reported
+	// killed once it is gone.
+	deadline = time.Now().Add(killTimeout)
+	for running(process) {
+		if !time.Now().Before(deadline) {
+			err := fmt.Errorf("process %d is still running %s after SIGKILL", pid, killTimeout)
+			w.logger.Error("command.stop.kill.failed", err)
+			return "", err
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	w.logger.Info("command.stop.killed", lager.Data{"pid": pid})
+	return Killed, nil
+}
+
+func (w Wrapper) Wait(pid int) error {
+	process, _ := os.FindProcess(pid)
+
+	state, err := process.Wait()
+	if err != nil {
+		return err
+	}
+
+	if !state.Success() {
+		return errors.New(state.String())
+	}
+
+	return nil
+}
+
+// Running reports whether a process with the given pid exists. A process the
+// caller is not allowed to signal, such as one owned by another user, exists
+// as well.
+func (w Wrapper) Running(pid int) bool {
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+func running(process *os.Process) bool {
+	return process.Signal(syscall.Signal(0)) == nil
+}
@@ -1,10 +1,15 @@
 package command_test
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"time"
+
+	"code.cloudfoundry.org/lager"
 
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -16,7 +21,7 @@ var _ = Describe("Wrapper", func() {
 			outWriter := newConcurrentSafeBuffer()
 			errWriter := newConcurrentSafeBuffer()
 
-			commandWrapper := command.NewWrapper()
+			commandWrapper := command.NewWrapper(&fakes.Logger{})
 			pid, err := commandWrapper.Start("echo", []string{"hello"}, outWriter, errWriter)
 			Expect(err).NotTo(HaveOccurred())
 
@@ -31,7 +36,7 @@ var _ = Describe("Wrapper", func() {
 
 		Context("when exec.Cmd.Start returns an error", func() {
 			It("returns the error to the caller", func() {
-				commandWrapper := command.NewWrapper()
+				commandWrapper := command.NewWrapper(&fakes.Logger{})
 				_, err := commandWrapper.Start("bogus", []string{}, nil, nil)
 				Expect(err).To(MatchError(ContainSubstring("executable file not found in $PATH")))
 			})
@@ -53,7 +58,7 @@ var _ = Describe("Wrapper", func() {
 				statusChan <- state.String()
 			}()
 
-			commandWrapper := command.NewWrapper()
+			commandWrapper := command.NewWrapper(&fakes.Logger{})
 			Expect(commandWrapper.Kill(pid)).NotTo(HaveOccurred())
 
 			var message string
@@ -63,9 +68,175 @@ var _ = Describe("Wrapper", func() {
 
 		Context("when killing the process returns an error", func() {
 			It("returns the error to the caller", func() {
-				commandWrapper := command.NewWrapper()
+				commandWrapper := command.NewWrapper(&fakes.Logger{})
 				Expect(commandWrapper.Kill(12345)).To(MatchError(ContainSubstring("process already finished")))
 			})
 		})
 	})
+
+	Describe("Stop", func() {
+		var (
+			logger     *fakes.Logger
+			statusChan chan string
+		)
+
+		startProcess := func(name string, args ...string) int {
+			cmd := exec.Command(name, args...)
+			Expect(cmd.Start()).NotTo(HaveOccurred())
+
+			statusChan = make(chan string, 1)
+			go func() {
+				state, _ := cmd.Process.Wait()
+				statusChan <- state.String()
+			}()
+
+			return cmd.Process.Pid
+		}
+
+		BeforeEach(func() {
+			logger = &fakes.Logger{}
+		})
+
+		It("terminates the process", func() {
+			pid := startProcess("yes")
+
+			commandWrapper := command.NewWrapper(logger)
+			result, err := commandWrapper.Stop(pid, 5*time.Second)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(command.Terminated))
+
+			var message string
+			Eventually(statusChan).Should(Receive(&message))
+			Expect(message).To(Equal("signal: terminated"))
+
+			Expect(logger.Messages()).To(Equal([]fakes.LoggerMessage{
+				{
+					Action: "command.stop.terminate",
+					Data:   []lager.Data{{"pid": pid}},
+				},
+				{
+					Action: "command.stop.wait",
+					Data: []lager.Data{{
+						"pid":     pid,
+						"timeout": "5s",
+					}},
+				},
+				{
+					Action: "command.stop.exited",
+					Data:   []lager.Data{{"pid": pid}},
+				},
+			}))
+		})
+
+		Context("when the process does not exit before the timeout", func() {
+			It("kills the process", func() {
+				pid := startProcess("sh", "-c", "trap '' TERM; while true; do sleep 0.05; done")
+				time.Sleep(100 * time.Millisecond)
+
+				commandWrapper := command.NewWrapper(logger)
+				result, err := commandWrapper.Stop(pid, 300*time.Millisecond)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result).To(Equal(command.Killed))
+
+				var message string
+				Eventually(statusChan).Should(Receive(&message))
+				Expect(message).To(Equal("signal: killed"))
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "command.stop.kill",
+					Data:   []lager.Data{{"pid": pid}},
+				}))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "command.stop.killed",
+					Data:   []lager.Data{{"pid": pid}},
+				}))
+			})
+		})
+
+		Context("when the process is still there after it was killed", func() {
+			It("returns an error", func() {
+				cmd := exec.Command("sh", "-c", "trap '' TERM; while true; do sleep 0.05; done")
+				Expect(cmd.Start()).NotTo(HaveOccurred())
+				pid := cmd.Process.Pid
+				time.Sleep(100 * time.Millisecond)
+
+				// The process is not reaped until Stop returns, so it lingers
+				// as a zombie that can still be signalled.
+				commandWrapper := command.NewWrapper(logger)
+				_, err := commandWrapper.Stop(pid, 100*time.Millisecond)
+				Expect(err).To(MatchError(fmt.Sprintf("process %d is still running 1s after SIGKILL", pid)))
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "command.stop.kill.failed",
+					Error:  err,
+				}))
+
+				cmd.Wait()
+			})
+		})
+
+		Context("when the process cannot be signaled", func() {
+			It("returns the error to the caller and logs a helpful message", func() {
+				commandWrapper := command.NewWrapper(logger)
+				_, err := commandWrapper.Stop(12345, time.Second)
+				Expect(err).To(MatchError(ContainSubstring("process already finished")))
+
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "command.stop.terminate.failed",
+					Error:  err,
+				}))
+			})
+		})
+	})
+
+	Describe("Wait", func() {
+		It("waits for the process to exit", func() {
+			cmd := exec.Command("sleep", "0.1")
+			Expect(cmd.Start()).NotTo(HaveOccurred())
+
+			commandWrapper := command.NewWrapper(&fakes.Logger{})
+			Expect(commandWrapper.Wait(cmd.Process.Pid)).NotTo(HaveOccurred())
+		})
+
+		Context("when the process exits unsuccessfully", func() {
+			It("returns the exit status as an error", func() {
+				cmd := exec.Command("false")
+				Expect(cmd.Start()).NotTo(HaveOccurred())
+
+				commandWrapper := command.NewWrapper(&fakes.Logger{})
+				Expect(commandWrapper.Wait(cmd.Process.Pid)).To(MatchError("exit status 1"))
+			})
+		})
+
+		Context("when the process is not a child of the caller", func() {
+			It("returns the error to the caller", func() {
+				commandWrapper := command.NewWrapper(&fakes.Logger{})
+				Expect(commandWrapper.Wait(12345)).To(MatchError(ContainSubstring("no child processes")))
+			})
+		})
+	})
+
+	Describe("Running", func() {
+		It("returns true while the process is running", func() {
+			cmd := exec.Command("sleep", "10")
+			Expect(cmd.Start()).NotTo(HaveOccurred())
+			defer cmd.Process.Kill()
+
+			commandWrapper := command.NewWrapper(&fakes.Logger{})
+			Expect(commandWrapper.Running(cmd.Process.Pid)).To(BeTrue())
+		})
+
+		It("returns false once the process has exited", func() {
+			cmd := exec.Command("true")
+			Expect(cmd.Run()).NotTo(HaveOccurred())
+
+			commandWrapper := command.NewWrapper(&fakes.Logger{})
+			Expect(commandWrapper.Running(cmd.Process.Pid)).To(BeFalse())
+		})
+
+		It("returns true for a process the caller may not signal", func() {
+			commandWrapper := command.NewWrapper(&fakes.Logger{})
+			Expect(commandWrapper.Running(1)).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// buildURL joins host and port the way net.Dial expects them, so IPv6
+// addresses end up in brackets.
+func buildURL(scheme, host string, port int) string {
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+func buildURLs(scheme string, hosts []string, port int) []string {
+	var urls []string
+	for _, host := range hosts {
+		urls = append(urls, buildURL(scheme, host, port))
+	}
+	return urls
+}
+
+// validateAddress accepts IPv4 and IPv6 addresses and DNS names. Anything
+// containing a colon has to be an IPv6 address, which catches addresses that
+// already carry a port or brackets.
+func validateAddress(property, address string) error {
+	if strings.Contains(address, ":") {
+		if net.ParseIP(address) == nil {
+			return fmt.Errorf("invalid %s %q: not a valid IPv6 address", property, address)
+		}
+		return nil
+	}
+
+	if net.ParseIP(address) != nil {
+		return nil
+	}
+
+	if len(address) > 253 {
+		return fmt.Errorf("invalid %s %q: host name is too long", property, address)
+	}
+
+	for _, label := range strings.Split(address, ".") {
+		if !validLabel(label) {
+			return fmt.Errorf("invalid %s %q: not an IP address or host name", property, address)
+		}
+	}
+
+	return nil
+}
+
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+
+	for _, r := range label {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c Config) validateAddresses() error {
+	addresses := []struct {
+		property string
+		values   []string
+	}{
+		{"external_ip", []string{c.Node.ExternalIP}},
+		{"peer_ip", []string{c.Etcd.PeerIP}},
+		{"client_ip", []string{c.Etcd.ClientIP}},
+		{"peer_ips", c.Etcd.PeerIPs},
+		{"client_ips", c.Etcd.ClientIPs},
+		{"machines", c.Etcd.Machines},
+	}
+
+	for _, address := range addresses {
+		for _, value := range address.values {
+			if value == "" {
+				continue
+			}
+
+			err := validateAddress(address.property, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
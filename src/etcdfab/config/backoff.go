@@ -0,0 +1,46 @@
+package config
+
+import "fmt"
+
+// Backoff configures how an operation is retried: the first delay, the
+// largest delay, how much the delay grows after every attempt, how much of
+// every delay is randomized and how long to keep retrying in total.
+type Backoff struct {
+	Initial    int     `json:"initial_in_milliseconds"`
+	Max        int     `json:"max_in_milliseconds"`
+	Multiplier float64 `json:"multiplier"`
+	Jitter     float64 `json:"jitter"`
+	Deadline   int     `json:"deadline_in_milliseconds"`
+}
+
+func (b Backoff) validate(property string) error {
+	if b.Initial <= 0 {
+		return fmt.Errorf("invalid %s: initial_in_milliseconds must be positive", property)
+	}
+
+	if b.Max < b.Initial {
+		return fmt.Errorf("invalid %s: max_in_milliseconds must be at least initial_in_milliseconds", property)
+	}
+
+	if b.Multiplier < 1 {
+		return fmt.Errorf("invalid %s: multiplier must be at least 1", property)
+	}
+
+	if b.Jitter < 0 || b.Jitter > 1 {
+		return fmt.Errorf("invalid %s: jitter must be between 0 and 1", property)
+	}
+
+	if b.Deadline <= 0 {
+		return fmt.Errorf("invalid %s: deadline_in_milliseconds must be positive", property)
+	}
+
+	return nil
+}
+
+func (c Config) validateBackoffs() error {
+	if err := c.Etcd.MemberListBackoff.validate("member_list_backoff"); err != nil {
+		return err
+	}
+
+	return c.Etcd.SyncBackoff.validate("sync_backoff")
+}
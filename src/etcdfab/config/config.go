@@ -10,9 +10,10 @@ import (
 )
 
 const (
-	clientPort      = 4001
-	peerPort        = 7001
-	etcdPidFilename = "etcd.pid"
+	etcdPidFilename         = "etcd.pid"
+	clusterStateFilename    = "cluster-state.json"
+	orphanedMembersFilename = "orphaned-members.json"
+	memberDirname           = "member"
 )
 
 type Node struct {
@@ -23,6 +24,7 @@ type Node struct {
 
 type Etcd struct {
 	EtcdPath               string `json:"etcd_path"`
+	EtcdctlPath            string `json:"etcdctl_path"`
 	CertDir                string `json:"cert_dir"`
 	RunDir                 string `json:"run_dir"`
 	DataDir                string `json:"data_dir"`
@@ -34,7 +36,61 @@ type Etcd struct {
 	ClientIP               string `json:"client_ip"`
 	AdvertiseURLsDNSSuffix string `json:"advertise_urls_dns_suffix"`
 	Machines               []string
-	EnableDebugLogging     bool `json:"enable_debug_logging"`
+	NodeNames              []string `json:"node_names"`
+	EnableDebugLogging     bool     `json:"enable_debug_logging"`
+	StopTimeout            int      `json:"stop_timeout_in_seconds"`
+	StartDeadline          int      `json:"start_deadline_in_seconds"`
+	StopDeadline           int      `json:"stop_deadline_in_seconds"`
+
+	ClientPort int      `json:"client_port"`
+	PeerPort   int      `json:"peer_port"`
+	PeerIPs    []string `json:"peer_ips"`
+	ClientIPs  []string `json:"client_ips"`
+
+	InitialClusterToken string `json:"initial_cluster_token"`
+
+	ClientAPI string `json:"client_api"`
+
+	SnapshotCount           int               `json:"snapshot_count"`
+	QuotaBackendBytes       int64             `json:"quota_backend_bytes"`
+	AutoCompactionRetention int               `json:"auto_compaction_retention_in_hours"`
+	MaxWALs                 int               `json:"max_wals"`
+	MaxSnapshots            int               `json:"max_snapshots"`
+	CipherSuites            []string          `json:"cipher_suites"`
+	ExtraArgs               map[string]string `json:"extra_args"`
+
+	MemberListBackoff    Backoff `json:"member_list_backoff"`
+	SyncBackoff          Backoff `json:"sync_backoff"`
+	SyncMaxRaftIndexLag  int     `json:"sync_max_raft_index_lag"`
+	MemberAddSettleDelay int     `json:"member_add_settle_delay_in_milliseconds"`
+
+	SuperviseMaxRestarts    int `json:"supervise_max_restarts"`
+	SuperviseInitialBackoff int `json:"supervise_initial_backoff_in_milliseconds"`
+	SuperviseMaxBackoff     int `json:"supervise_max_backoff_in_milliseconds"`
+	SuperviseCrashWindow    int `json:"supervise_crash_window_in_seconds"`
+
+	MemberRemovalQuorumPolicy      string `json:"member_removal_quorum_policy"`
+	MemberRemovalQuorumWaitTimeout int    `json:"member_removal_quorum_wait_timeout_in_seconds"`
+	MemberAddQuorumPolicy          string `json:"member_add_quorum_policy"`
+	MemberAddQuorumWaitTimeout     int    `json:"member_add_quorum_wait_timeout_in_seconds"`
+
+	JoinLockTTL     int `json:"join_lock_ttl_in_seconds"`
+	JoinLockTimeout int `json:"join_lock_timeout_in_seconds"`
+
+	PruneOrphanedMembers      bool `json:"prune_orphaned_members"`
+	OrphanedMemberGracePeriod int  `json:"orphaned_member_grace_period_in_seconds"`
+
+	DataDirPolicy              string `json:"data_dir_policy"`
+	DataDirQuarantineDir       string `json:"data_dir_quarantine_dir"`
+	DataDirQuarantineRetention int    `json:"data_dir_quarantine_retention"`
+
+	PreflightMode              string `json:"preflight_mode"`
+	PreflightMinFreeDisk       int    `json:"preflight_min_free_disk_in_megabytes"`
+	PreflightCertExpiryWarning int    `json:"preflight_cert_expiry_warning_in_days"`
+	DNSHealthCheckHost         string `json:"dns_health_check_host"`
+
+	AdminListenAddress  string `json:"admin_listen_address"`
+	MetricsTextfilePath string `json:"metrics_textfile_path"`
 }
 
 type Config struct {
@@ -45,10 +101,57 @@ type Config struct {
 func defaultConfig() Config {
 	return Config{
 		Etcd: Etcd{
-			EtcdPath: "/var/vcap/packages/etcd/etcd",
-			CertDir:  "/var/vcap/jobs/etcd/config/certs",
-			RunDir:   "/var/vcap/sys/run/etcd",
-			DataDir:  "/var/vcap/store/etcd",
+			EtcdPath:    "/var/vcap/packages/etcd/etcd",
+			EtcdctlPath: "/var/vcap/packages/etcd/etcdctl",
+			CertDir:     "/var/vcap/jobs/etcd/config/certs",
+			RunDir:      "/var/vcap/sys/run/etcd",
+			DataDir:     "/var/vcap/store/etcd",
+
+			StopTimeout:   20,
+			StartDeadline: 50,
+			StopDeadline:  90,
+
+			ClientAPI: "v2",
+
+			ClientPort: 4001,
+			PeerPort:   7001,
+
+			MemberListBackoff: Backoff{
+				Initial:    1000,
+				Max:        1000,
+				Multiplier: 1,
+				Deadline:   5000,
+			},
+			SyncBackoff: Backoff{
+				Initial:    1000,
+				Max:        1000,
+				Multiplier: 1,
+				Deadline:   20000,
+			},
+			SyncMaxRaftIndexLag:  100,
+			MemberAddSettleDelay: 2000,
+
+			SuperviseMaxRestarts:    5,
+			SuperviseInitialBackoff: 1000,
+			SuperviseMaxBackoff:     30000,
+			SuperviseCrashWindow:    600,
+
+			MemberRemovalQuorumPolicy:      "refuse",
+			MemberRemovalQuorumWaitTimeout: 60,
+			MemberAddQuorumPolicy:          "wait",
+			MemberAddQuorumWaitTimeout:     10,
+
+			JoinLockTTL:     50,
+			JoinLockTimeout: 10,
+
+			OrphanedMemberGracePeriod: 3600,
+
+			DataDirPolicy:              "wipe",
+			DataDirQuarantineRetention: 3,
+
+			PreflightMode:              "enforce",
+			PreflightMinFreeDisk:       100,
+			PreflightCertExpiryWarning: 30,
 		},
 	}
 }
@@ -76,6 +179,22 @@ func ConfigFromJSONs(configFilePath, linkConfigFilePath string) (Config, error)
 		}
 	}
 
+	if err := config.validateAddresses(); err != nil {
+		return Config{}, err
+	}
+
+	if err := config.validateTuning(); err != nil {
+		return Config{}, err
+	}
+
+	if err := config.validateBackoffs(); err != nil {
+		return Config{}, err
+	}
+
+	if err := config.validatePolicies(); err != nil {
+		return Config{}, err
+	}
+
 	return config, nil
 }
 
@@ -87,60 +206,100 @@ func (c Config) PidFile() string {
 	return filepath.Join(c.Etcd.RunDir, etcdPidFilename)
 }
 
+// ClusterStateFile records the ID of the cluster this member joined.
+func (c Config) ClusterStateFile() string {
+	return filepath.Join(c.Etcd.RunDir, clusterStateFilename)
+}
+
+// MemberDir is where etcd keeps the WAL and snapshots of this member. It only
+// exists once this member has joined a cluster with its current data dir.
+func (c Config) MemberDir() string {
+	return filepath.Join(c.Etcd.DataDir, memberDirname)
+}
+
+// OrphanedMembersFile records when each orphaned member was first seen, so
+// the grace period before pruning it spans several runs of etcdfab.
+func (c Config) OrphanedMembersFile() string {
+	return filepath.Join(c.Etcd.RunDir, orphanedMembersFilename)
+}
+
+func (c Config) QuarantineDir() string {
+	if c.Etcd.DataDirQuarantineDir != "" {
+		return c.Etcd.DataDirQuarantineDir
+	}
+	return fmt.Sprintf("%s-quarantine", filepath.Clean(c.Etcd.DataDir))
+}
+
 func (c Config) RequireSSL() bool {
 	return c.Etcd.RequireSSL
 }
 
+// EtcdClientAPI is the etcd API, v2 or v3, that etcdfab talks to the cluster
+// through.
+func (c Config) EtcdClientAPI() string {
+	return c.Etcd.ClientAPI
+}
+
 func (c Config) CertDir() string {
 	return c.Etcd.CertDir
 }
 
 func (c Config) AdvertisePeerURL() string {
 	if c.Etcd.PeerRequireSSL {
-		return fmt.Sprintf("https://%s.%s:%d", c.NodeName(), c.Etcd.AdvertiseURLsDNSSuffix, peerPort)
+		return buildURL("https", fmt.Sprintf("%s.%s", c.NodeName(), c.Etcd.AdvertiseURLsDNSSuffix), c.Etcd.PeerPort)
 	}
-	return fmt.Sprintf("http://%s:%d", c.Node.ExternalIP, peerPort)
+	return buildURL("http", c.Node.ExternalIP, c.Etcd.PeerPort)
 }
 
 func (c Config) AdvertiseClientURL() string {
 	if c.Etcd.RequireSSL {
-		return fmt.Sprintf("https://%s.%s:%d", c.NodeName(), c.Etcd.AdvertiseURLsDNSSuffix, clientPort)
+		return buildURL("https", fmt.Sprintf("%s.%s", c.NodeName(), c.Etcd.AdvertiseURLsDNSSuffix), c.Etcd.ClientPort)
 	}
-	return fmt.Sprintf("http://%s:%d", c.Node.ExternalIP, clientPort)
+	return buildURL("http", c.Node.ExternalIP, c.Etcd.ClientPort)
 }
 
-func (c Config) ListenPeerURL() string {
+// ListenPeerURLs returns a URL for every address in peer_ips, or for peer_ip
+// when peer_ips is empty.
+func (c Config) ListenPeerURLs() []string {
 	protocol := "http"
 	if c.Etcd.PeerRequireSSL {
 		protocol = "https"
 	}
-	return fmt.Sprintf("%s://%s:%d", protocol, c.Etcd.PeerIP, peerPort)
+
+	peerIPs := c.Etcd.PeerIPs
+	if len(peerIPs) == 0 {
+		peerIPs = []string{c.Etcd.PeerIP}
+	}
+	return buildURLs(protocol, peerIPs, c.Etcd.PeerPort)
 }
 
-func (c Config) ListenClientURL() string {
+// ListenClientURLs returns a URL for every address in client_ips, or for
+// client_ip when client_ips is empty.
+func (c Config) ListenClientURLs() []string {
 	protocol := "http"
 	if c.Etcd.RequireSSL {
 		protocol = "https"
 	}
-	return fmt.Sprintf("%s://%s:%d", protocol, c.Etcd.ClientIP, clientPort)
+
+	clientIPs := c.Etcd.ClientIPs
+	if len(clientIPs) == 0 {
+		clientIPs = []string{c.Etcd.ClientIP}
+	}
+	return buildURLs(protocol, clientIPs, c.Etcd.ClientPort)
 }
 
 func (c Config) EtcdClientEndpoints() []string {
 	if c.Etcd.RequireSSL {
-		return []string{fmt.Sprintf("https://%s:%d", c.Etcd.AdvertiseURLsDNSSuffix, clientPort)}
+		return []string{buildURL("https", c.Etcd.AdvertiseURLsDNSSuffix, c.Etcd.ClientPort)}
 	} else {
-		var endpoints []string
-		for _, machine := range c.Etcd.Machines {
-			endpoints = append(endpoints, fmt.Sprintf("http://%s:%d", machine, clientPort))
-		}
-		return endpoints
+		return buildURLs("http", c.Etcd.Machines, c.Etcd.ClientPort)
 	}
 }
 
 func (c Config) EtcdClientSelfEndpoint() string {
 	if c.Etcd.RequireSSL {
-		return fmt.Sprintf("https://%s.%s:%d", c.NodeName(), c.Etcd.AdvertiseURLsDNSSuffix, clientPort)
+		return buildURL("https", fmt.Sprintf("%s.%s", c.NodeName(), c.Etcd.AdvertiseURLsDNSSuffix), c.Etcd.ClientPort)
 	} else {
-		return fmt.Sprintf("http://%s:%d", c.Node.ExternalIP, clientPort)
+		return buildURL("http", c.Node.ExternalIP, c.Etcd.ClientPort)
 	}
 }
@@ -88,6 +88,7 @@ var _ = Describe("Config", func() {
 				},
 				Etcd: config.Etcd{
 					EtcdPath:               "/var/vcap/packages/etcd/etcd",
+					EtcdctlPath:            "/var/vcap/packages/etcd/etcdctl",
 					RunDir:                 "/var/vcap/sys/run/etcd",
 					CertDir:                "/var/vcap/jobs/etcd/config/certs",
 					DataDir:                "/var/vcap/store/etcd",
@@ -100,6 +101,50 @@ var _ = Describe("Config", func() {
 					AdvertiseURLsDNSSuffix: "some-dns-suffix-from-link",
 					Machines:               []string{"some-ip-1", "some-ip-2", "some-ip-3"},
 					EnableDebugLogging:     true,
+					StopTimeout:            20,
+					StartDeadline:          50,
+					StopDeadline:           90,
+					ClientAPI:              "v2",
+
+					ClientPort: 4001,
+					PeerPort:   7001,
+
+					MemberListBackoff: config.Backoff{
+						Initial:    1000,
+						Max:        1000,
+						Multiplier: 1,
+						Deadline:   5000,
+					},
+					SyncBackoff: config.Backoff{
+						Initial:    1000,
+						Max:        1000,
+						Multiplier: 1,
+						Deadline:   20000,
+					},
+					SyncMaxRaftIndexLag:  100,
+					MemberAddSettleDelay: 2000,
+
+					SuperviseMaxRestarts:    5,
+					SuperviseInitialBackoff: 1000,
+					SuperviseMaxBackoff:     30000,
+					SuperviseCrashWindow:    600,
+
+					MemberRemovalQuorumPolicy:      "refuse",
+					MemberRemovalQuorumWaitTimeout: 60,
+					MemberAddQuorumPolicy:          "wait",
+					MemberAddQuorumWaitTimeout:     10,
+
+					JoinLockTTL:     50,
+					JoinLockTimeout: 10,
+
+					OrphanedMemberGracePeriod: 3600,
+
+					DataDirPolicy:              "wipe",
+					DataDirQuarantineRetention: 3,
+
+					PreflightMode:              "enforce",
+					PreflightMinFreeDisk:       100,
+					PreflightCertExpiryWarning: 30,
 				},
 			}))
 		})
@@ -122,6 +167,7 @@ var _ = Describe("Config", func() {
 					},
 					Etcd: config.Etcd{
 						EtcdPath:               "/var/vcap/packages/etcd/etcd",
+						EtcdctlPath:            "/var/vcap/packages/etcd/etcdctl",
 						RunDir:                 "/var/vcap/sys/run/etcd",
 						CertDir:                "/var/vcap/jobs/etcd/config/certs",
 						DataDir:                "/var/vcap/store/etcd",
@@ -133,6 +179,50 @@ var _ = Describe("Config", func() {
 						ClientIP:               "some-client-ip",
 						AdvertiseURLsDNSSuffix: "some-dns-suffix",
 						EnableDebugLogging:     true,
+						StopTimeout:            20,
+						StartDeadline:          50,
+						StopDeadline:           90,
+						ClientAPI:              "v2",
+
+						ClientPort: 4001,
+						PeerPort:   7001,
+
+						MemberListBackoff: config.Backoff{
+							Initial:    1000,
+							Max:        1000,
+							Multiplier: 1,
+							Deadline:   5000,
+						},
+						SyncBackoff: config.Backoff{
+							Initial:    1000,
+							Max:        1000,
+							Multiplier: 1,
+							Deadline:   20000,
+						},
+						SyncMaxRaftIndexLag:  100,
+						MemberAddSettleDelay: 2000,
+
+						SuperviseMaxRestarts:    5,
+						SuperviseInitialBackoff: 1000,
+						SuperviseMaxBackoff:     30000,
+						SuperviseCrashWindow:    600,
+
+						MemberRemovalQuorumPolicy:      "refuse",
+						MemberRemovalQuorumWaitTimeout: 60,
+						MemberAddQuorumPolicy:          "wait",
+						MemberAddQuorumWaitTimeout:     10,
+
+						JoinLockTTL:     50,
+						JoinLockTimeout: 10,
+
+						OrphanedMemberGracePeriod: 3600,
+
+						DataDirPolicy:              "wipe",
+						DataDirQuarantineRetention: 3,
+
+						PreflightMode:              "enforce",
+						PreflightMinFreeDisk:       100,
+						PreflightCertExpiryWarning: 30,
 					},
 				}))
 			})
@@ -149,9 +239,38 @@ var _ = Describe("Config", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			Expect(cfg.Etcd.EtcdPath).To(Equal("/var/vcap/packages/etcd/etcd"))
+			Expect(cfg.Etcd.EtcdctlPath).To(Equal("/var/vcap/packages/etcd/etcdctl"))
 			Expect(cfg.Etcd.CertDir).To(Equal("/var/vcap/jobs/etcd/config/certs"))
 			Expect(cfg.Etcd.RunDir).To(Equal("/var/vcap/sys/run/etcd"))
 			Expect(cfg.Etcd.DataDir).To(Equal("/var/vcap/store/etcd"))
+			Expect(cfg.Etcd.StopTimeout).To(Equal(20))
+			Expect(cfg.Etcd.StartDeadline).To(Equal(50))
+			Expect(cfg.Etcd.StopDeadline).To(Equal(90))
+			Expect(cfg.Etcd.ClientAPI).To(Equal("v2"))
+			Expect(cfg.Etcd.ClientPort).To(Equal(4001))
+			Expect(cfg.Etcd.PeerPort).To(Equal(7001))
+			Expect(cfg.Etcd.SuperviseMaxRestarts).To(Equal(5))
+			Expect(cfg.Etcd.SuperviseInitialBackoff).To(Equal(1000))
+			Expect(cfg.Etcd.SuperviseMaxBackoff).To(Equal(30000))
+			Expect(cfg.Etcd.SuperviseCrashWindow).To(Equal(600))
+			Expect(cfg.Etcd.MemberRemovalQuorumPolicy).To(Equal("refuse"))
+			Expect(cfg.Etcd.MemberRemovalQuorumWaitTimeout).To(Equal(60))
+			Expect(cfg.Etcd.MemberAddQuorumPolicy).To(Equal("wait"))
+			Expect(cfg.Etcd.MemberAddQuorumWaitTimeout).To(Equal(10))
+			Expect(cfg.Etcd.MemberListBackoff).To(Equal(config.Backoff{Initial: 1000, Max: 1000, Multiplier: 1, Deadline: 5000}))
+			Expect(cfg.Etcd.SyncBackoff).To(Equal(config.Backoff{Initial: 1000, Max: 1000, Multiplier: 1, Deadline: 20000}))
+			Expect(cfg.Etcd.SyncMaxRaftIndexLag).To(Equal(100))
+			Expect(cfg.Etcd.MemberAddSettleDelay).To(Equal(2000))
+			Expect(cfg.Etcd.JoinLockTTL).To(Equal(50))
+			Expect(cfg.Etcd.JoinLockTimeout).To(Equal(10))
+			Expect(cfg.Etcd.OrphanedMemberGracePeriod).To(Equal(3600))
+			Expect(cfg.Etcd.DataDirPolicy).To(Equal("wipe"))
+			Expect(cfg.Etcd.DataDirQuarantineRetention).To(Equal(3))
+			Expect(cfg.Etcd.PreflightMode).To(Equal("enforce"))
+			Expect(cfg.Etcd.PreflightMinFreeDisk).To(Equal(100))
+			Expect(cfg.Etcd.PreflightCertExpiryWarning).To(Equal(30))
+			Expect(cfg.Etcd.AdminListenAddress).To(BeEmpty())
+			Expect(cfg.Etcd.MetricsTextfilePath).To(BeEmpty())
 		})
 
 		Context("failure cases", func() {
@@ -195,6 +314,186 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("tuning", func() {
+		var (
+			tmpDir             string
+			linkConfigFilePath string
+
+			loadConfig func(etcd map[string]interface{}) (config.Config, error)
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			linkConfigFilePath = writeConfigurationFile(tmpDir, "link-config-file", map[string]interface{}{})
+
+			loadConfig = func(etcd map[string]interface{}) (config.Config, error) {
+				configFilePath := writeConfigurationFile(tmpDir, "config-file", map[string]interface{}{
+					"etcd": etcd,
+				})
+				return config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("reads the tuning properties and extra args", func() {
+			cfg, err := loadConfig(map[string]interface{}{
+				"snapshot_count":                     5000,
+				"quota_backend_bytes":                4294967296,
+				"auto_compaction_retention_in_hours": 1,
+				"max_wals":                           10,
+				"max_snapshots":                      3,
+				"cipher_suites":                      []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+				"extra_args":                         map[string]string{"metrics": "extensive"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.Etcd.SnapshotCount).To(Equal(5000))
+			Expect(cfg.Etcd.QuotaBackendBytes).To(Equal(int64(4294967296)))
+			Expect(cfg.Etcd.AutoCompactionRetention).To(Equal(1))
+			Expect(cfg.Etcd.MaxWALs).To(Equal(10))
+			Expect(cfg.Etcd.MaxSnapshots).To(Equal(3))
+			Expect(cfg.Etcd.CipherSuites).To(Equal([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}))
+			Expect(cfg.Etcd.ExtraArgs).To(Equal(map[string]string{"metrics": "extensive"}))
+		})
+
+		It("rejects values out of range", func() {
+			_, err := loadConfig(map[string]interface{}{"snapshot_count": -1})
+			Expect(err).To(MatchError("invalid snapshot_count -1: must be between 0 and 10000000"))
+
+			_, err = loadConfig(map[string]interface{}{"quota_backend_bytes": int64(16 * 1024 * 1024 * 1024)})
+			Expect(err).To(MatchError("invalid quota_backend_bytes 17179869184: must be between 0 and 8589934592"))
+
+			_, err = loadConfig(map[string]interface{}{"max_wals": 5000})
+			Expect(err).To(MatchError("invalid max_wals 5000: must be between 0 and 1000"))
+		})
+
+		It("rejects unknown cipher suites", func() {
+			_, err := loadConfig(map[string]interface{}{"cipher_suites": []string{"TLS_RSA_WITH_RC4_128_SHA"}})
+			Expect(err).To(MatchError(`invalid cipher_suites: unsupported cipher suite "TLS_RSA_WITH_RC4_128_SHA"`))
+		})
+
+		It("rejects extra args for flags managed by etcdfab", func() {
+			_, err := loadConfig(map[string]interface{}{"extra_args": map[string]string{"listen-client-urls": "http://0.0.0.0:2379"}})
+			Expect(err).To(MatchError(`invalid extra_args flag "listen-client-urls": it is managed by etcdfab`))
+
+			_, err = loadConfig(map[string]interface{}{"extra_args": map[string]string{"snapshot-count": "100"}})
+			Expect(err).To(MatchError(`invalid extra_args flag "snapshot-count": it is managed by etcdfab`))
+		})
+
+		It("reads the backoff policies, keeping the defaults for fields left out", func() {
+			cfg, err := loadConfig(map[string]interface{}{
+				"member_list_backoff": map[string]interface{}{
+					"max_in_milliseconds": 8000,
+					"multiplier":          2,
+					"jitter":              0.2,
+				},
+				"sync_backoff": map[string]interface{}{
+					"deadline_in_milliseconds": 60000,
+				},
+				"member_add_settle_delay_in_milliseconds": 500,
+				"start_deadline_in_seconds":               90,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.Etcd.MemberListBackoff).To(Equal(config.Backoff{Initial: 1000, Max: 8000, Multiplier: 2, Jitter: 0.2, Deadline: 5000}))
+			Expect(cfg.Etcd.SyncBackoff).To(Equal(config.Backoff{Initial: 1000, Max: 1000, Multiplier: 1, Deadline: 60000}))
+			Expect(cfg.Etcd.MemberAddSettleDelay).To(Equal(500))
+		})
+
+		It("rejects invalid backoff policies", func() {
+			_, err := loadConfig(map[string]interface{}{"member_list_backoff": map[string]interface{}{"initial_in_milliseconds": 0}})
+			Expect(err).To(MatchError("invalid member_list_backoff: initial_in_milliseconds must be positive"))
+
+			_, err = loadConfig(map[string]interface{}{"sync_backoff": map[string]interface{}{"max_in_milliseconds": 500}})
+			Expect(err).To(MatchError("invalid sync_backoff: max_in_milliseconds must be at least initial_in_milliseconds"))
+
+			_, err = loadConfig(map[string]interface{}{"sync_backoff": map[string]interface{}{"multiplier": 0.5}})
+			Expect(err).To(MatchError("invalid sync_backoff: multiplier must be at least 1"))
+
+			_, err = loadConfig(map[string]interface{}{"sync_backoff": map[string]interface{}{"jitter": 1.5}})
+			Expect(err).To(MatchError("invalid sync_backoff: jitter must be between 0 and 1"))
+
+			_, err = loadConfig(map[string]interface{}{"sync_backoff": map[string]interface{}{"deadline_in_milliseconds": 0}})
+			Expect(err).To(MatchError("invalid sync_backoff: deadline_in_milliseconds must be positive"))
+		})
+
+		It("rejects extra args that are not plain flag names", func() {
+			_, err := loadConfig(map[string]interface{}{"extra_args": map[string]string{"--metrics": "basic"}})
+			Expect(err).To(MatchError(`invalid extra_args flag "--metrics": use the flag name without leading dashes`))
+		})
+
+		It("rejects unknown policies", func() {
+			_, err := loadConfig(map[string]interface{}{"member_removal_quorum_policy": "force"})
+			Expect(err).To(MatchError(`invalid member_removal_quorum_policy "force": must be one of "refuse", "wait"`))
+
+			_, err = loadConfig(map[string]interface{}{"member_add_quorum_policy": "force"})
+			Expect(err).To(MatchError(`invalid member_add_quorum_policy "force": must be one of "refuse", "wait"`))
+
+			_, err = loadConfig(map[string]interface{}{"data_dir_policy": "shred"})
+			Expect(err).To(MatchError(`invalid data_dir_policy "shred": must be one of "wipe", "quarantine", "preserve"`))
+
+			_, err = loadConfig(map[string]interface{}{"preflight_mode": "ignore"})
+			Expect(err).To(MatchError(`invalid preflight_mode "ignore": must be one of "enforce", "warn"`))
+		})
+
+		It("accepts the defaults, whose join steps fit inside the start deadline", func() {
+			cfg, err := loadConfig(map[string]interface{}{})
+			Expect(err).NotTo(HaveOccurred())
+
+			joinDuration := cfg.Etcd.MemberListBackoff.Deadline +
+				cfg.Etcd.JoinLockTimeout*1000 +
+				cfg.Etcd.MemberAddQuorumWaitTimeout*1000 +
+				cfg.Etcd.MemberAddSettleDelay +
+				cfg.Etcd.SyncBackoff.Deadline
+			Expect(joinDuration).To(BeNumerically("<", cfg.Etcd.StartDeadline*1000))
+		})
+
+		It("rejects join steps that add up to more than the start deadline", func() {
+			_, err := loadConfig(map[string]interface{}{
+				"join_lock_timeout_in_seconds": 15,
+			})
+			Expect(err).To(MatchError("invalid start_deadline_in_seconds 50: must be more than the 52000ms member_list_backoff, join_lock_timeout_in_seconds, member_add_quorum_wait_timeout_in_seconds, member_add_settle_delay_in_milliseconds and sync_backoff add up to"))
+
+			_, err = loadConfig(map[string]interface{}{
+				"member_add_quorum_wait_timeout_in_seconds": 15,
+				"sync_backoff": map[string]interface{}{
+					"deadline_in_milliseconds": 18000,
+				},
+			})
+			Expect(err).To(MatchError("invalid start_deadline_in_seconds 50: must be more than the 50000ms member_list_backoff, join_lock_timeout_in_seconds, member_add_quorum_wait_timeout_in_seconds, member_add_settle_delay_in_milliseconds and sync_backoff add up to"))
+		})
+
+		It("only counts the member add quorum wait when the member add quorum policy waits", func() {
+			_, err := loadConfig(map[string]interface{}{
+				"member_add_quorum_policy":                  "refuse",
+				"member_add_quorum_wait_timeout_in_seconds": 60,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects a join lock ttl the start deadline cannot accommodate", func() {
+			_, err := loadConfig(map[string]interface{}{
+				"start_deadline_in_seconds": 50,
+				"join_lock_ttl_in_seconds":  51,
+			})
+			Expect(err).To(MatchError("invalid join_lock_ttl_in_seconds 51: must be at most start_deadline_in_seconds 50"))
+		})
+
+		It("rejects a stop timeout the stop deadline cannot accommodate", func() {
+			_, err := loadConfig(map[string]interface{}{
+				"stop_deadline_in_seconds": 20,
+				"stop_timeout_in_seconds":  20,
+			})
+			Expect(err).To(MatchError("invalid stop_timeout_in_seconds 20: must be less than stop_deadline_in_seconds 20"))
+		})
+	})
+
 	Describe("NodeName", func() {
 		var (
 			cfg config.Config
@@ -250,6 +549,51 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("ClusterStateFile", func() {
+		It("returns the path to the cluster state file in the run dir", func() {
+			cfg := config.Config{
+				Etcd: config.Etcd{
+					RunDir: "/some/run/dir",
+				},
+			}
+			Expect(cfg.ClusterStateFile()).To(Equal("/some/run/dir/cluster-state.json"))
+		})
+	})
+
+	Describe("MemberDir", func() {
+		It("returns the path to the member dir in the data dir", func() {
+			cfg := config.Config{
+				Etcd: config.Etcd{
+					DataDir: "/var/vcap/store/etcd",
+				},
+			}
+			Expect(cfg.MemberDir()).To(Equal("/var/vcap/store/etcd/member"))
+		})
+	})
+
+	Describe("QuarantineDir", func() {
+		It("returns the configured quarantine dir", func() {
+			cfg := config.Config{
+				Etcd: config.Etcd{
+					DataDir:              "/var/vcap/store/etcd",
+					DataDirQuarantineDir: "/some/quarantine/dir",
+				},
+			}
+			Expect(cfg.QuarantineDir()).To(Equal("/some/quarantine/dir"))
+		})
+
+		Context("when no quarantine dir is configured", func() {
+			It("returns a sibling of the data dir", func() {
+				cfg := config.Config{
+					Etcd: config.Etcd{
+						DataDir: "/var/vcap/store/etcd/",
+					},
+				}
+				Expect(cfg.QuarantineDir()).To(Equal("/var/vcap/store/etcd-quarantine"))
+			})
+		})
+	})
+
 	Describe("RequireSSL", func() {
 		Context("when require_ssl is false", func() {
 			var (
@@ -317,6 +661,17 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("EtcdClientAPI", func() {
+		It("returns the ClientAPI", func() {
+			cfg := config.Config{
+				Etcd: config.Etcd{
+					ClientAPI: "v3",
+				},
+			}
+			Expect(cfg.EtcdClientAPI()).To(Equal("v3"))
+		})
+	})
+
 	Describe("AdvertisePeerURL", func() {
 		var (
 			cfg                config.Config
@@ -432,7 +787,7 @@ var _ = Describe("Config", func() {
 		})
 	})
 
-	Describe("ListenPeerURL", func() {
+	Describe("ListenPeerURLs", func() {
 		var (
 			cfg                config.Config
 			tmpDir             string
@@ -463,7 +818,7 @@ var _ = Describe("Config", func() {
 		})
 
 		It("returns the listen peer url based on config", func() {
-			Expect(cfg.ListenPeerURL()).To(Equal("http://some-peer-ip:7001"))
+			Expect(cfg.ListenPeerURLs()).To(Equal([]string{"http://some-peer-ip:7001"}))
 		})
 
 		Context("when PeerRequireSSL is true", func() {
@@ -486,12 +841,32 @@ var _ = Describe("Config", func() {
 			})
 
 			It("returns the listen peer url based on config", func() {
-				Expect(cfg.ListenPeerURL()).To(Equal("https://some-peer-ip:7001"))
+				Expect(cfg.ListenPeerURLs()).To(Equal([]string{"https://some-peer-ip:7001"}))
+			})
+		})
+
+		Context("when several peer ips are configured", func() {
+			BeforeEach(func() {
+				configuration := map[string]interface{}{
+					"etcd": map[string]interface{}{
+						"peer_ip":  "some-peer-ip",
+						"peer_ips": []string{"::", "0.0.0.0"},
+					},
+				}
+				configFilePath = writeConfigurationFile(tmpDir, "config-file", configuration)
+
+				var err error
+				cfg, err = config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns a listen peer url for each of them instead of peer ip", func() {
+				Expect(cfg.ListenPeerURLs()).To(Equal([]string{"http://[::]:7001", "http://0.0.0.0:7001"}))
 			})
 		})
 	})
 
-	Describe("ListenClientURL", func() {
+	Describe("ListenClientURLs", func() {
 		var (
 			cfg                config.Config
 			tmpDir             string
@@ -522,7 +897,7 @@ var _ = Describe("Config", func() {
 		})
 
 		It("returns the listen peer url based on config", func() {
-			Expect(cfg.ListenClientURL()).To(Equal("http://some-client-ip:4001"))
+			Expect(cfg.ListenClientURLs()).To(Equal([]string{"http://some-client-ip:4001"}))
 		})
 
 		Context("when RequireSSL is true", func() {
@@ -545,7 +920,27 @@ var _ = Describe("Config", func() {
 			})
 
 			It("returns the listen peer url based on config", func() {
-				Expect(cfg.ListenClientURL()).To(Equal("https://some-client-ip:4001"))
+				Expect(cfg.ListenClientURLs()).To(Equal([]string{"https://some-client-ip:4001"}))
+			})
+		})
+
+		Context("when several client ips are configured", func() {
+			BeforeEach(func() {
+				configuration := map[string]interface{}{
+					"etcd": map[string]interface{}{
+						"client_ip":  "some-client-ip",
+						"client_ips": []string{"::", "0.0.0.0"},
+					},
+				}
+				configFilePath = writeConfigurationFile(tmpDir, "config-file", configuration)
+
+				var err error
+				cfg, err = config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			It("returns a listen client url for each of them instead of client ip", func() {
+				Expect(cfg.ListenClientURLs()).To(Equal([]string{"http://[::]:4001", "http://0.0.0.0:4001"}))
 			})
 		})
 	})
@@ -603,6 +998,144 @@ var _ = Describe("Config", func() {
 		})
 	})
 
+	Describe("ports", func() {
+		var (
+			tmpDir             string
+			configFilePath     string
+			linkConfigFilePath string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			configuration := map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "etcd",
+					"index":       0,
+					"external_ip": "my-external-ip",
+				},
+				"etcd": map[string]interface{}{
+					"peer_ip":     "some-peer-ip",
+					"client_ip":   "some-client-ip",
+					"machines":    []string{"some-ip-1"},
+					"client_port": 2379,
+					"peer_port":   2380,
+				},
+			}
+			configFilePath = writeConfigurationFile(tmpDir, "config-file", configuration)
+
+			linkConfigFilePath = writeConfigurationFile(tmpDir, "link-config-file", map[string]interface{}{})
+		})
+
+		It("uses the configured ports in every url", func() {
+			cfg, err := config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.AdvertisePeerURL()).To(Equal("http://my-external-ip:2380"))
+			Expect(cfg.AdvertiseClientURL()).To(Equal("http://my-external-ip:2379"))
+			Expect(cfg.ListenPeerURLs()).To(Equal([]string{"http://some-peer-ip:2380"}))
+			Expect(cfg.ListenClientURLs()).To(Equal([]string{"http://some-client-ip:2379"}))
+			Expect(cfg.EtcdClientEndpoints()).To(Equal([]string{"http://some-ip-1:2379"}))
+			Expect(cfg.EtcdClientSelfEndpoint()).To(Equal("http://my-external-ip:2379"))
+		})
+
+		It("prefers the ports from the link", func() {
+			linkConfigFilePath = writeConfigurationFile(tmpDir, "link-config-file", map[string]interface{}{
+				"client_port": 12379,
+				"peer_port":   12380,
+			})
+
+			cfg, err := config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.AdvertisePeerURL()).To(Equal("http://my-external-ip:12380"))
+			Expect(cfg.EtcdClientEndpoints()).To(Equal([]string{"http://some-ip-1:12379"}))
+		})
+	})
+
+	Describe("ipv6 addresses", func() {
+		var (
+			tmpDir             string
+			linkConfigFilePath string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			linkConfigFilePath = writeConfigurationFile(tmpDir, "link-config-file", map[string]interface{}{})
+		})
+
+		It("puts them in brackets in every url", func() {
+			configFilePath := writeConfigurationFile(tmpDir, "config-file", map[string]interface{}{
+				"node": map[string]interface{}{
+					"name":        "etcd",
+					"index":       0,
+					"external_ip": "fd00::1",
+				},
+				"etcd": map[string]interface{}{
+					"peer_ip":   "fd00::1",
+					"client_ip": "::",
+					"machines":  []string{"fd00::1", "fd00::2"},
+				},
+			})
+
+			cfg, err := config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(cfg.AdvertisePeerURL()).To(Equal("http://[fd00::1]:7001"))
+			Expect(cfg.AdvertiseClientURL()).To(Equal("http://[fd00::1]:4001"))
+			Expect(cfg.ListenPeerURLs()).To(Equal([]string{"http://[fd00::1]:7001"}))
+			Expect(cfg.ListenClientURLs()).To(Equal([]string{"http://[::]:4001"}))
+			Expect(cfg.EtcdClientEndpoints()).To(Equal([]string{"http://[fd00::1]:4001", "http://[fd00::2]:4001"}))
+			Expect(cfg.EtcdClientSelfEndpoint()).To(Equal("http://[fd00::1]:4001"))
+		})
+
+		Context("when an address is malformed", func() {
+			var loadConfig func(node, etcd map[string]interface{}) error
+
+			BeforeEach(func() {
+				loadConfig = func(node, etcd map[string]interface{}) error {
+					configFilePath := writeConfigurationFile(tmpDir, "config-file", map[string]interface{}{
+						"node": node,
+						"etcd": etcd,
+					})
+
+					_, err := config.ConfigFromJSONs(configFilePath, linkConfigFilePath)
+					return err
+				}
+			})
+
+			It("rejects an external ip with a port", func() {
+				err := loadConfig(map[string]interface{}{"external_ip": "10.0.0.1:7001"}, map[string]interface{}{})
+				Expect(err).To(MatchError(`invalid external_ip "10.0.0.1:7001": not a valid IPv6 address`))
+			})
+
+			It("rejects a peer ip in brackets", func() {
+				err := loadConfig(map[string]interface{}{}, map[string]interface{}{"peer_ip": "[fd00::1]"})
+				Expect(err).To(MatchError(`invalid peer_ip "[fd00::1]": not a valid IPv6 address`))
+			})
+
+			It("rejects a client ip with trailing whitespace", func() {
+				err := loadConfig(map[string]interface{}{}, map[string]interface{}{"client_ip": "10.0.0.1 "})
+				Expect(err).To(MatchError(`invalid client_ip "10.0.0.1 ": not an IP address or host name`))
+			})
+
+			It("rejects a malformed listen address", func() {
+				err := loadConfig(map[string]interface{}{}, map[string]interface{}{"peer_ips": []string{"::", "fd00:::1"}})
+				Expect(err).To(MatchError(`invalid peer_ips "fd00:::1": not a valid IPv6 address`))
+			})
+
+			It("rejects a machine that is not a host name", func() {
+				err := loadConfig(map[string]interface{}{}, map[string]interface{}{"machines": []string{"some_machine"}})
+				Expect(err).To(MatchError(`invalid machines "some_machine": not an IP address or host name`))
+			})
+		})
+	})
+
 	Describe("EtcdClientSelfEndpoint", func() {
 		var (
 			cfg                config.Config
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func validateOneOf(property, value string, allowed ...string) error {
+	quoted := []string{}
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+		quoted = append(quoted, strconv.Quote(a))
+	}
+
+	return fmt.Errorf("invalid %s %q: must be one of %s", property, value, strings.Join(quoted, ", "))
+}
+
+// validatePolicies rejects policies etcdfab does not know, so that a typo in
+// the manifest fails the deploy instead of silently changing what etcdfab
+// does when the member is stopped or started.
+func (c Config) validatePolicies() error {
+	if err := validateOneOf("member_removal_quorum_policy", c.Etcd.MemberRemovalQuorumPolicy, "refuse", "wait"); err != nil {
+		return err
+	}
+
+	if err := validateOneOf("member_add_quorum_policy", c.Etcd.MemberAddQuorumPolicy, "refuse", "wait"); err != nil {
+		return err
+	}
+
+	if err := validateOneOf("data_dir_policy", c.Etcd.DataDirPolicy, "wipe", "quarantine", "preserve"); err != nil {
+		return err
+	}
+
+	if err := validateOneOf("preflight_mode", c.Etcd.PreflightMode, "enforce", "warn"); err != nil {
+		return err
+	}
+
+	if err := c.validateJoinDuration(); err != nil {
+		return err
+	}
+
+	// Stopping etcd is the last thing a stop does, so the time it is given
+	// after SIGTERM has to fit in what the stop may take.
+	if err := validateLessThan("stop_timeout_in_seconds", c.Etcd.StopTimeout,
+		"stop_deadline_in_seconds", c.Etcd.StopDeadline); err != nil {
+		return err
+	}
+
+	// A node holds the join lock for as long as its start may take at most, so
+	// a lock left behind by a node whose start was cut off does not outlive it
+	// by more than that.
+	return validateAtMost("join_lock_ttl_in_seconds", c.Etcd.JoinLockTTL,
+		"start_deadline_in_seconds", c.Etcd.StartDeadline)
+}
+
+// validateJoinDuration checks that a node joining an existing cluster can
+// list the members, wait for the join lock and for a quorum to add itself,
+// let the member add settle and sync within the start deadline. These run
+// one after the other, and waiting longer than the start may take ends in the
+// start being cut off instead of failing cleanly.
+func (c Config) validateJoinDuration() error {
+	joinDuration := c.Etcd.MemberListBackoff.Deadline +
+		c.Etcd.JoinLockTimeout*1000 +
+		c.Etcd.MemberAddSettleDelay +
+		c.Etcd.SyncBackoff.Deadline
+	if c.Etcd.MemberAddQuorumPolicy == "wait" {
+		joinDuration += c.Etcd.MemberAddQuorumWaitTimeout * 1000
+	}
+
+	if joinDuration >= c.Etcd.StartDeadline*1000 {
+		return fmt.Errorf("invalid start_deadline_in_seconds %d: must be more than the %dms member_list_backoff, join_lock_timeout_in_seconds, member_add_quorum_wait_timeout_in_seconds, member_add_settle_delay_in_milliseconds and sync_backoff add up to",
+			c.Etcd.StartDeadline, joinDuration)
+	}
+
+	return nil
+}
+
+func validateLessThan(property string, value int, limitProperty string, limit int) error {
+	if value >= limit {
+		return fmt.Errorf("invalid %s %d: must be less than %s %d", property, value, limitProperty, limit)
+	}
+	return nil
+}
+
+func validateAtMost(property string, value int, limitProperty string, limit int) error {
+	if value > limit {
+		return fmt.Errorf("invalid %s %d: must be at most %s %d", property, value, limitProperty, limit)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+const (
+	maxSnapshotCount     = 10000000
+	maxQuotaBackendBytes = 8 * 1024 * 1024 * 1024
+	maxAutoCompaction    = 24 * 365
+	maxRetainedFiles     = 1000
+)
+
+// managedFlags are the etcd flags etcdfab generates itself, either from the
+// rest of the config or while joining a cluster. They cannot be passed
+// through extra_args.
+var managedFlags = []string{
+	"name",
+	"debug",
+	"data-dir",
+	"heartbeat-interval",
+	"election-timeout",
+	"listen-peer-urls",
+	"listen-client-urls",
+	"initial-advertise-peer-urls",
+	"advertise-client-urls",
+	"client-cert-auth",
+	"trusted-ca-file",
+	"cert-file",
+	"key-file",
+	"peer-client-cert-auth",
+	"peer-trusted-ca-file",
+	"peer-cert-file",
+	"peer-key-file",
+	"initial-cluster",
+	"initial-cluster-state",
+	"initial-cluster-token",
+	"force-new-cluster",
+	"snapshot-count",
+	"quota-backend-bytes",
+	"auto-compaction-retention",
+	"max-wals",
+	"max-snapshots",
+	"cipher-suites",
+}
+
+var cipherSuites = map[string]bool{
+	"TLS_RSA_WITH_AES_128_CBC_SHA":            true,
+	"TLS_RSA_WITH_AES_256_CBC_SHA":            true,
+	"TLS_RSA_WITH_AES_128_GCM_SHA256":         true,
+	"TLS_RSA_WITH_AES_256_GCM_SHA384":         true,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA":    true,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA":    true,
+	"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA":      true,
+	"TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA":      true,
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   true,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": true,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   true,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": true,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    true,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  true,
+}
+
+var extraArgPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func validateRange(property string, value, max int64) error {
+	if value < 0 || value > max {
+		return fmt.Errorf("invalid %s %d: must be between 0 and %d", property, value, max)
+	}
+	return nil
+}
+
+func (c Config) validateTuning() error {
+	ranges := []struct {
+		property string
+		value    int64
+		max      int64
+	}{
+		{"snapshot_count", int64(c.Etcd.SnapshotCount), maxSnapshotCount},
+		{"quota_backend_bytes", c.Etcd.QuotaBackendBytes, maxQuotaBackendBytes},
+		{"auto_compaction_retention_in_hours", int64(c.Etcd.AutoCompactionRetention), maxAutoCompaction},
+		{"max_wals", int64(c.Etcd.MaxWALs), maxRetainedFiles},
+		{"max_snapshots", int64(c.Etcd.MaxSnapshots), maxRetainedFiles},
+	}
+
+	for _, r := range ranges {
+		err := validateRange(r.property, r.value, r.max)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, cipherSuite := range c.Etcd.CipherSuites {
+		if !cipherSuites[cipherSuite] {
+			return fmt.Errorf("invalid cipher_suites: unsupported cipher suite %q", cipherSuite)
+		}
+	}
+
+	managed := map[string]bool{}
+	for _, flag := range managedFlags {
+		managed[flag] = true
+	}
+
+	var flags []string
+	for flag := range c.Etcd.ExtraArgs {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+
+	for _, flag := range flags {
+		if !extraArgPattern.MatchString(flag) {
+			return fmt.Errorf("invalid extra_args flag %q: use the flag name without leading dashes", flag)
+		}
+
+		if managed[flag] {
+			return fmt.Errorf("invalid extra_args flag %q: it is managed by etcdfab", flag)
+		}
+	}
+
+	return nil
+}
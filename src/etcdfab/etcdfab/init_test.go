@@ -22,8 +22,9 @@ func TestEtcdFab(t *testing.T) {
 var (
 	etcdBackendServer *backend.EtcdBackendServer
 
-	pathToFakeEtcd string
-	pathToEtcdFab  string
+	pathToFakeEtcd    string
+	pathToFakeEtcdctl string
+	pathToEtcdFab     string
 )
 
 var _ = BeforeSuite(func() {
@@ -34,6 +35,9 @@ var _ = BeforeSuite(func() {
 		"--ldflags", fmt.Sprintf("-X main.backendURL=%s", etcdBackendServer.ServerURL()))
 	Expect(err).NotTo(HaveOccurred())
 
+	pathToFakeEtcdctl, err = gexec.Build("github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes/etcdctl")
+	Expect(err).NotTo(HaveOccurred())
+
 	pathToEtcdFab, err = gexec.Build("github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/etcdfab",
 		"--ldflags", "-X main.disableDelay=true",
 	)
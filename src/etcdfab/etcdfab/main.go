@@ -1,18 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/application"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/logging"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/sync"
-
-	"code.cloudfoundry.org/lager"
 )
 
 var (
@@ -23,18 +27,32 @@ type etcdfabFlags struct {
 	Command            string
 	ConfigFilePath     string
 	LinkConfigFilePath string
+	BackupFilePath     string
+	LogLevel           string
 }
 
 func main() {
 	flags := parseFlags()
 
-	logger := lager.NewLogger("etcdfab")
-	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.INFO))
+	// status prints its report on stdout, so its logs go to stderr instead.
+	logWriter := os.Stdout
+	if flags.Command == "status" {
+		logWriter = os.Stderr
+	}
+
+	logger, err := logging.NewLogger(flags.Command, flags.LogLevel, logWriter)
+	if err != nil {
+		stderr := log.New(os.Stderr, "", 0)
+		stderr.Printf("Error: %s", err)
+		os.Exit(1)
+	}
 
-	commandWrapper := command.NewWrapper()
-	etcdClient := client.NewEtcdClient(logger)
-	clusterController := cluster.NewController(etcdClient, logger, sleep)
-	syncController := sync.NewController(etcdClient, logger, sleep)
+	registry := metrics.NewRegistry()
+	commandWrapper := command.NewWrapper(logger)
+	etcdClient := client.NewClient(logger)
+	clusterController := cluster.NewController(etcdClient, logger, registry, sleep)
+	syncController := sync.NewController(etcdClient, logger, registry, sleep)
+	preflightRunner := preflight.NewRunner(preflight.DefaultChecks(commandWrapper), logger)
 
 	app := application.New(application.NewArgs{
 		Command:            commandWrapper,
@@ -43,30 +61,80 @@ func main() {
 		EtcdClient:         etcdClient,
 		ClusterController:  clusterController,
 		SyncController:     syncController,
+		Preflight:          preflightRunner,
 		OutWriter:          os.Stdout,
 		ErrWriter:          os.Stderr,
 		Logger:             logger,
+		Metrics:            registry,
+		Sleep:              sleep,
+		Now:                time.Now,
 	})
 
-	switch os.Args[1] {
+	switch flags.Command {
 	case "start":
-		err := app.Start()
+		err := app.Start(signalContext())
 		if err != nil {
 			stderr := log.New(os.Stderr, "", 0)
 			stderr.Printf("Error during start: %s", err)
 			os.Exit(1)
 		}
+	case "run":
+		err := app.Run(signalContext())
+		if err != nil {
+			stderr := log.New(os.Stderr, "", 0)
+			stderr.Printf("Error during run: %s", err)
+			os.Exit(1)
+		}
 	case "stop":
-		err := app.Stop()
+		err := app.Stop(signalContext())
 		if err != nil {
 			stderr := log.New(os.Stderr, "", 0)
 			stderr.Printf("Error during stop: %s", err)
 			os.Exit(1)
 		}
+	case "preflight":
+		err := app.Preflight()
+		if err != nil {
+			stderr := log.New(os.Stderr, "", 0)
+			stderr.Printf("Error during preflight: %s", err)
+			os.Exit(1)
+		}
+	case "status":
+		err := app.Status(signalContext())
+		if err != nil {
+			stderr := log.New(os.Stderr, "", 0)
+			stderr.Printf("Error during status: %s", err)
+			os.Exit(1)
+		}
+	case "serve":
+		err := app.Serve(signalContext())
+		if err != nil {
+			stderr := log.New(os.Stderr, "", 0)
+			stderr.Printf("Error during serve: %s", err)
+			os.Exit(1)
+		}
+	case "backup":
+		requireBackupFile(flags)
+
+		err := app.Backup(signalContext(), flags.BackupFilePath)
+		if err != nil {
+			stderr := log.New(os.Stderr, "", 0)
+			stderr.Printf("Error during backup: %s", err)
+			os.Exit(1)
+		}
+	case "restore":
+		requireBackupFile(flags)
+
+		err := app.Restore(signalContext(), flags.BackupFilePath)
+		if err != nil {
+			stderr := log.New(os.Stderr, "", 0)
+			stderr.Printf("Error during restore: %s", err)
+			os.Exit(1)
+		}
 	default:
 		stderr := log.New(os.Stderr, "", 0)
 		stderr.Printf("Usage: etcdfab COMMAND OPTIONS\n")
-		stderr.Printf("COMMAND: \"start\" or \"stop\"")
+		stderr.Printf("COMMAND: \"start\", \"run\", \"stop\", \"preflight\", \"status\", \"serve\", \"backup\" or \"restore\"")
 		os.Exit(1)
 	}
 }
@@ -76,11 +144,13 @@ func parseFlags() etcdfabFlags {
 	flagSet := flag.NewFlagSet("flags", flag.ContinueOnError)
 	flagSet.StringVar(&flags.ConfigFilePath, "config-file", "", "Path to the etcdfab config file. Generated by the etcd-release using BOSH deployment manifest properties.")
 	flagSet.StringVar(&flags.LinkConfigFilePath, "config-link-file", "", "Path to the etcdfab link config file. This will override any properties with bosh links.")
+	flagSet.StringVar(&flags.BackupFilePath, "backup-file", "", "Path to the backup archive written by \"backup\" and read by \"restore\".")
+	flagSet.StringVar(&flags.LogLevel, "log-level", "info", "Minimum level of the lines logged: \"debug\", \"info\", \"error\" or \"fatal\".")
 
 	if len(os.Args) < 3 {
 		stderr := log.New(os.Stderr, "", 0)
 		stderr.Printf("Usage: etcdfab COMMAND OPTIONS")
-		stderr.Printf("COMMAND: \"start\" or \"stop\"")
+		stderr.Printf("COMMAND: \"start\", \"run\", \"stop\", \"preflight\", \"status\", \"serve\", \"backup\" or \"restore\"")
 		stderr.Printf("OPTIONS:")
 		flagSet.PrintDefaults()
 		os.Exit(1)
@@ -89,10 +159,35 @@ func parseFlags() etcdfabFlags {
 	if err := flagSet.Parse(os.Args[2:]); err != nil {
 		os.Exit(1)
 	}
+	flags.Command = os.Args[1]
 
 	return flags
 }
 
+func requireBackupFile(flags etcdfabFlags) {
+	if flags.BackupFilePath == "" {
+		stderr := log.New(os.Stderr, "", 0)
+		stderr.Printf("Error: --backup-file is required for %q", flags.Command)
+		os.Exit(1)
+	}
+}
+
+// signalContext is cancelled when etcdfab receives SIGTERM or SIGINT, so that
+// a command monit gives up on stops talking to the cluster and cleans up
+// instead of being interrupted halfway.
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	return ctx
+}
+
 func sleep(duration time.Duration) {
 	if disableDelay == "true" {
 		return
@@ -2,6 +2,7 @@ package main_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -124,6 +126,47 @@ var _ = Describe("EtcdFab", func() {
 				etcdServer.Exit()
 			})
 
+			It("tags every line with the command and the same run id", func() {
+				session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(session, 30*time.Second).Should(gexec.Exit(0))
+
+				var runIDs []string
+				for _, line := range strings.Split(string(session.Out.Contents()), "\n") {
+					var logLine struct {
+						Message string                 `json:"message"`
+						Data    map[string]interface{} `json:"data"`
+					}
+					if json.Unmarshal([]byte(line), &logLine) != nil {
+						continue
+					}
+
+					Expect(logLine.Message).To(HavePrefix("etcdfab."))
+					Expect(logLine.Data["command"]).To(Equal("start"))
+					runIDs = append(runIDs, logLine.Data["run-id"].(string))
+				}
+
+				Expect(runIDs).NotTo(BeEmpty())
+				for _, runID := range runIDs {
+					Expect(runID).To(Equal(runIDs[0]))
+				}
+
+				etcdServer.Exit()
+			})
+
+			It("leaves out lines below the configured log level", func() {
+				etcdFabCommand.Args = append(etcdFabCommand.Args, "--log-level", "error")
+
+				session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(session, 30*time.Second).Should(gexec.Exit(0))
+
+				Expect(string(session.Out.Contents())).NotTo(ContainSubstring("application.build-etcd-flags"))
+				Expect(string(session.Out.Contents())).To(ContainSubstring("starting fake etcd"))
+
+				etcdServer.Exit()
+			})
+
 			Context("when etcd cluster is synced", func() {
 				It("writes a pid and exits 0", func() {
 					session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
@@ -186,10 +229,24 @@ var _ = Describe("EtcdFab", func() {
 								"name": "some-name-1",
 								"peerURLs": [
 									"http://some-other-external-ip:7001"
+								],
+								"clientURLs": [
+									"http://127.0.0.1:4001"
 								]
 							}
 						]
 					}`, http.StatusOK)
+					etcdServer.SetSelfStatsReturn(`{"id": "some-id", "leaderInfo": {"leader": "some-id"}}`, http.StatusOK)
+					etcdServer.SetLeaderReturn(`{
+						"id": "some-id",
+						"name": "some-name-1",
+						"peerURLs": [
+							"http://some-other-external-ip:7001"
+						],
+						"clientURLs": [
+							"http://127.0.0.1:4001"
+						]
+					}`, http.StatusOK)
 					etcdServer.SetAddMemberReturn(`{
 						"id": "some-name-3",
 						"peerURLs": [
@@ -309,6 +366,32 @@ var _ = Describe("EtcdFab", func() {
 				Expect(string(session.Out.Contents())).To(ContainSubstring("stopping fake etcd"))
 				Expect(string(session.Err.Contents())).To(ContainSubstring("fake error in stderr"))
 			})
+
+			It("passes the tls preflight checks against the fixture certs", func() {
+				session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(session, 30*time.Second).Should(gexec.Exit(0))
+
+				var passedChecks []string
+				for _, line := range strings.Split(string(session.Out.Contents()), "\n") {
+					var logLine struct {
+						Message string                 `json:"message"`
+						Data    map[string]interface{} `json:"data"`
+					}
+					if json.Unmarshal([]byte(line), &logLine) != nil {
+						continue
+					}
+
+					Expect(logLine.Message).NotTo(Equal("etcdfab.preflight.check.failed"))
+					if logLine.Message == "etcdfab.preflight.check.passed" {
+						passedChecks = append(passedChecks, logLine.Data["check"].(string))
+					}
+				}
+
+				Expect(passedChecks).To(ContainElement("tls"))
+				Expect(passedChecks).To(ContainElement("cert-expiry"))
+				Expect(etcdBackendServer.GetCallCount()).To(Equal(1))
+			})
 		})
 
 		Context("failure cases", func() {
@@ -340,6 +423,17 @@ var _ = Describe("EtcdFab", func() {
 				})
 			})
 
+			Context("when an unknown log level is provided", func() {
+				It("exits 1 and prints an error", func() {
+					etcdFabCommand.Args = append(etcdFabCommand.Args, "--log-level", "verbose")
+					session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
+					Expect(err).NotTo(HaveOccurred())
+					Eventually(session, 10*time.Second).Should(gexec.Exit(1))
+
+					Expect(string(session.Err.Contents())).To(ContainSubstring(`Error: unknown log level "verbose"`))
+				})
+			})
+
 			Context("when the etcd process fails", func() {
 				BeforeEach(func() {
 					etcdBackendServer.EnableFastFail()
@@ -376,6 +470,277 @@ var _ = Describe("EtcdFab", func() {
 		})
 	})
 
+	Context("when running", func() {
+		var etcdServer *etcdserver.EtcdServer
+
+		BeforeEach(func() {
+			etcdServer = etcdserver.NewEtcdServer(!startTLS, "")
+			etcdServer.SetKeysReturn(http.StatusOK)
+
+			writeConfigurationFile(linkConfigFile.Name(), map[string]interface{}{
+				"etcd_path": pathToFakeEtcd,
+				"run_dir":   runDir,
+				"heartbeat_interval_in_milliseconds": 10,
+				"election_timeout_in_milliseconds":   20,
+				"peer_require_ssl":                   false,
+				"peer_ip":                            "some-peer-ip",
+				"require_ssl":                        false,
+				"client_ip":                          "some-client-ip",
+				"machines":                           []string{"127.0.0.1"},
+				"supervise_max_restarts":             1,
+			})
+
+			etcdFabCommand = exec.Command(pathToEtcdFab,
+				"run",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+			)
+		})
+
+		AfterEach(func() {
+			etcdServer.Exit()
+		})
+
+		It("restarts etcd when it exits until the crash budget is exhausted", func() {
+			session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, 30*time.Second).Should(gexec.Exit(1))
+
+			Expect(etcdBackendServer.GetCallCount()).To(Equal(2))
+			Expect(string(session.Out.Contents())).To(ContainSubstring("application.run.restart"))
+			Expect(string(session.Err.Contents())).To(ContainSubstring("Error during run: etcd exited 2 times, exceeding the crash budget of 1 restarts"))
+			Expect(filepath.Join(runDir, "etcd.pid")).NotTo(BeARegularFile())
+		})
+
+		It("kills etcd and exits 0 when it receives a SIGTERM", func() {
+			session, err := gexec.Start(etcdFabCommand, GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+
+			pidFile := filepath.Join(runDir, "etcd.pid")
+			Eventually(pidFile, COMMAND_TIMEOUT).Should(BeARegularFile())
+			Eventually(etcdBackendServer.GetCallCount, COMMAND_TIMEOUT).Should(Equal(1))
+
+			session.Terminate()
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(0))
+
+			Expect(etcdBackendServer.GetCallCount()).To(Equal(1))
+			Expect(pidFile).NotTo(BeARegularFile())
+		})
+	})
+
+	Context("when running preflight checks", func() {
+		BeforeEach(func() {
+			writeConfigurationFile(linkConfigFile.Name(), map[string]interface{}{
+				"run_dir":     runDir,
+				"require_ssl": false,
+				"machines":    []string{"127.0.0.1"},
+			})
+		})
+
+		It("runs the checks without starting etcd", func() {
+			session, err := gexec.Start(exec.Command(pathToEtcdFab,
+				"preflight",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(0))
+
+			Expect(string(session.Out.Contents())).To(ContainSubstring("preflight.check.passed"))
+			Expect(string(session.Out.Contents())).NotTo(ContainSubstring("application.start"))
+		})
+
+		It("fails when etcd is already running", func() {
+			etcdSession, err := gexec.Start(exec.Command(pathToFakeEtcd), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			defer etcdSession.Kill()
+
+			pid := etcdSession.Command.Process.Pid
+			Expect(ioutil.WriteFile(filepath.Join(runDir, "etcd.pid"), []byte(strconv.Itoa(pid)), 0644)).To(Succeed())
+
+			session, err := gexec.Start(exec.Command(pathToEtcdFab,
+				"preflight",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(1))
+
+			Expect(string(session.Err.Contents())).To(ContainSubstring("Error during preflight: preflight check pid-file failed: etcd is already running with pid " + strconv.Itoa(pid)))
+		})
+
+		It("removes a pid file left behind by another program", func() {
+			pidFile := filepath.Join(runDir, "etcd.pid")
+			Expect(ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644)).To(Succeed())
+
+			session, err := gexec.Start(exec.Command(pathToEtcdFab,
+				"preflight",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(0))
+
+			Expect(pidFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("when reporting status", func() {
+		var etcdServer *etcdserver.EtcdServer
+
+		BeforeEach(func() {
+			etcdServer = etcdserver.NewEtcdServer(!startTLS, "")
+			etcdServer.SetMembersReturn(`{
+				"members": [
+					{
+						"id": "some-id",
+						"name": "some-name-3",
+						"peerURLs": [
+							"http://127.0.0.1:7001"
+						],
+						"clientURLs": [
+							"http://127.0.0.1:4001"
+						]
+					}
+				]
+			}`, http.StatusOK)
+			etcdServer.SetLeaderReturn(`{
+				"id": "some-id",
+				"name": "some-name-3",
+				"peerURLs": [
+					"http://127.0.0.1:7001"
+				],
+				"clientURLs": [
+					"http://127.0.0.1:4001"
+				]
+			}`, http.StatusOK)
+
+			writeConfigurationFile(linkConfigFile.Name(), map[string]interface{}{
+				"run_dir":     runDir,
+				"require_ssl": false,
+				"machines":    []string{"127.0.0.1"},
+			})
+		})
+
+		AfterEach(func() {
+			etcdServer.Exit()
+		})
+
+		It("prints a json report on stdout and logs to stderr", func() {
+			session, err := gexec.Start(exec.Command(pathToEtcdFab,
+				"status",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(0))
+
+			var report map[string]interface{}
+			Expect(json.Unmarshal(session.Out.Contents(), &report)).To(Succeed())
+			Expect(report["name"]).To(Equal("some-name-3"))
+			Expect(report["id"]).To(Equal("some-id"))
+			Expect(report["leader"]).To(Equal("some-name-3"))
+			Expect(report["pid_alive"]).To(BeFalse())
+			Expect(report["peer_url_mismatch"]).To(BeFalse())
+			Expect(report["members"]).To(HaveLen(1))
+			Expect(report["members"].([]interface{})[0]).To(HaveKeyWithValue("healthy", true))
+
+			Expect(string(session.Err.Contents())).To(ContainSubstring("etcd-client.configure.config"))
+		})
+	})
+
+	Context("when backing up and restoring", func() {
+		var (
+			dataDir    string
+			backupFile string
+			etcdServer *etcdserver.EtcdServer
+		)
+
+		BeforeEach(func() {
+			etcdServer = etcdserver.NewEtcdServer(!startTLS, "")
+			etcdServer.SetKeysReturn(http.StatusOK)
+			etcdServer.SetMembersReturn(`{
+				"members": [
+					{
+						"id": "some-id",
+						"name": "some-name-3",
+						"peerURLs": [
+							"http://127.0.0.1:7001"
+						]
+					}
+				]
+			}`, http.StatusOK)
+
+			tmpDir, err := ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			dataDir = filepath.Join(tmpDir, "data")
+			Expect(os.MkdirAll(filepath.Join(dataDir, "member", "wal"), os.ModePerm)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dataDir, "member", "wal", "0.wal"), []byte("some-wal"), 0644)).To(Succeed())
+
+			backupFile = filepath.Join(tmpDir, "etcd-backup.tgz")
+
+			writeConfigurationFile(linkConfigFile.Name(), map[string]interface{}{
+				"etcd_path":    pathToFakeEtcd,
+				"etcdctl_path": pathToFakeEtcdctl,
+				"run_dir":      runDir,
+				"data_dir":     dataDir,
+				"heartbeat_interval_in_milliseconds": 10,
+				"election_timeout_in_milliseconds":   20,
+				"peer_require_ssl":                   false,
+				"peer_ip":                            "some-peer-ip",
+				"require_ssl":                        false,
+				"client_ip":                          "some-client-ip",
+				"machines":                           []string{"127.0.0.1"},
+			})
+		})
+
+		AfterEach(func() {
+			etcdServer.Exit()
+		})
+
+		It("backs up the data dir and restores it as a new cluster", func() {
+			session, err := gexec.Start(exec.Command(pathToEtcdFab,
+				"backup",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+				"--backup-file", backupFile,
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(0))
+			Expect(backupFile).To(BeARegularFile())
+
+			Expect(os.RemoveAll(filepath.Join(dataDir, "member"))).To(Succeed())
+
+			session, err = gexec.Start(exec.Command(pathToEtcdFab,
+				"restore",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+				"--backup-file", backupFile,
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(0))
+
+			Expect(filepath.Join(dataDir, "member", "wal", "0.wal")).To(BeARegularFile())
+			Expect(filepath.Join(runDir, "etcd.pid")).To(BeARegularFile())
+
+			Eventually(etcdBackendServer.GetCallCount, COMMAND_TIMEOUT).Should(Equal(1))
+			Expect(etcdBackendServer.GetArgs()).To(ContainElement("--force-new-cluster"))
+		})
+
+		It("exits 1 and prints an error when no backup file is provided", func() {
+			session, err := gexec.Start(exec.Command(pathToEtcdFab,
+				"backup",
+				"--config-file", configFile.Name(),
+				"--config-link-file", linkConfigFile.Name(),
+			), GinkgoWriter, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(session, COMMAND_TIMEOUT).Should(gexec.Exit(1))
+
+			Expect(string(session.Err.Contents())).To(ContainSubstring(`Error: --backup-file is required for "backup"`))
+		})
+	})
+
 	Context("when stopping", func() {
 		var (
 			pid        int
@@ -491,7 +856,7 @@ var _ = Describe("EtcdFab", func() {
 
 				usageLines := []string{
 					"Usage: etcdfab COMMAND OPTIONS",
-					"COMMAND: \"start\" or \"stop\"",
+					"COMMAND: \"start\", \"run\", \"stop\", \"preflight\", \"status\", \"serve\", \"backup\" or \"restore\"",
 					"OPTIONS:\n",
 					"-config-file",
 					"Path to the etcdfab config file. Generated by the etcd-release using BOSH deployment manifest properties.",
@@ -513,7 +878,7 @@ var _ = Describe("EtcdFab", func() {
 				cmd.Stderr = buffer
 				Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
 				Expect(buffer.String()).To(ContainSubstring("Usage: etcdfab COMMAND OPTIONS"))
-				Expect(buffer.String()).To(ContainSubstring("COMMAND: \"start\" or \"stop\""))
+				Expect(buffer.String()).To(ContainSubstring("COMMAND: \"start\", \"run\", \"stop\", \"preflight\", \"status\", \"serve\", \"backup\" or \"restore\""))
 			})
 		})
 
@@ -527,7 +892,7 @@ var _ = Describe("EtcdFab", func() {
 				cmd.Stderr = buffer
 				Eventually(cmd.Run, COMMAND_TIMEOUT, COMMAND_TIMEOUT).ShouldNot(Succeed())
 				Expect(buffer.String()).To(ContainSubstring("Usage: etcdfab COMMAND OPTIONS"))
-				Expect(buffer.String()).To(ContainSubstring("COMMAND: \"start\" or \"stop\""))
+				Expect(buffer.String()).To(ContainSubstring("COMMAND: \"start\", \"run\", \"stop\", \"preflight\", \"status\", \"serve\", \"backup\" or \"restore\""))
 			})
 		})
 
@@ -1,6 +1,9 @@
 package fakes
 
 import (
+	"context"
+	"time"
+
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/cluster"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
 )
@@ -9,18 +12,74 @@ type ClusterController struct {
 	GetInitialClusterStateCall struct {
 		CallCount int
 		Receives  struct {
-			Config config.Config
+			Context context.Context
+			Config  config.Config
 		}
 		Returns struct {
 			InitialClusterState cluster.InitialClusterState
 			Error               error
 		}
 	}
+	GetRemovalQuorumCall struct {
+		CallCount int
+		Stub      func() (cluster.RemovalQuorum, error)
+		Receives  struct {
+			Context context.Context
+			Config  config.Config
+		}
+		Returns struct {
+			RemovalQuorum cluster.RemovalQuorum
+			Error         error
+		}
+	}
+	PruneOrphanedMembersCall struct {
+		CallCount int
+		Receives  struct {
+			Config config.Config
+			Now    time.Time
+		}
+		Returns struct {
+			Removed []string
+			Error   error
+		}
+	}
+	ReleaseJoinLockCall struct {
+		CallCount int
+		Receives  struct {
+			Config config.Config
+		}
+	}
 }
 
-func (c *ClusterController) GetInitialClusterState(etcdfabConfig config.Config) (cluster.InitialClusterState, error) {
+func (c *ClusterController) GetInitialClusterState(ctx context.Context, etcdfabConfig config.Config) (cluster.InitialClusterState, error) {
 	c.GetInitialClusterStateCall.CallCount++
+	c.GetInitialClusterStateCall.Receives.Context = ctx
 	c.GetInitialClusterStateCall.Receives.Config = etcdfabConfig
 
 	return c.GetInitialClusterStateCall.Returns.InitialClusterState, c.GetInitialClusterStateCall.Returns.Error
 }
+
+func (c *ClusterController) GetRemovalQuorum(ctx context.Context, etcdfabConfig config.Config) (cluster.RemovalQuorum, error) {
+	c.GetRemovalQuorumCall.CallCount++
+	c.GetRemovalQuorumCall.Receives.Context = ctx
+	c.GetRemovalQuorumCall.Receives.Config = etcdfabConfig
+
+	if c.GetRemovalQuorumCall.Stub != nil {
+		return c.GetRemovalQuorumCall.Stub()
+	}
+
+	return c.GetRemovalQuorumCall.Returns.RemovalQuorum, c.GetRemovalQuorumCall.Returns.Error
+}
+
+func (c *ClusterController) PruneOrphanedMembers(ctx context.Context, etcdfabConfig config.Config, now time.Time) ([]string, error) {
+	c.PruneOrphanedMembersCall.CallCount++
+	c.PruneOrphanedMembersCall.Receives.Config = etcdfabConfig
+	c.PruneOrphanedMembersCall.Receives.Now = now
+
+	return c.PruneOrphanedMembersCall.Returns.Removed, c.PruneOrphanedMembersCall.Returns.Error
+}
+
+func (c *ClusterController) ReleaseJoinLock(ctx context.Context, etcdfabConfig config.Config) {
+	c.ReleaseJoinLockCall.CallCount++
+	c.ReleaseJoinLockCall.Receives.Config = etcdfabConfig
+}
@@ -1,10 +1,17 @@
 package fakes
 
-import "io"
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/command"
+)
 
 type CommandWrapper struct {
 	StartCall struct {
 		CallCount int
+		Stub      func() (int, error)
 		Receives  struct {
 			CommandPath string
 			CommandArgs []string
@@ -26,6 +33,41 @@ type CommandWrapper struct {
 			Error error
 		}
 	}
+
+	StopCall struct {
+		CallCount int
+		Stub      func() (command.StopResult, error)
+		Receives  struct {
+			Pid     int
+			Timeout time.Duration
+		}
+		Returns struct {
+			StopResult command.StopResult
+			Error      error
+		}
+	}
+
+	RunningCall struct {
+		CallCount int
+		Receives  struct {
+			Pid int
+		}
+		Returns struct {
+			Running bool
+		}
+	}
+
+	WaitCall struct {
+		sync.Mutex
+		CallCount int
+		Stub      func(int) error
+		Receives  struct {
+			Pid int
+		}
+		Returns struct {
+			Error error
+		}
+	}
 }
 
 func (c *CommandWrapper) Start(commandPath string, commandArgs []string, outWriter, errWriter io.Writer) (int, error) {
@@ -35,6 +77,10 @@ func (c *CommandWrapper) Start(commandPath string, commandArgs []string, outWrit
 	c.StartCall.Receives.OutWriter = outWriter
 	c.StartCall.Receives.ErrWriter = errWriter
 
+	if c.StartCall.Stub != nil {
+		return c.StartCall.Stub()
+	}
+
 	return c.StartCall.Returns.Pid, c.StartCall.Returns.Error
 }
 
@@ -45,3 +91,37 @@ func (c *CommandWrapper) Kill(pid int) error {
 
 	return c.KillCall.Returns.Error
 }
+
+func (c *CommandWrapper) Stop(pid int, timeout time.Duration) (command.StopResult, error) {
+	c.StopCall.CallCount++
+
+	c.StopCall.Receives.Pid = pid
+	c.StopCall.Receives.Timeout = timeout
+
+	if c.StopCall.Stub != nil {
+		return c.StopCall.Stub()
+	}
+
+	return c.StopCall.Returns.StopResult, c.StopCall.Returns.Error
+}
+
+func (c *CommandWrapper) Wait(pid int) error {
+	c.WaitCall.Lock()
+	c.WaitCall.CallCount++
+	c.WaitCall.Receives.Pid = pid
+	stub := c.WaitCall.Stub
+	c.WaitCall.Unlock()
+
+	if stub != nil {
+		return stub(pid)
+	}
+
+	return c.WaitCall.Returns.Error
+}
+
+func (c *CommandWrapper) Running(pid int) bool {
+	c.RunningCall.CallCount++
+	c.RunningCall.Receives.Pid = pid
+
+	return c.RunningCall.Returns.Running
+}
@@ -13,6 +13,12 @@ type Config struct {
 			Endpoints []string
 		}
 	}
+	EtcdClientAPICall struct {
+		CallCount int
+		Returns   struct {
+			API string
+		}
+	}
 	RequireSSLCall struct {
 		CallCount int
 		Returns   struct {
@@ -39,6 +45,12 @@ func (c *Config) EtcdClientEndpoints() []string {
 	return c.EtcdClientEndpointsCall.Returns.Endpoints
 }
 
+func (c *Config) EtcdClientAPI() string {
+	c.EtcdClientAPICall.CallCount++
+
+	return c.EtcdClientAPICall.Returns.API
+}
+
 func (c *Config) RequireSSL() bool {
 	c.RequireSSLCall.CallCount++
 
@@ -1,6 +1,9 @@
 package fakes
 
 import (
+	"context"
+	"time"
+
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
 )
 
@@ -21,8 +24,15 @@ type EtcdClient struct {
 			Error      error
 		}
 	}
+	CloseCall struct {
+		CallCount int
+		Returns   struct {
+			Error error
+		}
+	}
 	MemberListCall struct {
 		CallCount int
+		Stub      func() ([]client.Member, error)
 		Returns   struct {
 			MemberList []client.Member
 			Error      error
@@ -38,6 +48,24 @@ type EtcdClient struct {
 			Error  error
 		}
 	}
+	LeaderCall struct {
+		CallCount int
+		Stub      func() (client.Member, error)
+		Returns   struct {
+			Leader client.Member
+			Error  error
+		}
+	}
+	MemberUpdateCall struct {
+		CallCount int
+		Receives  struct {
+			MemberID string
+			PeerURL  string
+		}
+		Returns struct {
+			Error error
+		}
+	}
 	MemberRemoveCall struct {
 		CallCount int
 		Receives  struct {
@@ -47,6 +75,73 @@ type EtcdClient struct {
 			Error error
 		}
 	}
+	EndpointHealthCall struct {
+		CallCount int
+		Stub      func(string) (bool, error)
+		Receives  struct {
+			Endpoints []string
+		}
+		Returns struct {
+			Healthy bool
+			Error   error
+		}
+	}
+	EndpointLeaderCall struct {
+		CallCount int
+		Stub      func(string) (string, error)
+		Receives  struct {
+			Endpoints []string
+		}
+		Returns struct {
+			Leader string
+			Error  error
+		}
+	}
+	EndpointStatusCall struct {
+		CallCount int
+		Stub      func(string) (client.EndpointStatus, error)
+		Receives  struct {
+			Endpoint string
+		}
+		Returns struct {
+			EndpointStatus client.EndpointStatus
+			Error          error
+		}
+	}
+	KeyCreateCall struct {
+		CallCount int
+		Stub      func(string, string, time.Duration) (bool, error)
+		Receives  struct {
+			Key   string
+			Value string
+			TTL   time.Duration
+		}
+		Returns struct {
+			Created bool
+			Error   error
+		}
+	}
+	KeyGetCall struct {
+		CallCount int
+		Receives  struct {
+			Key string
+		}
+		Returns struct {
+			Value string
+			Error error
+		}
+	}
+	KeyCompareAndDeleteCall struct {
+		CallCount int
+		Receives  struct {
+			Key   string
+			Value string
+		}
+		Returns struct {
+			Deleted bool
+			Error   error
+		}
+	}
 	KeysCall struct {
 		CallCount int
 		Stub      func() error
@@ -54,6 +149,34 @@ type EtcdClient struct {
 			Error error
 		}
 	}
+	HealthCall struct {
+		CallCount int
+		Returns   struct {
+			Healthy bool
+			Error   error
+		}
+	}
+	VersionCall struct {
+		CallCount int
+		Returns   struct {
+			Version client.Version
+			Error   error
+		}
+	}
+	SelfStatsCall struct {
+		CallCount int
+		Returns   struct {
+			SelfStats client.SelfStats
+			Error     error
+		}
+	}
+	LeaderStatsCall struct {
+		CallCount int
+		Returns   struct {
+			LeaderStats client.LeaderStats
+			Error       error
+		}
+	}
 }
 
 func (e *EtcdClient) Configure(config client.Config) error {
@@ -69,27 +192,55 @@ func (e *EtcdClient) Self() (client.EtcdClientInterface, error) {
 	return e.SelfCall.Returns.EtcdClient, e.SelfCall.Returns.Error
 }
 
-func (e *EtcdClient) MemberList() ([]client.Member, error) {
+func (e *EtcdClient) Close() error {
+	e.CloseCall.CallCount++
+
+	return e.CloseCall.Returns.Error
+}
+
+func (e *EtcdClient) MemberList(ctx context.Context) ([]client.Member, error) {
 	e.MemberListCall.CallCount++
 
+	if e.MemberListCall.Stub != nil {
+		return e.MemberListCall.Stub()
+	}
+
 	return e.MemberListCall.Returns.MemberList, e.MemberListCall.Returns.Error
 }
 
-func (e *EtcdClient) MemberAdd(peerURL string) (client.Member, error) {
+func (e *EtcdClient) MemberAdd(ctx context.Context, peerURL string) (client.Member, error) {
 	e.MemberAddCall.CallCount++
 	e.MemberAddCall.Receives.PeerURL = peerURL
 
 	return e.MemberAddCall.Returns.Member, e.MemberAddCall.Returns.Error
 }
 
-func (e *EtcdClient) MemberRemove(memberID string) error {
+func (e *EtcdClient) Leader(ctx context.Context) (client.Member, error) {
+	e.LeaderCall.CallCount++
+
+	if e.LeaderCall.Stub != nil {
+		return e.LeaderCall.Stub()
+	}
+
+	return e.LeaderCall.Returns.Leader, e.LeaderCall.Returns.Error
+}
+
+func (e *EtcdClient) MemberUpdate(ctx context.Context, memberID, peerURL string) error {
+	e.MemberUpdateCall.CallCount++
+	e.MemberUpdateCall.Receives.MemberID = memberID
+	e.MemberUpdateCall.Receives.PeerURL = peerURL
+
+	return e.MemberUpdateCall.Returns.Error
+}
+
+func (e *EtcdClient) MemberRemove(ctx context.Context, memberID string) error {
 	e.MemberRemoveCall.CallCount++
 	e.MemberRemoveCall.Receives.MemberID = memberID
 
 	return e.MemberRemoveCall.Returns.Error
 }
 
-func (e *EtcdClient) Keys() error {
+func (e *EtcdClient) Keys(ctx context.Context) error {
 	e.KeysCall.CallCount++
 
 	if e.KeysCall.Stub != nil {
@@ -98,3 +249,88 @@ func (e *EtcdClient) Keys() error {
 
 	return e.KeysCall.Returns.Error
 }
+
+func (e *EtcdClient) Health(ctx context.Context) (bool, error) {
+	e.HealthCall.CallCount++
+
+	return e.HealthCall.Returns.Healthy, e.HealthCall.Returns.Error
+}
+
+func (e *EtcdClient) Version(ctx context.Context) (client.Version, error) {
+	e.VersionCall.CallCount++
+
+	return e.VersionCall.Returns.Version, e.VersionCall.Returns.Error
+}
+
+func (e *EtcdClient) SelfStats(ctx context.Context) (client.SelfStats, error) {
+	e.SelfStatsCall.CallCount++
+
+	return e.SelfStatsCall.Returns.SelfStats, e.SelfStatsCall.Returns.Error
+}
+
+func (e *EtcdClient) LeaderStats(ctx context.Context) (client.LeaderStats, error) {
+	e.LeaderStatsCall.CallCount++
+
+	return e.LeaderStatsCall.Returns.LeaderStats, e.LeaderStatsCall.Returns.Error
+}
+
+func (e *EtcdClient) EndpointHealth(ctx context.Context, endpoint string) (bool, error) {
+	e.EndpointHealthCall.CallCount++
+	e.EndpointHealthCall.Receives.Endpoints = append(e.EndpointHealthCall.Receives.Endpoints, endpoint)
+
+	if e.EndpointHealthCall.Stub != nil {
+		return e.EndpointHealthCall.Stub(endpoint)
+	}
+
+	return e.EndpointHealthCall.Returns.Healthy, e.EndpointHealthCall.Returns.Error
+}
+
+func (e *EtcdClient) EndpointLeader(ctx context.Context, endpoint string) (string, error) {
+	e.EndpointLeaderCall.CallCount++
+	e.EndpointLeaderCall.Receives.Endpoints = append(e.EndpointLeaderCall.Receives.Endpoints, endpoint)
+
+	if e.EndpointLeaderCall.Stub != nil {
+		return e.EndpointLeaderCall.Stub(endpoint)
+	}
+
+	return e.EndpointLeaderCall.Returns.Leader, e.EndpointLeaderCall.Returns.Error
+}
+
+func (e *EtcdClient) EndpointStatus(ctx context.Context, endpoint string) (client.EndpointStatus, error) {
+	e.EndpointStatusCall.CallCount++
+	e.EndpointStatusCall.Receives.Endpoint = endpoint
+
+	if e.EndpointStatusCall.Stub != nil {
+		return e.EndpointStatusCall.Stub(endpoint)
+	}
+
+	return e.EndpointStatusCall.Returns.EndpointStatus, e.EndpointStatusCall.Returns.Error
+}
+
+func (e *EtcdClient) KeyCreate(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	e.KeyCreateCall.CallCount++
+	e.KeyCreateCall.Receives.Key = key
+	e.KeyCreateCall.Receives.Value = value
+	e.KeyCreateCall.Receives.TTL = ttl
+
+	if e.KeyCreateCall.Stub != nil {
+		return e.KeyCreateCall.Stub(key, value, ttl)
+	}
+
+	return e.KeyCreateCall.Returns.Created, e.KeyCreateCall.Returns.Error
+}
+
+func (e *EtcdClient) KeyGet(ctx context.Context, key string) (string, error) {
+	e.KeyGetCall.CallCount++
+	e.KeyGetCall.Receives.Key = key
+
+	return e.KeyGetCall.Returns.Value, e.KeyGetCall.Returns.Error
+}
+
+func (e *EtcdClient) KeyCompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	e.KeyCompareAndDeleteCall.CallCount++
+	e.KeyCompareAndDeleteCall.Receives.Key = key
+	e.KeyCompareAndDeleteCall.Receives.Value = value
+
+	return e.KeyCompareAndDeleteCall.Returns.Deleted, e.KeyCompareAndDeleteCall.Returns.Error
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The fake etcdctl only knows backup, which it fakes by copying the data dir
+// to the backup dir.
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "backup" {
+		fmt.Fprintf(os.Stderr, "fake etcdctl does not support %q\n", os.Args[1:])
+		os.Exit(1)
+	}
+
+	var dataDir, backupDir string
+	flagSet := flag.NewFlagSet("backup", flag.ExitOnError)
+	flagSet.StringVar(&dataDir, "data-dir", "", "")
+	flagSet.StringVar(&backupDir, "backup-dir", "", "")
+	flagSet.Bool("with-v3", false, "")
+	flagSet.Parse(os.Args[2:])
+
+	err := filepath.Walk(dataDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dataDir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(backupDir, relPath)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, contents, 0600)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
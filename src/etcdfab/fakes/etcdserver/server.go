@@ -3,11 +3,13 @@ package etcdserver
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 )
 
@@ -28,6 +30,21 @@ type etcdBackend struct {
 	removeMemberStatusCode int
 	keysStatusCode         int
 	keysJSON               string
+	healthStatusCode       int
+	healthJSON             string
+	versionStatusCode      int
+	versionJSON            string
+	updateMemberStatusCode int
+	clusterID              string
+	raftIndex              string
+	raftTerm               string
+	leaderJSON             string
+	leaderStatusCode       int
+	selfStatsJSON          string
+	selfStatsStatusCode    int
+	leaderStatsJSON        string
+	leaderStatsStatusCode  int
+	keys                   map[string]string
 }
 
 func NewEtcdServer(startTLS bool, certDir string) *EtcdServer {
@@ -83,6 +100,20 @@ func (e *EtcdServer) Reset() {
 		membersStatusCode:      http.StatusOK,
 		addMemberStatusCode:    http.StatusCreated,
 		removeMemberStatusCode: http.StatusNoContent,
+		healthStatusCode:       http.StatusOK,
+		healthJSON:             `{"health": "true"}`,
+		versionStatusCode:      http.StatusOK,
+		versionJSON:            `{"etcdserver": "2.3.8", "etcdcluster": "2.3.0"}`,
+		updateMemberStatusCode: http.StatusNoContent,
+		clusterID:              "cdf818194e3a8c32",
+		raftIndex:              "1234",
+		raftTerm:               "5",
+		leaderStatusCode:       http.StatusOK,
+		selfStatsJSON:          `{"id": "some-id", "leaderInfo": {"leader": "some-leader-id"}}`,
+		selfStatsStatusCode:    http.StatusOK,
+		leaderStatsJSON:        `{"leader": "some-leader-id", "followers": {"some-follower-id": {"latency": {"current": 0.5}, "counts": {"fail": 1, "success": 42}}}}`,
+		leaderStatsStatusCode:  http.StatusOK,
+		keys:                   map[string]string{},
 	}
 }
 
@@ -90,10 +121,24 @@ func (e *EtcdServer) ServeHTTP(responseWriter http.ResponseWriter, request *http
 	switch request.URL.Path {
 	case "/v2/members":
 		e.handleMembers(responseWriter, request)
+	case "/v2/members/leader":
+		e.handleLeader(responseWriter, request)
 	case "/v2/members/member-id":
 		e.handleRemoveMember(responseWriter, request)
 	case "/v2/keys":
 		e.handleKeys(responseWriter, request)
+	case "/health":
+		e.handleHealth(responseWriter, request)
+	case "/version":
+		e.handleVersion(responseWriter, request)
+	case "/v2/stats/self":
+		e.handleSelfStats(responseWriter, request)
+	case "/v2/stats/leader":
+		e.handleLeaderStats(responseWriter, request)
+	default:
+		if strings.HasPrefix(request.URL.Path, "/v2/keys/") {
+			e.handleKey(responseWriter, request)
+		}
 	}
 }
 
@@ -118,10 +163,23 @@ func (e *EtcdServer) handleRemoveMember(responseWriter http.ResponseWriter, requ
 	e.backendMutex.Lock()
 	defer e.backendMutex.Unlock()
 
+	if request.Method == "PUT" {
+		responseWriter.WriteHeader(e.backend.updateMemberStatusCode)
+		return
+	}
+
 	responseWriter.WriteHeader(e.backend.removeMemberStatusCode)
 	responseWriter.Write([]byte(e.backend.removeMemberJSON))
 }
 
+func (e *EtcdServer) handleLeader(responseWriter http.ResponseWriter, request *http.Request) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	responseWriter.WriteHeader(e.backend.leaderStatusCode)
+	responseWriter.Write([]byte(e.backend.leaderJSON))
+}
+
 func (e *EtcdServer) handleKeys(responseWriter http.ResponseWriter, request *http.Request) {
 	e.backendMutex.Lock()
 	defer e.backendMutex.Unlock()
@@ -133,10 +191,112 @@ func (e *EtcdServer) handleKeys(responseWriter http.ResponseWriter, request *htt
 		status = e.backend.keysStatusCode
 	}
 
+	responseWriter.Header().Set("X-Etcd-Cluster-Id", e.backend.clusterID)
+	responseWriter.Header().Set("X-Raft-Index", e.backend.raftIndex)
+	responseWriter.Header().Set("X-Raft-Term", e.backend.raftTerm)
 	responseWriter.WriteHeader(status)
 	responseWriter.Write(body)
 }
 
+func (e *EtcdServer) handleHealth(responseWriter http.ResponseWriter, request *http.Request) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	responseWriter.WriteHeader(e.backend.healthStatusCode)
+	responseWriter.Write([]byte(e.backend.healthJSON))
+}
+
+func (e *EtcdServer) handleVersion(responseWriter http.ResponseWriter, request *http.Request) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	responseWriter.WriteHeader(e.backend.versionStatusCode)
+	responseWriter.Write([]byte(e.backend.versionJSON))
+}
+
+// handleKey keeps single keys in memory and implements just enough of the
+// keys API for create, get and compare-and-delete.
+func (e *EtcdServer) handleKey(responseWriter http.ResponseWriter, request *http.Request) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	key := strings.TrimPrefix(request.URL.Path, "/v2/keys")
+	value, exists := e.backend.keys[key]
+
+	err := request.ParseForm()
+	if err != nil {
+		writeKeysError(responseWriter, http.StatusBadRequest, 209, err.Error())
+		return
+	}
+
+	switch request.Method {
+	case "GET":
+		if !exists {
+			writeKeysError(responseWriter, http.StatusNotFound, 100, "Key not found")
+			return
+		}
+		writeKeysNode(responseWriter, http.StatusOK, "get", key, value)
+	case "PUT":
+		if request.Form.Get("prevExist") == "false" && exists {
+			writeKeysError(responseWriter, http.StatusPreconditionFailed, 105, "Key already exists")
+			return
+		}
+		e.backend.keys[key] = request.Form.Get("value")
+		writeKeysNode(responseWriter, http.StatusCreated, "create", key, request.Form.Get("value"))
+	case "DELETE":
+		if !exists {
+			writeKeysError(responseWriter, http.StatusNotFound, 100, "Key not found")
+			return
+		}
+		if prevValue := request.Form.Get("prevValue"); prevValue != "" && prevValue != value {
+			writeKeysError(responseWriter, http.StatusPreconditionFailed, 101, "Compare failed")
+			return
+		}
+		delete(e.backend.keys, key)
+		writeKeysNode(responseWriter, http.StatusOK, "delete", key, "")
+	}
+}
+
+func writeKeysNode(responseWriter http.ResponseWriter, statusCode int, action, key, value string) {
+	responseWriter.Header().Set("X-Etcd-Index", "1")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(map[string]interface{}{
+		"action": action,
+		"node": map[string]interface{}{
+			"key":           key,
+			"value":         value,
+			"modifiedIndex": 1,
+			"createdIndex":  1,
+		},
+	})
+}
+
+func writeKeysError(responseWriter http.ResponseWriter, statusCode, errorCode int, message string) {
+	responseWriter.Header().Set("X-Etcd-Index", "1")
+	responseWriter.WriteHeader(statusCode)
+	json.NewEncoder(responseWriter).Encode(map[string]interface{}{
+		"errorCode": errorCode,
+		"message":   message,
+		"index":     1,
+	})
+}
+
+func (e *EtcdServer) handleSelfStats(responseWriter http.ResponseWriter, request *http.Request) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	responseWriter.WriteHeader(e.backend.selfStatsStatusCode)
+	responseWriter.Write([]byte(e.backend.selfStatsJSON))
+}
+
+func (e *EtcdServer) handleLeaderStats(responseWriter http.ResponseWriter, request *http.Request) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	responseWriter.WriteHeader(e.backend.leaderStatsStatusCode)
+	responseWriter.Write([]byte(e.backend.leaderStatsJSON))
+}
+
 func (e *EtcdServer) URL() string {
 	return e.server.URL
 }
@@ -172,3 +332,74 @@ func (e *EtcdServer) SetRemoveMemberReturn(statusCode int) {
 	e.backend.removeMemberJSON = "{}"
 	e.backend.removeMemberStatusCode = statusCode
 }
+
+func (e *EtcdServer) SetHealthReturn(healthJSON string, statusCode int) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.healthJSON = healthJSON
+	e.backend.healthStatusCode = statusCode
+}
+
+func (e *EtcdServer) SetVersionReturn(versionJSON string, statusCode int) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.versionJSON = versionJSON
+	e.backend.versionStatusCode = statusCode
+}
+
+func (e *EtcdServer) SetUpdateMemberReturn(statusCode int) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.updateMemberStatusCode = statusCode
+}
+
+func (e *EtcdServer) SetRaftStatus(clusterID, raftIndex, raftTerm string) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.clusterID = clusterID
+	e.backend.raftIndex = raftIndex
+	e.backend.raftTerm = raftTerm
+}
+
+func (e *EtcdServer) SetLeaderReturn(leaderJSON string, statusCode int) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.leaderJSON = leaderJSON
+	e.backend.leaderStatusCode = statusCode
+}
+
+func (e *EtcdServer) SetSelfStatsReturn(selfStatsJSON string, statusCode int) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.selfStatsJSON = selfStatsJSON
+	e.backend.selfStatsStatusCode = statusCode
+}
+
+func (e *EtcdServer) SetLeaderStatsReturn(leaderStatsJSON string, statusCode int) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.leaderStatsJSON = leaderStatsJSON
+	e.backend.leaderStatsStatusCode = statusCode
+}
+
+func (e *EtcdServer) SetKey(key, value string) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	e.backend.keys[key] = value
+}
+
+func (e *EtcdServer) GetKey(key string) (string, bool) {
+	e.backendMutex.Lock()
+	defer e.backendMutex.Unlock()
+
+	value, ok := e.backend.keys[key]
+	return value, ok
+}
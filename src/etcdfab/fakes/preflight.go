@@ -0,0 +1,22 @@
+package fakes
+
+import "github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+
+type Preflight struct {
+	RunCall struct {
+		CallCount int
+		Receives  struct {
+			Config config.Config
+		}
+		Returns struct {
+			Error error
+		}
+	}
+}
+
+func (p *Preflight) Run(etcdfabConfig config.Config) error {
+	p.RunCall.CallCount++
+	p.RunCall.Receives.Config = etcdfabConfig
+
+	return p.RunCall.Returns.Error
+}
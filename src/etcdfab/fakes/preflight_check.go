@@ -0,0 +1,34 @@
+package fakes
+
+import (
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+)
+
+type PreflightCheck struct {
+	NameCall struct {
+		Returns struct {
+			Name string
+		}
+	}
+	RunCall struct {
+		CallCount int
+		Receives  struct {
+			Config config.Config
+		}
+		Returns struct {
+			Result preflight.Result
+		}
+	}
+}
+
+func (c *PreflightCheck) Name() string {
+	return c.NameCall.Returns.Name
+}
+
+func (c *PreflightCheck) Run(etcdfabConfig config.Config) preflight.Result {
+	c.RunCall.CallCount++
+	c.RunCall.Receives.Config = etcdfabConfig
+
+	return c.RunCall.Returns.Result
+}
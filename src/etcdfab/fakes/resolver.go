@@ -0,0 +1,21 @@
+package fakes
+
+type Resolver struct {
+	LookupHostCall struct {
+		CallCount int
+		Receives  struct {
+			Host string
+		}
+		Returns struct {
+			Addresses []string
+			Error     error
+		}
+	}
+}
+
+func (r *Resolver) LookupHost(host string) ([]string, error) {
+	r.LookupHostCall.CallCount++
+	r.LookupHostCall.Receives.Host = host
+
+	return r.LookupHostCall.Returns.Addresses, r.LookupHostCall.Returns.Error
+}
@@ -1,15 +1,58 @@
 package fakes
 
+import (
+	"context"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
 type SyncController struct {
 	VerifySyncedCall struct {
 		CallCount int
-		Returns   struct {
+		Stub      func(context.Context, config.Config, string) error
+		Receives  struct {
+			Context             context.Context
+			Config              config.Config
+			InitialClusterState string
+		}
+		Returns struct {
+			Error error
+		}
+	}
+	CheckSyncedCall struct {
+		CallCount int
+		Stub      func(context.Context, config.Config) error
+		Receives  struct {
+			Context context.Context
+			Config  config.Config
+		}
+		Returns struct {
 			Error error
 		}
 	}
 }
 
-func (s *SyncController) VerifySynced() error {
+func (s *SyncController) VerifySynced(ctx context.Context, etcdfabConfig config.Config, initialClusterState string) error {
 	s.VerifySyncedCall.CallCount++
+	s.VerifySyncedCall.Receives.Context = ctx
+	s.VerifySyncedCall.Receives.Config = etcdfabConfig
+	s.VerifySyncedCall.Receives.InitialClusterState = initialClusterState
+
+	if s.VerifySyncedCall.Stub != nil {
+		return s.VerifySyncedCall.Stub(ctx, etcdfabConfig, initialClusterState)
+	}
+
 	return s.VerifySyncedCall.Returns.Error
 }
+
+func (s *SyncController) CheckSynced(ctx context.Context, etcdfabConfig config.Config) error {
+	s.CheckSyncedCall.CallCount++
+	s.CheckSyncedCall.Receives.Context = ctx
+	s.CheckSyncedCall.Receives.Config = etcdfabConfig
+
+	if s.CheckSyncedCall.Stub != nil {
+		return s.CheckSyncedCall.Stub(ctx, etcdfabConfig)
+	}
+
+	return s.CheckSyncedCall.Returns.Error
+}
@@ -0,0 +1,206 @@
+// Package logging builds the logger of an etcdfab invocation.
+//
+// Every line is a lager JSON object with the fields timestamp, source,
+// message, log_level and data. The message is "etcdfab.<action>", for example
+// "etcdfab.application.start", and data always holds the command and the
+// run-id shared by every line of one invocation. See the Logs section of the
+// release README for the full schema.
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const Redacted = "[REDACTED]"
+
+var wordPattern = regexp.MustCompile(`\S+`)
+
+var levels = map[string]lager.LogLevel{
+	"debug": lager.DEBUG,
+	"info":  lager.INFO,
+	"error": lager.ERROR,
+	"fatal": lager.FATAL,
+}
+
+// NewLogger returns a logger that writes lines of at least the given level to
+// writer, tagged with the command and a new run ID. The command is not made a
+// lager session, so that messages keep the names they had before it was added.
+func NewLogger(command, level string, writer io.Writer) (lager.Logger, error) {
+	minLogLevel, ok := levels[level]
+	if !ok {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+
+	runID, err := newRunID()
+	if err != nil {
+		return nil, err
+	}
+
+	logger := lager.NewLogger("etcdfab")
+	logger.RegisterSink(NewRedactingSink(lager.NewWriterSink(writer, minLogLevel)))
+
+	return logger.WithData(lager.Data{
+		"command": command,
+		"run-id":  runID,
+	}), nil
+}
+
+func newRunID() (string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+type redactingSink struct {
+	sink lager.Sink
+}
+
+// NewRedactingSink returns a sink that hides sensitive values, such as the
+// paths of the etcd keys, before passing lines on to sink. The value of every
+// sensitive key in the data of a line is replaced, however deeply it is
+// nested, and the values of sensitive flags are replaced in every list of
+// command line arguments and every string, which covers the etcd args logged
+// on start and errors that quote a command line.
+func NewRedactingSink(sink lager.Sink) lager.Sink {
+	return redactingSink{sink: sink}
+}
+
+func (s redactingSink) Log(log lager.LogFormat) {
+	if len(log.Data) > 0 {
+		log.Data = redactData(log.Data)
+	}
+
+	s.sink.Log(log)
+}
+
+func redactData(data lager.Data) lager.Data {
+	redacted := lager.Data{}
+	for key, value := range data {
+		if sensitiveName(key) {
+			redacted[key] = Redacted
+			continue
+		}
+		redacted[key] = redactValue(value)
+	}
+
+	return redacted
+}
+
+// redactValue redacts strings, argument lists, lists and maps. Any other
+// value that is not a number or a bool, such as a struct, is redacted in the
+// form lager would log it, as decoded from its JSON.
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int, int32, int64, uint, uint32, uint64, float32, float64, json.Number:
+		return v
+	case string:
+		return redactString(v)
+	case []string:
+		return redactArgs(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i := range v {
+			redacted[i] = redactValue(v[i])
+		}
+		return redacted
+	case lager.Data:
+		return redactData(v)
+	case map[string]interface{}:
+		return map[string]interface{}(redactData(lager.Data(v)))
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return value
+	}
+
+	return redactValue(decoded)
+}
+
+// redactString treats the words of s as command line arguments and replaces
+// the values of sensitive flags among them, leaving the spacing as it was.
+func redactString(s string) string {
+	spans := wordPattern.FindAllStringIndex(s, -1)
+	if len(spans) == 0 {
+		return s
+	}
+
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = s[span[0]:span[1]]
+	}
+
+	redactedWords := redactArgs(words)
+
+	var redacted bytes.Buffer
+	end := 0
+	for i, span := range spans {
+		redacted.WriteString(s[end:span[0]])
+		redacted.WriteString(redactedWords[i])
+		end = span[1]
+	}
+	redacted.WriteString(s[end:])
+
+	return redacted.String()
+}
+
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i := 0; i < len(args); i++ {
+		redacted[i] = args[i]
+
+		flag := args[i]
+		if strings.Contains(flag, "=") {
+			flag = flag[:strings.Index(flag, "=")]
+			if sensitiveFlag(flag) {
+				redacted[i] = flag + "=" + Redacted
+			}
+			continue
+		}
+
+		if sensitiveFlag(flag) && i+1 < len(args) {
+			i++
+			redacted[i] = Redacted
+		}
+	}
+
+	return redacted
+}
+
+// sensitiveFlag reports whether the value of a flag should not be logged.
+func sensitiveFlag(flag string) bool {
+	if !strings.HasPrefix(flag, "-") {
+		return false
+	}
+
+	return sensitiveName(flag)
+}
+
+// sensitiveName reports whether the value of a flag or data key of this name
+// should not be logged: paths of certs, keys and CAs, tokens and passwords.
+func sensitiveName(name string) bool {
+	return strings.HasSuffix(name, "-file") ||
+		strings.HasSuffix(name, "-token") ||
+		strings.Contains(name, "password")
+}
@@ -0,0 +1,187 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type logLine struct {
+	Timestamp string                 `json:"timestamp"`
+	Source    string                 `json:"source"`
+	Message   string                 `json:"message"`
+	LogLevel  int                    `json:"log_level"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+func logLines(buffer *bytes.Buffer) []logLine {
+	var lines []logLine
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var parsed logLine
+		Expect(json.Unmarshal([]byte(line), &parsed)).To(Succeed())
+		lines = append(lines, parsed)
+	}
+
+	return lines
+}
+
+var _ = Describe("NewLogger", func() {
+	var buffer *bytes.Buffer
+
+	BeforeEach(func() {
+		buffer = &bytes.Buffer{}
+	})
+
+	It("tags every line with the command and a run id", func() {
+		logger, err := logging.NewLogger("start", "info", buffer)
+		Expect(err).NotTo(HaveOccurred())
+
+		logger.Info("application.start", lager.Data{"pid": 12345})
+		logger.Error("application.start.failed", errors.New("some error"))
+
+		lines := logLines(buffer)
+		Expect(lines).To(HaveLen(2))
+
+		Expect(lines[0].Source).To(Equal("etcdfab"))
+		Expect(lines[0].Message).To(Equal("etcdfab.application.start"))
+		Expect(lines[0].LogLevel).To(Equal(1))
+		Expect(lines[0].Data["pid"]).To(Equal(12345.0))
+		Expect(lines[0].Data["command"]).To(Equal("start"))
+		Expect(lines[0].Data["run-id"]).To(MatchRegexp("^[0-9a-f]{16}$"))
+
+		Expect(lines[1].Message).To(Equal("etcdfab.application.start.failed"))
+		Expect(lines[1].LogLevel).To(Equal(2))
+		Expect(lines[1].Data["error"]).To(Equal("some error"))
+		Expect(lines[1].Data["run-id"]).To(Equal(lines[0].Data["run-id"]))
+	})
+
+	It("uses a new run id for every logger", func() {
+		logger, err := logging.NewLogger("start", "info", buffer)
+		Expect(err).NotTo(HaveOccurred())
+		logger.Info("some-action")
+
+		otherLogger, err := logging.NewLogger("start", "info", buffer)
+		Expect(err).NotTo(HaveOccurred())
+		otherLogger.Info("some-action")
+
+		lines := logLines(buffer)
+		Expect(lines[0].Data["run-id"]).NotTo(Equal(lines[1].Data["run-id"]))
+	})
+
+	It("leaves out lines below the log level", func() {
+		logger, err := logging.NewLogger("stop", "error", buffer)
+		Expect(err).NotTo(HaveOccurred())
+
+		logger.Info("application.stop")
+		logger.Error("application.stop.failed", errors.New("some error"))
+
+		lines := logLines(buffer)
+		Expect(lines).To(HaveLen(1))
+		Expect(lines[0].Message).To(Equal("etcdfab.application.stop.failed"))
+	})
+
+	Context("failure cases", func() {
+		It("returns an error for an unknown log level", func() {
+			_, err := logging.NewLogger("start", "verbose", buffer)
+			Expect(err).To(MatchError(`unknown log level "verbose"`))
+		})
+	})
+})
+
+var _ = Describe("RedactingSink", func() {
+	var (
+		buffer *bytes.Buffer
+		logger lager.Logger
+	)
+
+	BeforeEach(func() {
+		buffer = &bytes.Buffer{}
+		logger = lager.NewLogger("etcdfab")
+		logger.RegisterSink(logging.NewRedactingSink(lager.NewWriterSink(buffer, lager.INFO)))
+	})
+
+	It("hides the values of sensitive flags in argument lists", func() {
+		data := lager.Data{
+			"etcd-args": []string{
+				"--name", "some-name",
+				"--initial-cluster-token", "some-token",
+				"--cert-file", "/path/to/server.crt",
+				"--peer-key-file", "/path/to/peer.key",
+				"--client-crl-file=/path/to/crl",
+				"--debug",
+			},
+			"endpoints": []string{"https://some-endpoint:4001"},
+			"pid":       12345,
+		}
+		logger.Info("application.start", data)
+
+		lines := logLines(buffer)
+		Expect(lines[0].Data["etcd-args"]).To(Equal([]interface{}{
+			"--name", "some-name",
+			"--initial-cluster-token", "[REDACTED]",
+			"--cert-file", "[REDACTED]",
+			"--peer-key-file", "[REDACTED]",
+			"--client-crl-file=[REDACTED]",
+			"--debug",
+		}))
+		Expect(lines[0].Data["endpoints"]).To(Equal([]interface{}{"https://some-endpoint:4001"}))
+		Expect(lines[0].Data["pid"]).To(Equal(12345.0))
+
+		Expect(data["etcd-args"]).To(ContainElement("/path/to/server.crt"))
+	})
+
+	It("hides the values of sensitive keys however deeply they are nested", func() {
+		logger.Info("application.start", lager.Data{
+			"cert-file": "/path/to/server.crt",
+			"tls": map[string]interface{}{
+				"key-file":  "/path/to/server.key",
+				"endpoints": []interface{}{"https://some-endpoint:4001"},
+			},
+			"peers": []interface{}{
+				lager.Data{"name": "etcd-z1-1", "admin-password": "some-password"},
+			},
+			"member": struct {
+				Name      string `json:"name"`
+				TokenFile string `json:"token-file"`
+			}{Name: "etcd-z1-0", TokenFile: "/path/to/token"},
+			"member-id": uint64(18446744073709551615),
+		})
+
+		lines := logLines(buffer)
+		Expect(lines[0].Data["cert-file"]).To(Equal("[REDACTED]"))
+		Expect(lines[0].Data["tls"]).To(Equal(map[string]interface{}{
+			"key-file":  "[REDACTED]",
+			"endpoints": []interface{}{"https://some-endpoint:4001"},
+		}))
+		Expect(lines[0].Data["peers"]).To(Equal([]interface{}{
+			map[string]interface{}{"name": "etcd-z1-1", "admin-password": "[REDACTED]"},
+		}))
+		Expect(lines[0].Data["member"]).To(Equal(map[string]interface{}{
+			"name":       "etcd-z1-0",
+			"token-file": "[REDACTED]",
+		}))
+		Expect(buffer.String()).To(ContainSubstring(`"member-id":18446744073709551615`))
+	})
+
+	It("hides the values of sensitive flags quoted in strings", func() {
+		logger.Error("application.start.failed", errors.New("etcd --name etcd-z1-0  --initial-cluster-token some-token --key-file=/path/to/server.key exited"), lager.Data{
+			"message": "started with --peer-cert-file /path/to/peer.crt",
+		})
+
+		lines := logLines(buffer)
+		Expect(lines[0].Data["error"]).To(Equal("etcd --name etcd-z1-0  --initial-cluster-token [REDACTED] --key-file=[REDACTED] exited"))
+		Expect(lines[0].Data["message"]).To(Equal("started with --peer-cert-file [REDACTED]"))
+	})
+})
@@ -0,0 +1,353 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	StartDuration     = "etcdfab_start_duration_seconds"
+	StopDuration      = "etcdfab_stop_duration_seconds"
+	MemberListRetries = "etcdfab_member_list_retries_total"
+	MemberAdds        = "etcdfab_member_add_total"
+	MemberRemoves     = "etcdfab_member_remove_total"
+	SyncAttempts      = "etcdfab_sync_attempts"
+	DataDirWipes      = "etcdfab_data_dir_wipes_total"
+	KillEscalations   = "etcdfab_kill_escalations_total"
+)
+
+type Labels map[string]string
+
+var (
+	Success = Labels{"result": "success"}
+	Failure = Labels{"result": "failure"}
+)
+
+type family struct {
+	help    string
+	kind    string
+	buckets []float64
+	series  []Labels
+}
+
+var durationBuckets = []float64{1, 2, 5, 10, 20, 30, 60, 90, 120}
+
+// families lists every metric etcdfab exposes. All series are known up front
+// and start at zero, so a series that never changed is still exposed and the
+// textfile can be merged series by series.
+var families = map[string]family{
+	StartDuration: {
+		help:    "Time etcdfab took to start etcd, including starts that failed.",
+		kind:    "histogram",
+		buckets: durationBuckets,
+	},
+	StopDuration: {
+		help:    "Time etcdfab took to leave the cluster and stop etcd.",
+		kind:    "histogram",
+		buckets: durationBuckets,
+	},
+	MemberListRetries: {
+		help: "Member list requests retried while working out the initial cluster.",
+		kind: "counter",
+	},
+	MemberAdds: {
+		help:   "Attempts to add this member to an existing cluster.",
+		kind:   "counter",
+		series: []Labels{Success, Failure},
+	},
+	MemberRemoves: {
+		help:   "Attempts to remove this member or an orphaned member from the cluster.",
+		kind:   "counter",
+		series: []Labels{Success, Failure},
+	},
+	SyncAttempts: {
+		help:    "Checks it took until etcd had synced with the cluster after it started.",
+		kind:    "histogram",
+		buckets: []float64{1, 2, 3, 5, 10, 20, 50},
+	},
+	DataDirWipes: {
+		help:   "Data dirs emptied by the data dir policy, so that the member joins from scratch.",
+		kind:   "counter",
+		series: []Labels{{"policy": "wipe"}, {"policy": "quarantine"}},
+	},
+	KillEscalations: {
+		help: "Stops that killed etcd because it did not exit within the stop timeout.",
+		kind: "counter",
+	},
+}
+
+// Registry holds the values of the metrics of one etcdfab invocation. A nil
+// *Registry discards everything, so callers do not need to check whether
+// metrics are wanted.
+type Registry struct {
+	mutex   sync.Mutex
+	values  map[string]float64
+	flushed map[string]float64
+}
+
+func NewRegistry() *Registry {
+	r := &Registry{
+		values:  map[string]float64{},
+		flushed: map[string]float64{},
+	}
+
+	for name := range families {
+		for _, key := range seriesKeys(name) {
+			r.values[key] = 0
+		}
+	}
+
+	return r
+}
+
+func (r *Registry) Inc(name string, labels Labels) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.values[seriesKey(name, labels)]++
+}
+
+func (r *Registry) Observe(name string, value float64) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, bucket := range families[name].buckets {
+		if value <= bucket {
+			r.values[seriesKey(name+"_bucket", Labels{"le": formatFloat(bucket)})]++
+		}
+	}
+	r.values[seriesKey(name+"_bucket", Labels{"le": "+Inf"})]++
+	r.values[name+"_sum"] += value
+	r.values[name+"_count"]++
+}
+
+// Value returns the current value of a series. For histograms pass the name
+// of one of its _bucket, _sum or _count series.
+func (r *Registry) Value(name string, labels Labels) float64 {
+	if r == nil {
+		return 0
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.values[seriesKey(name, labels)]
+}
+
+// Write writes the metrics in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return write(w, r.values)
+}
+
+// WriteTextfile adds what changed since the last call to the values already
+// in the file at path and atomically replaces the file, so that a textfile
+// collector sees counters that keep growing across etcdfab invocations.
+// Series in the file that etcdfab does not know are dropped. Invocations that
+// run at the same time, such as a stop during a run, take turns through a
+// lock file next to the file, so that neither loses what the other added.
+func (r *Registry) WriteTextfile(path string) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	lock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	previous, err := readTextfile(path)
+	if err != nil {
+		return err
+	}
+
+	totals := map[string]float64{}
+	for key, value := range r.values {
+		totals[key] = previous[key] + value - r.flushed[key]
+	}
+
+	var buffer bytes.Buffer
+	err = write(&buffer, totals)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmpFile.Write(buffer.Bytes())
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpFile.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return err
+	}
+
+	for key, value := range r.values {
+		r.flushed[key] = value
+	}
+
+	return nil
+}
+
+// lockFile opens the file at path and takes an exclusive flock on it, which
+// is released when the file is closed.
+func lockFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func write(w io.Writer, values map[string]float64) error {
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, families[name].help, name, families[name].kind)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range seriesKeys(name) {
+			_, err = fmt.Fprintf(w, "%s %s\n", key, formatFloat(values[key]))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func readTextfile(path string) (map[string]float64, error) {
+	values := map[string]float64{}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		separator := strings.LastIndex(line, " ")
+		if separator < 0 {
+			return nil, fmt.Errorf("invalid metrics line %q in %s", line, path)
+		}
+
+		value, err := strconv.ParseFloat(line[separator+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics line %q in %s", line, path)
+		}
+
+		values[line[:separator]] = value
+	}
+
+	return values, scanner.Err()
+}
+
+// seriesKeys returns the series of a metric in the order they are written.
+func seriesKeys(name string) []string {
+	f := families[name]
+	if f.kind == "histogram" {
+		var keys []string
+		for _, bucket := range f.buckets {
+			keys = append(keys, seriesKey(name+"_bucket", Labels{"le": formatFloat(bucket)}))
+		}
+		return append(keys,
+			seriesKey(name+"_bucket", Labels{"le": "+Inf"}),
+			name+"_sum",
+			name+"_count",
+		)
+	}
+
+	if len(f.series) == 0 {
+		return []string{name}
+	}
+
+	var keys []string
+	for _, labels := range f.series {
+		keys = append(keys, seriesKey(name, labels))
+	}
+	return keys
+}
+
+func seriesKey(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	var names []string
+	for labelName := range labels {
+		names = append(names, labelName)
+	}
+	sort.Strings(names)
+
+	var pairs []string
+	for _, labelName := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labelName, labels[labelName]))
+	}
+
+	return fmt.Sprintf("%s{%s}", name, strings.Join(pairs, ","))
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
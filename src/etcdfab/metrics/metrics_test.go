@@ -0,0 +1,165 @@
+package metrics_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	var registry *metrics.Registry
+
+	BeforeEach(func() {
+		registry = metrics.NewRegistry()
+	})
+
+	Describe("Inc", func() {
+		It("counts by labels", func() {
+			registry.Inc(metrics.MemberAdds, metrics.Success)
+			registry.Inc(metrics.MemberAdds, metrics.Success)
+			registry.Inc(metrics.MemberAdds, metrics.Failure)
+			registry.Inc(metrics.KillEscalations, nil)
+
+			Expect(registry.Value(metrics.MemberAdds, metrics.Success)).To(Equal(2.0))
+			Expect(registry.Value(metrics.MemberAdds, metrics.Failure)).To(Equal(1.0))
+			Expect(registry.Value(metrics.KillEscalations, nil)).To(Equal(1.0))
+		})
+	})
+
+	Describe("Observe", func() {
+		It("fills the buckets the value fits in", func() {
+			registry.Observe(metrics.SyncAttempts, 3)
+
+			Expect(registry.Value(metrics.SyncAttempts+"_bucket", metrics.Labels{"le": "2"})).To(Equal(0.0))
+			Expect(registry.Value(metrics.SyncAttempts+"_bucket", metrics.Labels{"le": "3"})).To(Equal(1.0))
+			Expect(registry.Value(metrics.SyncAttempts+"_bucket", metrics.Labels{"le": "50"})).To(Equal(1.0))
+			Expect(registry.Value(metrics.SyncAttempts+"_bucket", metrics.Labels{"le": "+Inf"})).To(Equal(1.0))
+			Expect(registry.Value(metrics.SyncAttempts+"_sum", nil)).To(Equal(3.0))
+			Expect(registry.Value(metrics.SyncAttempts+"_count", nil)).To(Equal(1.0))
+		})
+	})
+
+	Describe("Write", func() {
+		It("writes every series in the prometheus text format", func() {
+			registry.Inc(metrics.MemberRemoves, metrics.Failure)
+			registry.Observe(metrics.StopDuration, 1.5)
+
+			var buffer bytes.Buffer
+			Expect(registry.Write(&buffer)).To(Succeed())
+
+			output := buffer.String()
+			Expect(output).To(ContainSubstring("# HELP etcdfab_member_remove_total Attempts to remove this member or an orphaned member from the cluster.\n" +
+				"# TYPE etcdfab_member_remove_total counter\n" +
+				"etcdfab_member_remove_total{result=\"success\"} 0\n" +
+				"etcdfab_member_remove_total{result=\"failure\"} 1\n"))
+			Expect(output).To(ContainSubstring("# TYPE etcdfab_stop_duration_seconds histogram\n" +
+				"etcdfab_stop_duration_seconds_bucket{le=\"1\"} 0\n" +
+				"etcdfab_stop_duration_seconds_bucket{le=\"2\"} 1\n"))
+			Expect(output).To(ContainSubstring("etcdfab_stop_duration_seconds_bucket{le=\"+Inf\"} 1\n" +
+				"etcdfab_stop_duration_seconds_sum 1.5\n" +
+				"etcdfab_stop_duration_seconds_count 1\n"))
+			Expect(output).To(ContainSubstring("# TYPE etcdfab_kill_escalations_total counter\netcdfab_kill_escalations_total 0\n"))
+		})
+	})
+
+	Describe("WriteTextfile", func() {
+		var (
+			tmpDir string
+			path   string
+		)
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			path = filepath.Join(tmpDir, "etcdfab.prom")
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("adds to the values of earlier invocations", func() {
+			registry.Inc(metrics.DataDirWipes, metrics.Labels{"policy": "wipe"})
+			Expect(registry.WriteTextfile(path)).To(Succeed())
+
+			registry = metrics.NewRegistry()
+			registry.Inc(metrics.DataDirWipes, metrics.Labels{"policy": "wipe"})
+			registry.Inc(metrics.DataDirWipes, metrics.Labels{"policy": "quarantine"})
+			Expect(registry.WriteTextfile(path)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("etcdfab_data_dir_wipes_total{policy=\"wipe\"} 2\n"))
+			Expect(string(contents)).To(ContainSubstring("etcdfab_data_dir_wipes_total{policy=\"quarantine\"} 1\n"))
+		})
+
+		It("only adds what changed since it last wrote", func() {
+			registry.Inc(metrics.KillEscalations, nil)
+			Expect(registry.WriteTextfile(path)).To(Succeed())
+			Expect(registry.WriteTextfile(path)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("etcdfab_kill_escalations_total 1\n"))
+
+			var buffer bytes.Buffer
+			Expect(registry.Write(&buffer)).To(Succeed())
+			Expect(buffer.String()).To(Equal(string(contents)))
+		})
+
+		It("does not lose what other invocations add at the same time", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					registry := metrics.NewRegistry()
+					registry.Inc(metrics.KillEscalations, nil)
+					Expect(registry.WriteTextfile(path)).To(Succeed())
+				}()
+			}
+			wg.Wait()
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(ContainSubstring("etcdfab_kill_escalations_total 10\n"))
+			Expect(path + ".lock").To(BeARegularFile())
+		})
+
+		Context("failure cases", func() {
+			It("returns an error when the file holds something else", func() {
+				Expect(ioutil.WriteFile(path, []byte("not metrics\n"), 0644)).To(Succeed())
+
+				err := registry.WriteTextfile(path)
+				Expect(err).To(MatchError(ContainSubstring(`invalid metrics line "not metrics"`)))
+			})
+
+			It("returns an error when the directory does not exist", func() {
+				err := registry.WriteTextfile(filepath.Join(tmpDir, "missing", "etcdfab.prom"))
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when the registry is nil", func() {
+		It("discards everything", func() {
+			var nilRegistry *metrics.Registry
+			nilRegistry.Inc(metrics.KillEscalations, nil)
+			nilRegistry.Observe(metrics.StartDuration, 1)
+
+			Expect(nilRegistry.Value(metrics.KillEscalations, nil)).To(Equal(0.0))
+			Expect(nilRegistry.WriteTextfile("/path/that/is/not/written")).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,116 @@
+package preflight
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+// CertExpiryCheck fails when a certificate etcd or etcdfab uses has expired
+// and warns when one expires within the configured warning period.
+type CertExpiryCheck struct {
+	now func() time.Time
+}
+
+func NewCertExpiryCheck(now func() time.Time) CertExpiryCheck {
+	return CertExpiryCheck{
+		now: now,
+	}
+}
+
+func (CertExpiryCheck) Name() string {
+	return "cert-expiry"
+}
+
+func (c CertExpiryCheck) Run(cfg config.Config) Result {
+	var certFiles []string
+	if cfg.Etcd.RequireSSL {
+		certFiles = append(certFiles, "server-ca.crt", "server.crt", "client.crt")
+	}
+	if cfg.Etcd.PeerRequireSSL {
+		certFiles = append(certFiles, "peer-ca.crt", "peer.crt")
+	}
+
+	if len(certFiles) == 0 {
+		return Result{Status: Passed, Message: "skipped, tls is disabled"}
+	}
+
+	now := c.now()
+	warnBefore := now.Add(time.Duration(cfg.Etcd.PreflightCertExpiryWarning) * 24 * time.Hour)
+
+	var expiring []string
+	for _, certFile := range certFiles {
+		certificates, err := readCertificates(cfg.CertDir(), certFile)
+		if err != nil {
+			return Result{Status: Failed, Message: err.Error()}
+		}
+
+		for _, certificate := range certificates {
+			if now.After(certificate.NotAfter) {
+				return Result{Status: Failed, Message: fmt.Sprintf("%s expired at %s", certFile, certificate.NotAfter.UTC())}
+			}
+
+			if warnBefore.After(certificate.NotAfter) {
+				expiring = append(expiring, fmt.Sprintf("%s expires at %s", certFile, certificate.NotAfter.UTC()))
+			}
+		}
+	}
+
+	if len(expiring) > 0 {
+		return Result{Status: Warned, Message: strings.Join(expiring, ", ")}
+	}
+
+	return Result{Status: Passed, Message: fmt.Sprintf("checked %d certificate files", len(certFiles))}
+}
+
+// readCertificates reads the certificates of a file in the cert dir. Its
+// errors name the file relative to the cert dir, as do the messages of the
+// checks, so that the paths of certs and keys stay out of the logs.
+func readCertificates(certDir, certFile string) ([]*x509.Certificate, error) {
+	pemBytes, err := ioutil.ReadFile(filepath.Join(certDir, certFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %s", certFile, pathErrorReason(err))
+	}
+
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", certFile, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%s does not contain any certificates", certFile)
+	}
+
+	return certificates, nil
+}
+
+// pathErrorReason returns the error of a file operation without the path the
+// operation was on.
+func pathErrorReason(err error) string {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err.Error()
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,130 @@
+package preflight_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func writeCertificate(path string, notAfter time.Time) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: filepath.Base(path)},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	Expect(ioutil.WriteFile(path, pemBytes, 0644)).To(Succeed())
+}
+
+var _ = Describe("CertExpiryCheck", func() {
+	var (
+		certDir string
+		now     time.Time
+
+		etcdfabConfig config.Config
+		check         preflight.CertExpiryCheck
+	)
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		now = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+		for _, name := range []string{"server-ca.crt", "server.crt", "client.crt", "peer-ca.crt", "peer.crt"} {
+			writeCertificate(filepath.Join(certDir, name), now.Add(365*24*time.Hour))
+		}
+
+		etcdfabConfig = config.Config{
+			Etcd: config.Etcd{
+				CertDir:                    certDir,
+				RequireSSL:                 true,
+				PeerRequireSSL:             true,
+				PreflightCertExpiryWarning: 30,
+			},
+		}
+
+		check = preflight.NewCertExpiryCheck(func() time.Time {
+			return now
+		})
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(certDir)).To(Succeed())
+	})
+
+	It("passes when no certificate expires soon", func() {
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Passed,
+			Message: "checked 5 certificate files",
+		}))
+	})
+
+	It("warns when a certificate expires within the warning period", func() {
+		writeCertificate(filepath.Join(certDir, "peer.crt"), now.Add(10*24*time.Hour))
+
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Warned,
+			Message: "peer.crt expires at 2017-06-11 00:00:00 +0000 UTC",
+		}))
+	})
+
+	It("fails when a certificate has expired", func() {
+		writeCertificate(filepath.Join(certDir, "server.crt"), now.Add(-time.Hour))
+
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Failed,
+			Message: "server.crt expired at 2017-05-31 23:00:00 +0000 UTC",
+		}))
+	})
+
+	It("fails when a certificate cannot be parsed", func() {
+		Expect(ioutil.WriteFile(filepath.Join(certDir, "client.crt"), []byte("not a cert"), 0644)).To(Succeed())
+
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Failed,
+			Message: "client.crt does not contain any certificates",
+		}))
+	})
+
+	It("only checks the peer certificates when only peer tls is enabled", func() {
+		Expect(os.Remove(filepath.Join(certDir, "server.crt"))).To(Succeed())
+		etcdfabConfig.Etcd.RequireSSL = false
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Message).To(Equal("checked 2 certificate files"))
+	})
+
+	It("is skipped when tls is disabled", func() {
+		etcdfabConfig.Etcd.RequireSSL = false
+		etcdfabConfig.Etcd.PeerRequireSSL = false
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Passed))
+	})
+})
@@ -0,0 +1,15 @@
+package preflight
+
+import "time"
+
+// DefaultChecks returns the checks etcdfab runs before starting etcd.
+func DefaultChecks(processChecker processChecker) []Check {
+	return []Check{
+		NewPidFileCheck(processChecker, "/proc"),
+		NewDNSCheck(NetResolver{}),
+		NewMountpointCheck(),
+		NewDiskSpaceCheck(),
+		NewTLSCheck(),
+		NewCertExpiryCheck(time.Now),
+	}
+}
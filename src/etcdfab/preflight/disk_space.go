@@ -0,0 +1,50 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+const megabyte = 1024 * 1024
+
+// DiskSpaceCheck fails when the filesystem holding the data dir has less free
+// space than configured. The data dir itself may not exist yet, in which case
+// its closest existing parent is checked.
+type DiskSpaceCheck struct{}
+
+func NewDiskSpaceCheck() DiskSpaceCheck {
+	return DiskSpaceCheck{}
+}
+
+func (DiskSpaceCheck) Name() string {
+	return "disk-space"
+}
+
+func (DiskSpaceCheck) Run(cfg config.Config) Result {
+	dir := filepath.Clean(cfg.Etcd.DataDir)
+	for {
+		_, err := os.Stat(dir)
+		if err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return Result{Status: Failed, Message: fmt.Sprintf("failed to stat filesystem of %s: %s", dir, err)}
+	}
+
+	freeMegabytes := stat.Bavail * uint64(stat.Bsize) / megabyte
+	minFreeMegabytes := uint64(cfg.Etcd.PreflightMinFreeDisk)
+	if freeMegabytes < minFreeMegabytes {
+		return Result{Status: Failed, Message: fmt.Sprintf("%s has %dMB free, at least %dMB are required", dir, freeMegabytes, minFreeMegabytes)}
+	}
+
+	return Result{Status: Passed, Message: fmt.Sprintf("%s has %dMB free", dir, freeMegabytes)}
+}
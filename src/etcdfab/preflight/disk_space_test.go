@@ -0,0 +1,63 @@
+package preflight_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiskSpaceCheck", func() {
+	var (
+		tmpDir string
+		check  preflight.DiskSpaceCheck
+	)
+
+	BeforeEach(func() {
+		var err error
+		tmpDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		check = preflight.NewDiskSpaceCheck()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmpDir)).To(Succeed())
+	})
+
+	It("passes when there is enough free space", func() {
+		result := check.Run(config.Config{
+			Etcd: config.Etcd{
+				DataDir: tmpDir,
+			},
+		})
+		Expect(result.Status).To(Equal(preflight.Passed))
+		Expect(result.Message).To(MatchRegexp(`^%s has \d+MB free$`, tmpDir))
+	})
+
+	It("checks the closest existing parent when the data dir does not exist yet", func() {
+		result := check.Run(config.Config{
+			Etcd: config.Etcd{
+				DataDir: filepath.Join(tmpDir, "missing", "etcd"),
+			},
+		})
+		Expect(result.Status).To(Equal(preflight.Passed))
+		Expect(result.Message).To(HavePrefix(tmpDir + " has"))
+	})
+
+	It("fails when there is less free space than required", func() {
+		result := check.Run(config.Config{
+			Etcd: config.Etcd{
+				DataDir:              tmpDir,
+				PreflightMinFreeDisk: 1 << 30,
+			},
+		})
+		Expect(result.Status).To(Equal(preflight.Failed))
+		Expect(result.Message).To(ContainSubstring("at least 1073741824MB are required"))
+	})
+})
@@ -0,0 +1,56 @@
+package preflight
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+type resolver interface {
+	LookupHost(string) ([]string, error)
+}
+
+type NetResolver struct{}
+
+func (NetResolver) LookupHost(host string) ([]string, error) {
+	return net.LookupHost(host)
+}
+
+// DNSCheck makes sure DNS resolves before etcd is started with TLS, since the
+// advertised URLs are DNS names in that case.
+type DNSCheck struct {
+	resolver resolver
+}
+
+func NewDNSCheck(resolver resolver) DNSCheck {
+	return DNSCheck{
+		resolver: resolver,
+	}
+}
+
+func (DNSCheck) Name() string {
+	return "dns"
+}
+
+func (c DNSCheck) Run(cfg config.Config) Result {
+	if !cfg.Etcd.RequireSSL {
+		return Result{Status: Passed, Message: "skipped, require_ssl is disabled"}
+	}
+
+	host := cfg.Etcd.DNSHealthCheckHost
+	if host == "" {
+		return Result{Status: Passed, Message: "skipped, no dns health check host configured"}
+	}
+
+	addresses, err := c.resolver.LookupHost(host)
+	if err != nil {
+		return Result{Status: Failed, Message: fmt.Sprintf("failed to resolve %s: %s", host, err)}
+	}
+
+	if len(addresses) == 0 {
+		return Result{Status: Failed, Message: fmt.Sprintf("%s did not resolve to any addresses", host)}
+	}
+
+	return Result{Status: Passed, Message: fmt.Sprintf("%s resolved to %v", host, addresses)}
+}
@@ -0,0 +1,74 @@
+package preflight_test
+
+import (
+	"errors"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DNSCheck", func() {
+	var (
+		resolver      *fakes.Resolver
+		etcdfabConfig config.Config
+		check         preflight.DNSCheck
+	)
+
+	BeforeEach(func() {
+		resolver = &fakes.Resolver{}
+		resolver.LookupHostCall.Returns.Addresses = []string{"10.0.0.1"}
+
+		etcdfabConfig = config.Config{
+			Etcd: config.Etcd{
+				RequireSSL:         true,
+				DNSHealthCheckHost: "consul.service.cf.internal",
+			},
+		}
+
+		check = preflight.NewDNSCheck(resolver)
+	})
+
+	It("passes when the health check host resolves", func() {
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Passed))
+
+		Expect(resolver.LookupHostCall.Receives.Host).To(Equal("consul.service.cf.internal"))
+	})
+
+	It("fails when the health check host cannot be resolved", func() {
+		resolver.LookupHostCall.Returns.Error = errors.New("no such host")
+
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Failed,
+			Message: "failed to resolve consul.service.cf.internal: no such host",
+		}))
+	})
+
+	It("fails when the health check host resolves to nothing", func() {
+		resolver.LookupHostCall.Returns.Addresses = []string{}
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Failed))
+	})
+
+	It("is skipped when require_ssl is disabled", func() {
+		etcdfabConfig.Etcd.RequireSSL = false
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Passed))
+		Expect(resolver.LookupHostCall.CallCount).To(Equal(0))
+	})
+
+	It("is skipped when no health check host is configured", func() {
+		etcdfabConfig.Etcd.DNSHealthCheckHost = ""
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Passed))
+		Expect(resolver.LookupHostCall.CallCount).To(Equal(0))
+	})
+})
@@ -0,0 +1,60 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+// MountpointCheck warns when the directory holding the data dir is not a
+// mountpoint, which on a BOSH VM means there is no persistent disk.
+type MountpointCheck struct{}
+
+func NewMountpointCheck() MountpointCheck {
+	return MountpointCheck{}
+}
+
+func (MountpointCheck) Name() string {
+	return "mountpoint"
+}
+
+func (MountpointCheck) Run(cfg config.Config) Result {
+	storeDir := filepath.Dir(filepath.Clean(cfg.Etcd.DataDir))
+
+	mountpoint, err := isMountpoint(storeDir)
+	if err != nil {
+		return Result{Status: Warned, Message: fmt.Sprintf("could not determine whether %s is a mountpoint: %s", storeDir, err)}
+	}
+
+	if !mountpoint {
+		return Result{Status: Warned, Message: fmt.Sprintf("%s is not on a persistent disk as recommended", storeDir)}
+	}
+
+	return Result{Status: Passed, Message: fmt.Sprintf("%s is a mountpoint", storeDir)}
+}
+
+// isMountpoint compares the device of dir with the device of its parent, the
+// same way mountpoint(1) does.
+func isMountpoint(dir string) (bool, error) {
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return false, err
+	}
+
+	parentInfo, err := os.Stat(filepath.Join(dir, ".."))
+	if err != nil {
+		return false, err
+	}
+
+	dirStat := dirInfo.Sys().(*syscall.Stat_t)
+	parentStat := parentInfo.Sys().(*syscall.Stat_t)
+
+	if dirStat.Dev != parentStat.Dev {
+		return true, nil
+	}
+
+	return dirStat.Ino == parentStat.Ino, nil
+}
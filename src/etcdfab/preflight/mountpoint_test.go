@@ -0,0 +1,69 @@
+package preflight_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MountpointCheck", func() {
+	var check preflight.MountpointCheck
+
+	BeforeEach(func() {
+		check = preflight.NewMountpointCheck()
+	})
+
+	It("passes when the parent of the data dir is a mountpoint", func() {
+		result := check.Run(config.Config{
+			Etcd: config.Etcd{
+				DataDir: "/etcd",
+			},
+		})
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Passed,
+			Message: "/ is a mountpoint",
+		}))
+	})
+
+	Context("when the parent of the data dir is a plain directory", func() {
+		var tmpDir string
+
+		BeforeEach(func() {
+			var err error
+			tmpDir, err = ioutil.TempDir("", "")
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(tmpDir)).To(Succeed())
+		})
+
+		It("warns that there is no persistent disk", func() {
+			result := check.Run(config.Config{
+				Etcd: config.Etcd{
+					DataDir: filepath.Join(tmpDir, "etcd"),
+				},
+			})
+			Expect(result).To(Equal(preflight.Result{
+				Status:  preflight.Warned,
+				Message: tmpDir + " is not on a persistent disk as recommended",
+			}))
+		})
+
+		It("warns when the parent of the data dir does not exist", func() {
+			result := check.Run(config.Config{
+				Etcd: config.Etcd{
+					DataDir: filepath.Join(tmpDir, "missing", "etcd"),
+				},
+			})
+			Expect(result.Status).To(Equal(preflight.Warned))
+			Expect(result.Message).To(ContainSubstring("could not determine whether"))
+		})
+	})
+})
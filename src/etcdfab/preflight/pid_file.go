@@ -0,0 +1,76 @@
+package preflight
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+type processChecker interface {
+	Running(int) bool
+}
+
+// PidFileCheck fails when the pid file points at a running etcd and removes
+// the pid file when the process is gone or the pid now belongs to something
+// other than etcd.
+type PidFileCheck struct {
+	processChecker processChecker
+	procDir        string
+}
+
+func NewPidFileCheck(processChecker processChecker, procDir string) PidFileCheck {
+	return PidFileCheck{
+		processChecker: processChecker,
+		procDir:        procDir,
+	}
+}
+
+func (PidFileCheck) Name() string {
+	return "pid-file"
+}
+
+func (c PidFileCheck) Run(cfg config.Config) Result {
+	pidFileContents, err := ioutil.ReadFile(cfg.PidFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Result{Status: Passed, Message: "no pid file"}
+		}
+		return Result{Status: Failed, Message: fmt.Sprintf("failed to read pid file: %s", err)}
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(pidFileContents)))
+	if err == nil && c.processChecker.Running(pid) {
+		command, err := c.command(pid)
+		if err != nil {
+			return Result{Status: Failed, Message: fmt.Sprintf("pid %d in the pid file is running and its command line cannot be read: %s", pid, err)}
+		}
+
+		if filepath.Base(command) == "etcd" || command == cfg.Etcd.EtcdPath {
+			return Result{Status: Failed, Message: fmt.Sprintf("etcd is already running with pid %d, please stop it first", pid)}
+		}
+	}
+
+	err = os.Remove(cfg.PidFile())
+	if err != nil {
+		return Result{Status: Failed, Message: fmt.Sprintf("failed to remove stale pid file: %s", err)}
+	}
+
+	return Result{Status: Passed, Message: fmt.Sprintf("removed stale pid file %s", cfg.PidFile())}
+}
+
+// command returns the program a process was started as, the first of the
+// NUL separated arguments in its cmdline file.
+func (c PidFileCheck) command(pid int) (string, error) {
+	cmdline, err := ioutil.ReadFile(filepath.Join(c.procDir, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.SplitN(cmdline, []byte{0}, 2)[0]), nil
+}
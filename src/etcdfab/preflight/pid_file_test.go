@@ -0,0 +1,122 @@
+package preflight_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PidFileCheck", func() {
+	var (
+		runDir  string
+		procDir string
+		pidFile string
+
+		processChecker *fakes.CommandWrapper
+		etcdfabConfig  config.Config
+		check          preflight.PidFileCheck
+	)
+
+	BeforeEach(func() {
+		var err error
+		runDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		procDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		pidFile = filepath.Join(runDir, "etcd.pid")
+
+		processChecker = &fakes.CommandWrapper{}
+		etcdfabConfig = config.Config{
+			Etcd: config.Etcd{
+				RunDir:   runDir,
+				EtcdPath: "/var/vcap/packages/etcd/etcd",
+			},
+		}
+
+		check = preflight.NewPidFileCheck(processChecker, procDir)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(runDir)).To(Succeed())
+		Expect(os.RemoveAll(procDir)).To(Succeed())
+	})
+
+	It("passes when there is no pid file", func() {
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Passed,
+			Message: "no pid file",
+		}))
+	})
+
+	Context("when the pid file exists", func() {
+		BeforeEach(func() {
+			Expect(ioutil.WriteFile(pidFile, []byte("12345\n"), 0644)).To(Succeed())
+		})
+
+		Context("when the process is still running", func() {
+			BeforeEach(func() {
+				processChecker.RunningCall.Returns.Running = true
+				Expect(os.Mkdir(filepath.Join(procDir, "12345"), os.ModePerm)).To(Succeed())
+			})
+
+			It("fails when the process is etcd", func() {
+				cmdline := "/var/vcap/packages/etcd/etcd\x00--name\x00etcd-0\x00"
+				Expect(ioutil.WriteFile(filepath.Join(procDir, "12345", "cmdline"), []byte(cmdline), 0644)).To(Succeed())
+
+				result := check.Run(etcdfabConfig)
+				Expect(result).To(Equal(preflight.Result{
+					Status:  preflight.Failed,
+					Message: "etcd is already running with pid 12345, please stop it first",
+				}))
+
+				Expect(processChecker.RunningCall.Receives.Pid).To(Equal(12345))
+				Expect(pidFile).To(BeARegularFile())
+			})
+
+			It("removes the pid file when the pid now belongs to another program", func() {
+				cmdline := "/usr/sbin/sshd\x00-D\x00"
+				Expect(ioutil.WriteFile(filepath.Join(procDir, "12345", "cmdline"), []byte(cmdline), 0644)).To(Succeed())
+
+				result := check.Run(etcdfabConfig)
+				Expect(result.Status).To(Equal(preflight.Passed))
+
+				Expect(pidFile).NotTo(BeAnExistingFile())
+			})
+
+			It("fails when the command line of the process cannot be read", func() {
+				result := check.Run(etcdfabConfig)
+				Expect(result.Status).To(Equal(preflight.Failed))
+				Expect(result.Message).To(ContainSubstring("pid 12345 in the pid file is running and its command line cannot be read"))
+
+				Expect(pidFile).To(BeARegularFile())
+			})
+		})
+
+		It("removes the pid file when the process is gone", func() {
+			result := check.Run(etcdfabConfig)
+			Expect(result.Status).To(Equal(preflight.Passed))
+
+			Expect(pidFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	It("removes a pid file that does not contain a pid", func() {
+		Expect(ioutil.WriteFile(pidFile, []byte("garbage"), 0644)).To(Succeed())
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Passed))
+
+		Expect(processChecker.RunningCall.CallCount).To(Equal(0))
+		Expect(pidFile).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,72 @@
+package preflight
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+type Status string
+
+const (
+	Passed Status = "passed"
+	Warned Status = "warned"
+	Failed Status = "failed"
+)
+
+type Result struct {
+	Status  Status
+	Message string
+}
+
+type Check interface {
+	Name() string
+	Run(config.Config) Result
+}
+
+type logger interface {
+	Info(string, ...lager.Data)
+	Error(string, error, ...lager.Data)
+}
+
+type Runner struct {
+	checks []Check
+	logger logger
+}
+
+func NewRunner(checks []Check, logger logger) Runner {
+	return Runner{
+		checks: checks,
+		logger: logger,
+	}
+}
+
+// Run runs every check in order. In "enforce" mode the first failed check
+// stops the run and its failure is returned; in "warn" mode failures are
+// logged and the remaining checks still run.
+func (r Runner) Run(cfg config.Config) error {
+	for _, check := range r.checks {
+		result := check.Run(cfg)
+		data := lager.Data{
+			"check":   check.Name(),
+			"message": result.Message,
+		}
+
+		switch result.Status {
+		case Failed:
+			err := fmt.Errorf("preflight check %s failed: %s", check.Name(), result.Message)
+			r.logger.Error("preflight.check.failed", err, data)
+			if cfg.Etcd.PreflightMode != "warn" {
+				return err
+			}
+		case Warned:
+			r.logger.Info("preflight.check.warned", data)
+		default:
+			r.logger.Info("preflight.check.passed", data)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package preflight_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/lager"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Runner", func() {
+	var (
+		passingCheck *fakes.PreflightCheck
+		warningCheck *fakes.PreflightCheck
+		failingCheck *fakes.PreflightCheck
+		lastCheck    *fakes.PreflightCheck
+		logger       *fakes.Logger
+
+		etcdfabConfig config.Config
+		runner        preflight.Runner
+	)
+
+	BeforeEach(func() {
+		passingCheck = &fakes.PreflightCheck{}
+		passingCheck.NameCall.Returns.Name = "passing"
+		passingCheck.RunCall.Returns.Result = preflight.Result{Status: preflight.Passed, Message: "all good"}
+
+		warningCheck = &fakes.PreflightCheck{}
+		warningCheck.NameCall.Returns.Name = "warning"
+		warningCheck.RunCall.Returns.Result = preflight.Result{Status: preflight.Warned, Message: "not great"}
+
+		failingCheck = &fakes.PreflightCheck{}
+		failingCheck.NameCall.Returns.Name = "failing"
+		failingCheck.RunCall.Returns.Result = preflight.Result{Status: preflight.Failed, Message: "broken"}
+
+		lastCheck = &fakes.PreflightCheck{}
+		lastCheck.NameCall.Returns.Name = "last"
+		lastCheck.RunCall.Returns.Result = preflight.Result{Status: preflight.Passed, Message: "fine"}
+
+		logger = &fakes.Logger{}
+
+		etcdfabConfig = config.Config{
+			Etcd: config.Etcd{
+				PreflightMode: "enforce",
+			},
+		}
+
+		runner = preflight.NewRunner([]preflight.Check{passingCheck, warningCheck, failingCheck, lastCheck}, logger)
+	})
+
+	It("runs every check with the config and logs the results", func() {
+		runner = preflight.NewRunner([]preflight.Check{passingCheck, warningCheck}, logger)
+
+		err := runner.Run(etcdfabConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(passingCheck.RunCall.Receives.Config).To(Equal(etcdfabConfig))
+		Expect(warningCheck.RunCall.Receives.Config).To(Equal(etcdfabConfig))
+
+		Expect(logger.Messages()).To(Equal([]fakes.LoggerMessage{
+			{
+				Action: "preflight.check.passed",
+				Data: []lager.Data{{
+					"check":   "passing",
+					"message": "all good",
+				}},
+			},
+			{
+				Action: "preflight.check.warned",
+				Data: []lager.Data{{
+					"check":   "warning",
+					"message": "not great",
+				}},
+			},
+		}))
+	})
+
+	Context("when the mode is enforce", func() {
+		It("stops at the first failed check and returns its failure", func() {
+			err := runner.Run(etcdfabConfig)
+			Expect(err).To(MatchError("preflight check failing failed: broken"))
+
+			Expect(failingCheck.RunCall.CallCount).To(Equal(1))
+			Expect(lastCheck.RunCall.CallCount).To(Equal(0))
+
+			Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "preflight.check.failed",
+				Error:  errors.New("preflight check failing failed: broken"),
+				Data: []lager.Data{{
+					"check":   "failing",
+					"message": "broken",
+				}},
+			}))
+		})
+	})
+
+	Context("when the mode is warn", func() {
+		BeforeEach(func() {
+			etcdfabConfig.Etcd.PreflightMode = "warn"
+		})
+
+		It("logs failed checks and keeps going", func() {
+			err := runner.Run(etcdfabConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(lastCheck.RunCall.CallCount).To(Equal(1))
+
+			Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+				Action: "preflight.check.failed",
+				Error:  errors.New("preflight check failing failed: broken"),
+				Data: []lager.Data{{
+					"check":   "failing",
+					"message": "broken",
+				}},
+			}))
+		})
+	})
+})
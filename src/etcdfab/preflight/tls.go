@@ -0,0 +1,130 @@
+package preflight
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+)
+
+type keyPair struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	url      string
+}
+
+// TLSCheck validates every certificate and key etcd and etcdfab are
+// configured with: the key has to match the certificate, the certificate has
+// to chain to the configured CA, and server and peer certificates have to
+// cover the host of the URL they are advertised on. Expiry is left to
+// CertExpiryCheck. It reports every problem it finds rather than only the
+// first one.
+type TLSCheck struct{}
+
+func NewTLSCheck() TLSCheck {
+	return TLSCheck{}
+}
+
+func (TLSCheck) Name() string {
+	return "tls"
+}
+
+func (c TLSCheck) Run(cfg config.Config) Result {
+	var keyPairs []keyPair
+	if cfg.Etcd.RequireSSL {
+		keyPairs = append(keyPairs,
+			keyPair{certFile: "server.crt", keyFile: "server.key", caFile: "server-ca.crt", url: cfg.AdvertiseClientURL()},
+			keyPair{certFile: "client.crt", keyFile: "client.key", caFile: "server-ca.crt"},
+		)
+	}
+	if cfg.Etcd.PeerRequireSSL {
+		keyPairs = append(keyPairs,
+			keyPair{certFile: "peer.crt", keyFile: "peer.key", caFile: "peer-ca.crt", url: cfg.AdvertisePeerURL()},
+		)
+	}
+
+	if len(keyPairs) == 0 {
+		return Result{Status: Passed, Message: "skipped, tls is disabled"}
+	}
+
+	var problems []string
+	for _, pair := range keyPairs {
+		problems = append(problems, c.validate(cfg.CertDir(), pair)...)
+	}
+
+	if len(problems) > 0 {
+		return Result{Status: Failed, Message: strings.Join(problems, "; ")}
+	}
+
+	return Result{Status: Passed, Message: fmt.Sprintf("validated %d certificates", len(keyPairs))}
+}
+
+func (c TLSCheck) validate(certDir string, pair keyPair) []string {
+	certificates, err := readCertificates(certDir, pair.certFile)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	leaf := certificates[0]
+
+	var problems []string
+
+	_, err = tls.LoadX509KeyPair(filepath.Join(certDir, pair.certFile), filepath.Join(certDir, pair.keyFile))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("%s does not match %s: %s", pair.keyFile, pair.certFile, pathErrorReason(err)))
+	}
+
+	problems = append(problems, verifyChain(certDir, pair.certFile, pair.caFile, certificates)...)
+
+	if pair.url != "" {
+		advertiseURL, err := url.Parse(pair.url)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid advertise url %s: %s", pair.url, err))
+		} else if err := leaf.VerifyHostname(advertiseURL.Hostname()); err != nil {
+			problems = append(problems, fmt.Sprintf("%s does not cover %s: %s", pair.certFile, pair.url, err))
+		}
+	}
+
+	return problems
+}
+
+// verifyChain checks that the leaf certificate chains to the CA, using any
+// further certificates in the certificate file as intermediates. The chain is
+// verified at a time the leaf is valid and expired certificates are ignored,
+// so an expiry is only ever reported by CertExpiryCheck.
+func verifyChain(certDir, certFile, caFile string, certificates []*x509.Certificate) []string {
+	caPEM, err := ioutil.ReadFile(filepath.Join(certDir, caFile))
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read %s: %s", caFile, pathErrorReason(err))}
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return []string{fmt.Sprintf("%s does not contain any certificates", caFile)}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	_, err = certificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   certificates[0].NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		if invalidErr, ok := err.(x509.CertificateInvalidError); ok && invalidErr.Reason == x509.Expired {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s does not chain to %s: %s", certFile, caFile, err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package preflight_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/preflight"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type certificateAuthority struct {
+	certificate *x509.Certificate
+	key         *rsa.PrivateKey
+}
+
+func newCertificateAuthority(certDir, name string, notBefore time.Time) certificateAuthority {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+
+	certificate, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	writePEM(filepath.Join(certDir, name+".crt"), "CERTIFICATE", der)
+
+	return certificateAuthority{certificate: certificate, key: key}
+}
+
+func (ca certificateAuthority) issue(certDir, name string, notBefore, notAfter time.Time, dnsNames ...string) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		DNSNames:     dnsNames,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+
+	writePEM(filepath.Join(certDir, name+".crt"), "CERTIFICATE", der)
+	writePEM(filepath.Join(certDir, name+".key"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func writePEM(path, blockType string, der []byte) {
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	Expect(ioutil.WriteFile(path, pemBytes, 0644)).To(Succeed())
+}
+
+var _ = Describe("TLSCheck", func() {
+	var (
+		certDir string
+		now     time.Time
+
+		serverCA certificateAuthority
+		peerCA   certificateAuthority
+
+		etcdfabConfig config.Config
+		check         preflight.TLSCheck
+	)
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		now = time.Date(2017, time.June, 1, 0, 0, 0, 0, time.UTC)
+		notBefore := now.Add(-24 * time.Hour)
+		notAfter := now.Add(365 * 24 * time.Hour)
+
+		serverCA = newCertificateAuthority(certDir, "server-ca", notBefore)
+		serverCA.issue(certDir, "server", notBefore, notAfter, "*.etcd.service.cf.internal")
+		serverCA.issue(certDir, "client", notBefore, notAfter)
+
+		peerCA = newCertificateAuthority(certDir, "peer-ca", notBefore)
+		peerCA.issue(certDir, "peer", notBefore, notAfter, "etcd-0.etcd.service.cf.internal")
+
+		etcdfabConfig = config.Config{
+			Node: config.Node{
+				Name:  "etcd",
+				Index: 0,
+			},
+			Etcd: config.Etcd{
+				CertDir:                certDir,
+				RequireSSL:             true,
+				PeerRequireSSL:         true,
+				AdvertiseURLsDNSSuffix: "etcd.service.cf.internal",
+				ClientPort:             4001,
+				PeerPort:               7001,
+			},
+		}
+
+		check = preflight.NewTLSCheck()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(certDir)).To(Succeed())
+	})
+
+	It("passes when every certificate is valid", func() {
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Passed,
+			Message: "validated 3 certificates",
+		}))
+	})
+
+	It("fails when a key does not match its certificate", func() {
+		Expect(os.Rename(filepath.Join(certDir, "client.key"), filepath.Join(certDir, "server.key"))).To(Succeed())
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Failed))
+		Expect(result.Message).To(ContainSubstring("server.key does not match server.crt"))
+		Expect(result.Message).To(ContainSubstring("private key does not match public key"))
+	})
+
+	It("fails when a certificate is signed by a different CA", func() {
+		serverCA.issue(certDir, "peer", now.Add(-time.Hour), now.Add(time.Hour), "etcd-0.etcd.service.cf.internal")
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Failed))
+		Expect(result.Message).To(ContainSubstring("peer.crt does not chain to peer-ca.crt"))
+	})
+
+	It("leaves expired certificates to the cert-expiry check", func() {
+		serverCA.issue(certDir, "client", now.Add(-48*time.Hour), now.Add(-time.Hour))
+
+		result := check.Run(etcdfabConfig)
+		Expect(result).To(Equal(preflight.Result{
+			Status:  preflight.Passed,
+			Message: "validated 3 certificates",
+		}))
+	})
+
+	It("fails when a certificate does not cover the advertised url", func() {
+		etcdfabConfig.Node.Index = 1
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Failed))
+		Expect(result.Message).To(ContainSubstring("peer.crt does not cover https://etcd-1.etcd.service.cf.internal:7001"))
+		Expect(result.Message).NotTo(ContainSubstring("server.crt"))
+	})
+
+	It("lists every problem it finds", func() {
+		Expect(os.Remove(filepath.Join(certDir, "client.crt"))).To(Succeed())
+		etcdfabConfig.Etcd.AdvertiseURLsDNSSuffix = "some-other-suffix"
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Failed))
+		Expect(result.Message).To(ContainSubstring("server.crt does not cover"))
+		Expect(result.Message).To(ContainSubstring("failed to read client.crt: "))
+		Expect(result.Message).To(ContainSubstring("peer.crt does not cover"))
+		Expect(result.Message).NotTo(ContainSubstring(certDir))
+	})
+
+	It("is skipped when tls is disabled", func() {
+		etcdfabConfig.Etcd.RequireSSL = false
+		etcdfabConfig.Etcd.PeerRequireSSL = false
+
+		result := check.Run(etcdfabConfig)
+		Expect(result.Status).To(Equal(preflight.Passed))
+	})
+})
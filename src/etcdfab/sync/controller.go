@@ -1,18 +1,21 @@
 package sync
 
 import (
+	"context"
+	"fmt"
 	"time"
 
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/backoff"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
 
 	"code.cloudfoundry.org/lager"
 )
 
-const maxSyncCalls = 20
-
 type etcdClient interface {
-	Self() (client.EtcdClientInterface, error)
-	Keys() error
+	Leader(context.Context) (client.Member, error)
+	EndpointStatus(context.Context, string) (client.EndpointStatus, error)
 }
 
 type logger interface {
@@ -23,39 +26,148 @@ type logger interface {
 type Controller struct {
 	etcdClient etcdClient
 	logger     logger
+	metrics    *metrics.Registry
 	sleep      func(time.Duration)
 }
 
-func NewController(etcdClient etcdClient, logger logger, sleep func(time.Duration)) Controller {
+func NewController(etcdClient etcdClient, logger logger, registry *metrics.Registry, sleep func(time.Duration)) Controller {
 	return Controller{
 		etcdClient: etcdClient,
 		logger:     logger,
+		metrics:    registry,
 		sleep:      sleep,
 	}
 }
 
-func (c Controller) VerifySynced() error {
+// VerifySynced waits until the local member has applied the leader's raft log
+// up to the configured lag. A member started with initialClusterState "new"
+// may be the first of its cluster and have no leader until its peers start, so
+// for it there is nothing to catch up with and the local member answering is
+// enough. Any other member keeps looking for a leader until the sync backoff
+// runs out.
+func (c Controller) VerifySynced(ctx context.Context, etcdfabConfig config.Config, initialClusterState string) error {
+	maxLag := uint64(etcdfabConfig.Etcd.SyncMaxRaftIndexLag)
 	c.logger.Info("sync.verify-synced", lager.Data{
-		"max-sync-calls": maxSyncCalls,
+		"backoff": etcdfabConfig.Etcd.SyncBackoff,
+		"max-lag": maxLag,
 	})
 
-	selfEtcdClient, err := c.etcdClient.Self()
-	if err != nil {
-		return err
-	}
+	selfEndpoint := etcdfabConfig.EtcdClientSelfEndpoint()
+	var previousIndex uint64
+	var attempts int
 
-	for i := 0; i < maxSyncCalls; i++ {
-		c.logger.Info("sync.verify-synced.check-keys", lager.Data{
+	policy := backoff.NewPolicy(etcdfabConfig.Etcd.SyncBackoff)
+	err := policy.Retry(ctx, c.sleep, func(i int) error {
+		attempts = i + 1
+		c.logger.Info("sync.verify-synced.check-raft-index", lager.Data{
 			"index": i,
 		})
-		err = selfEtcdClient.Keys()
-		if err == nil {
-			return nil
-		} else {
-			c.logger.Error("sync.verify-synced.check-keys.failed", err)
+		selfStatus, err := c.etcdClient.EndpointStatus(ctx, selfEndpoint)
+		if err != nil {
+			c.logger.Error("sync.verify-synced.check-raft-index.failed", err)
+			return err
+		}
+
+		leader, err := c.etcdClient.Leader(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			c.logger.Info("sync.verify-synced.no-leader", lager.Data{
+				"raft-index":            selfStatus.RaftIndex,
+				"initial-cluster-state": initialClusterState,
+				"error":                 err.Error(),
+			})
+			if initialClusterState == "new" {
+				return nil
+			}
+			return err
+		}
+
+		leaderIndex, err := c.leaderRaftIndex(ctx, leader)
+		if err != nil {
+			c.logger.Error("sync.verify-synced.check-leader-raft-index.failed", err)
+			return err
+		}
+
+		lag, lagErr := raftIndexLag(selfStatus.RaftIndex, leaderIndex, maxLag)
+
+		var progress uint64
+		if i > 0 && selfStatus.RaftIndex > previousIndex {
+			progress = selfStatus.RaftIndex - previousIndex
 		}
-		c.sleep(1 * time.Second)
+		previousIndex = selfStatus.RaftIndex
+
+		data := lager.Data{
+			"raft-index":        selfStatus.RaftIndex,
+			"leader-raft-index": leaderIndex,
+			"lag":               lag,
+			"progress":          progress,
+		}
+		if lagErr != nil {
+			c.logger.Info("sync.verify-synced.lagging", data)
+			return lagErr
+		}
+
+		c.logger.Info("sync.verify-synced.synced", data)
+		return nil
+	})
+	if err == nil {
+		c.metrics.Observe(metrics.SyncAttempts, float64(attempts))
+	}
+
+	return err
+}
+
+// CheckSynced checks once, without retrying, that the local member sees a
+// leader and is at most the configured lag behind it. Unlike VerifySynced it
+// treats a cluster without a leader as not synced.
+func (c Controller) CheckSynced(ctx context.Context, etcdfabConfig config.Config) error {
+	maxLag := uint64(etcdfabConfig.Etcd.SyncMaxRaftIndexLag)
+
+	selfStatus, err := c.etcdClient.EndpointStatus(ctx, etcdfabConfig.EtcdClientSelfEndpoint())
+	if err != nil {
+		return err
+	}
+
+	leader, err := c.etcdClient.Leader(ctx)
+	if err != nil {
+		return err
 	}
 
+	leaderIndex, err := c.leaderRaftIndex(ctx, leader)
+	if err != nil {
+		return err
+	}
+
+	_, err = raftIndexLag(selfStatus.RaftIndex, leaderIndex, maxLag)
 	return err
 }
+
+// raftIndexLag returns how many raft entries the member is behind the leader,
+// and an error when that is more than maxLag.
+func raftIndexLag(selfIndex, leaderIndex, maxLag uint64) (uint64, error) {
+	var lag uint64
+	if leaderIndex > selfIndex {
+		lag = leaderIndex - selfIndex
+	}
+
+	if lag > maxLag {
+		return lag, fmt.Errorf("member is %d raft entries behind the leader, more than the allowed %d", lag, maxLag)
+	}
+
+	return lag, nil
+}
+
+func (c Controller) leaderRaftIndex(ctx context.Context, leader client.Member) (uint64, error) {
+	if len(leader.ClientURLs) == 0 {
+		return 0, fmt.Errorf("leader %s has no client urls", leader.Name)
+	}
+
+	leaderStatus, err := c.etcdClient.EndpointStatus(ctx, leader.ClientURLs[0])
+	if err != nil {
+		return 0, err
+	}
+
+	return leaderStatus.RaftIndex, nil
+}
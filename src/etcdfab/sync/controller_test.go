@@ -1,12 +1,16 @@
 package sync_test
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"code.cloudfoundry.org/lager"
 
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/client"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/config"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/fakes"
+	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/metrics"
 	"github.com/cloudfoundry-incubator/etcd-release/src/etcdfab/sync"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -14,11 +18,16 @@ import (
 
 var _ = Describe("Controller", func() {
 	var (
-		etcdClient     *fakes.EtcdClient
-		selfEtcdClient *fakes.EtcdClient
-		logger         *fakes.Logger
+		etcdClient *fakes.EtcdClient
+		logger     *fakes.Logger
+		registry   *metrics.Registry
 
 		syncController sync.Controller
+		etcdfabConfig  config.Config
+
+		selfRaftIndexes []uint64
+		leaderRaftIndex uint64
+		selfStatusError error
 
 		sleepFunc      func(time.Duration)
 		sleepDuration  time.Duration
@@ -27,16 +36,59 @@ var _ = Describe("Controller", func() {
 
 	BeforeEach(func() {
 		etcdClient = &fakes.EtcdClient{}
-		selfEtcdClient = &fakes.EtcdClient{}
 		logger = &fakes.Logger{}
+		registry = metrics.NewRegistry()
 		sleepFunc = func(duration time.Duration) {
 			sleepCallCount++
 			sleepDuration = duration
 		}
 
-		etcdClient.SelfCall.Returns.EtcdClient = selfEtcdClient
+		selfRaftIndexes = []uint64{1000}
+		leaderRaftIndex = 1000
+		selfStatusError = nil
+
+		selfCalls := 0
+		etcdClient.EndpointStatusCall.Stub = func(endpoint string) (client.EndpointStatus, error) {
+			switch endpoint {
+			case "http://some-external-ip:4001":
+				if selfStatusError != nil {
+					return client.EndpointStatus{}, selfStatusError
+				}
+				index := selfRaftIndexes[len(selfRaftIndexes)-1]
+				if selfCalls < len(selfRaftIndexes) {
+					index = selfRaftIndexes[selfCalls]
+				}
+				selfCalls++
+				return client.EndpointStatus{RaftIndex: index}, nil
+			case "http://some-leader-ip:4001":
+				return client.EndpointStatus{RaftIndex: leaderRaftIndex}, nil
+			default:
+				return client.EndpointStatus{}, errors.New("unknown endpoint")
+			}
+		}
+		etcdClient.LeaderCall.Returns.Leader = client.Member{
+			ID:         "some-leader-id",
+			Name:       "some-leader",
+			ClientURLs: []string{"http://some-leader-ip:4001"},
+		}
+
+		etcdfabConfig = config.Config{
+			Node: config.Node{
+				ExternalIP: "some-external-ip",
+			},
+			Etcd: config.Etcd{
+				ClientPort: 4001,
+				SyncBackoff: config.Backoff{
+					Initial:    1000,
+					Max:        1000,
+					Multiplier: 1,
+					Deadline:   20000,
+				},
+				SyncMaxRaftIndexLag: 100,
+			},
+		}
 
-		syncController = sync.NewController(etcdClient, logger, sleepFunc)
+		syncController = sync.NewController(etcdClient, logger, registry, sleepFunc)
 	})
 
 	AfterEach(func() {
@@ -45,105 +97,304 @@ var _ = Describe("Controller", func() {
 	})
 
 	Describe("VerifySynced", func() {
-		Context("when etcdClient.Keys eventually returns no error", func() {
+		Context("when the member has caught up with the leader", func() {
 			BeforeEach(func() {
-				selfEtcdClient.KeysCall.Stub = func() error {
-					if selfEtcdClient.KeysCall.CallCount >= 5 {
-						return nil
-					}
-
-					return errors.New("not synced")
-				}
+				selfRaftIndexes = []uint64{950}
 			})
 
-			It("returns no error", func() {
-				err := syncController.VerifySynced()
+			It("returns no error without sleeping", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
 				Expect(err).NotTo(HaveOccurred())
 
-				Expect(etcdClient.SelfCall.CallCount).To(Equal(1))
-				Expect(selfEtcdClient.KeysCall.CallCount).To(Equal(5))
-				Expect(sleepDuration).To(Equal(1 * time.Second))
-				Expect(sleepCallCount).To(Equal(4))
+				Expect(etcdClient.LeaderCall.CallCount).To(Equal(1))
+				Expect(etcdClient.EndpointStatusCall.CallCount).To(Equal(2))
+				Expect(sleepCallCount).To(Equal(0))
 				Expect(logger.Messages()).To(ConsistOf([]fakes.LoggerMessage{
 					{
 						Action: "sync.verify-synced",
 						Data: []lager.Data{{
-							"max-sync-calls": 20,
+							"backoff": config.Backoff{
+								Initial:    1000,
+								Max:        1000,
+								Multiplier: 1,
+								Deadline:   20000,
+							},
+							"max-lag": uint64(100),
 						}},
 					},
 					{
-						Action: "sync.verify-synced.check-keys",
+						Action: "sync.verify-synced.check-raft-index",
 						Data: []lager.Data{{
 							"index": 0,
 						}},
 					},
 					{
-						Action: "sync.verify-synced.check-keys.failed",
-						Error:  errors.New("not synced"),
-					},
-					{
-						Action: "sync.verify-synced.check-keys",
-						Data: []lager.Data{{
-							"index": 1,
-						}},
-					},
-					{
-						Action: "sync.verify-synced.check-keys.failed",
-						Error:  errors.New("not synced"),
-					},
-					{
-						Action: "sync.verify-synced.check-keys",
+						Action: "sync.verify-synced.synced",
 						Data: []lager.Data{{
-							"index": 2,
+							"raft-index":        uint64(950),
+							"leader-raft-index": uint64(1000),
+							"lag":               uint64(50),
+							"progress":          uint64(0),
 						}},
 					},
-					{
-						Action: "sync.verify-synced.check-keys.failed",
-						Error:  errors.New("not synced"),
-					},
-					{
-						Action: "sync.verify-synced.check-keys",
+				}))
+			})
+		})
+
+		Context("when the member catches up with the leader eventually", func() {
+			BeforeEach(func() {
+				selfRaftIndexes = []uint64{10, 400, 950}
+			})
+
+			It("reports the progress and returns no error", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(sleepCallCount).To(Equal(2))
+				Expect(sleepDuration).To(Equal(1 * time.Second))
+				Expect(registry.Value(metrics.SyncAttempts+"_sum", nil)).To(Equal(3.0))
+				Expect(registry.Value(metrics.SyncAttempts+"_count", nil)).To(Equal(1.0))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "sync.verify-synced.lagging",
+					Data: []lager.Data{{
+						"raft-index":        uint64(10),
+						"leader-raft-index": uint64(1000),
+						"lag":               uint64(990),
+						"progress":          uint64(0),
+					}},
+				}))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "sync.verify-synced.lagging",
+					Data: []lager.Data{{
+						"raft-index":        uint64(400),
+						"leader-raft-index": uint64(1000),
+						"lag":               uint64(600),
+						"progress":          uint64(390),
+					}},
+				}))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "sync.verify-synced.synced",
+					Data: []lager.Data{{
+						"raft-index":        uint64(950),
+						"leader-raft-index": uint64(1000),
+						"lag":               uint64(50),
+						"progress":          uint64(550),
+					}},
+				}))
+			})
+		})
+
+		Context("when the member is stuck behind the leader", func() {
+			BeforeEach(func() {
+				selfRaftIndexes = []uint64{10}
+			})
+
+			It("reports no progress and returns an error once the backoff runs out", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).To(MatchError("member is 990 raft entries behind the leader, more than the allowed 100"))
+
+				Expect(etcdClient.LeaderCall.CallCount).To(Equal(20))
+				Expect(sleepCallCount).To(Equal(20))
+				Expect(registry.Value(metrics.SyncAttempts+"_count", nil)).To(Equal(0.0))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "sync.verify-synced.lagging",
+					Data: []lager.Data{{
+						"raft-index":        uint64(10),
+						"leader-raft-index": uint64(1000),
+						"lag":               uint64(990),
+						"progress":          uint64(0),
+					}},
+				}))
+			})
+		})
+
+		Context("when the member is ahead of the leader it last asked", func() {
+			BeforeEach(func() {
+				selfRaftIndexes = []uint64{1200}
+			})
+
+			It("considers it synced", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the cluster has no leader", func() {
+			BeforeEach(func() {
+				etcdClient.LeaderCall.Returns.Error = errors.New("cluster has no leader")
+			})
+
+			Context("and the member bootstraps a new cluster", func() {
+				It("returns no error once the member answers", func() {
+					err := syncController.VerifySynced(context.Background(), etcdfabConfig, "new")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(etcdClient.EndpointStatusCall.CallCount).To(Equal(1))
+					Expect(sleepCallCount).To(Equal(0))
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "sync.verify-synced.no-leader",
 						Data: []lager.Data{{
-							"index": 3,
+							"raft-index":            uint64(1000),
+							"initial-cluster-state": "new",
+							"error":                 "cluster has no leader",
 						}},
-					},
-					{
-						Action: "sync.verify-synced.check-keys.failed",
-						Error:  errors.New("not synced"),
-					},
-					{
-						Action: "sync.verify-synced.check-keys",
+					}))
+				})
+			})
+
+			Context("and the member joins an existing cluster", func() {
+				It("keeps looking for the leader and returns the error once the backoff runs out", func() {
+					err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+					Expect(err).To(MatchError("cluster has no leader"))
+
+					Expect(etcdClient.LeaderCall.CallCount).To(Equal(20))
+					Expect(sleepCallCount).To(Equal(20))
+					Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+						Action: "sync.verify-synced.no-leader",
 						Data: []lager.Data{{
-							"index": 4,
+							"raft-index":            uint64(1000),
+							"initial-cluster-state": "existing",
+							"error":                 "cluster has no leader",
 						}},
-					},
-				}))
+					}))
+				})
+
+				It("checks the lag once a leader is elected", func() {
+					etcdClient.LeaderCall.Stub = func() (client.Member, error) {
+						if etcdClient.LeaderCall.CallCount < 3 {
+							return client.Member{}, errors.New("cluster has no leader")
+						}
+						return client.Member{
+							ID:         "some-leader-id",
+							Name:       "some-leader",
+							ClientURLs: []string{"http://some-leader-ip:4001"},
+						}, nil
+					}
+
+					err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+					Expect(err).NotTo(HaveOccurred())
+
+					Expect(etcdClient.LeaderCall.CallCount).To(Equal(3))
+					Expect(sleepCallCount).To(Equal(2))
+				})
+			})
+		})
+
+		Context("when the leader cannot be found because the context is done", func() {
+			It("returns the context error instead of considering the member synced", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				etcdClient.LeaderCall.Returns.Error = errors.New("context canceled")
+
+				err := syncController.VerifySynced(ctx, etcdfabConfig, "existing")
+				Expect(err).To(MatchError(context.Canceled))
 			})
 		})
 
-		Context("when etcdClient.Keys never syncs", func() {
+		Context("when the member never answers", func() {
 			BeforeEach(func() {
-				selfEtcdClient.KeysCall.Returns.Error = errors.New("never syncs")
+				selfStatusError = errors.New("connection refused")
 			})
 
 			It("returns the error", func() {
-				err := syncController.VerifySynced()
-				Expect(err).To(MatchError("never syncs"))
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).To(MatchError("connection refused"))
 
-				Expect(selfEtcdClient.KeysCall.CallCount).To(Equal(20))
+				Expect(etcdClient.EndpointStatusCall.CallCount).To(Equal(20))
+				Expect(etcdClient.LeaderCall.CallCount).To(Equal(0))
 				Expect(sleepCallCount).To(Equal(20))
 			})
 		})
 
-		Context("when etcdClient.Self fails", func() {
+		Context("when the leader cannot be reached", func() {
 			BeforeEach(func() {
-				etcdClient.SelfCall.Returns.Error = errors.New("failed to get etcd client for self")
+				etcdClient.LeaderCall.Returns.Leader.ClientURLs = []string{"http://some-other-ip:4001"}
 			})
 
-			It("returns the error", func() {
-				err := syncController.VerifySynced()
-				Expect(err).To(MatchError("failed to get etcd client for self"))
+			It("keeps checking and returns the error", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).To(MatchError("unknown endpoint"))
+
+				Expect(sleepCallCount).To(Equal(20))
+				Expect(logger.Messages()).To(ContainElement(fakes.LoggerMessage{
+					Action: "sync.verify-synced.check-leader-raft-index.failed",
+					Error:  errors.New("unknown endpoint"),
+				}))
 			})
 		})
+
+		Context("when the leader has no client urls", func() {
+			BeforeEach(func() {
+				etcdClient.LeaderCall.Returns.Leader.ClientURLs = nil
+			})
+
+			It("returns an error", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).To(MatchError("leader some-leader has no client urls"))
+			})
+		})
+
+		Context("when the sync backoff grows", func() {
+			BeforeEach(func() {
+				selfStatusError = errors.New("connection refused")
+				etcdfabConfig.Etcd.SyncBackoff = config.Backoff{
+					Initial:    500,
+					Max:        2000,
+					Multiplier: 2,
+					Deadline:   6000,
+				}
+				sleepFunc = func(duration time.Duration) {
+					sleepCallCount++
+					sleepDuration += duration
+				}
+				syncController = sync.NewController(etcdClient, logger, registry, sleepFunc)
+			})
+
+			It("waits longer between checks until the deadline", func() {
+				err := syncController.VerifySynced(context.Background(), etcdfabConfig, "existing")
+				Expect(err).To(MatchError("connection refused"))
+
+				Expect(etcdClient.EndpointStatusCall.CallCount).To(Equal(5))
+				Expect(sleepCallCount).To(Equal(5))
+				Expect(sleepDuration).To(Equal(7500 * time.Millisecond))
+			})
+		})
+	})
+
+	Describe("CheckSynced", func() {
+		It("returns no error when the member is within the allowed lag", func() {
+			selfRaftIndexes = []uint64{950}
+
+			err := syncController.CheckSynced(context.Background(), etcdfabConfig)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(etcdClient.EndpointStatusCall.CallCount).To(Equal(2))
+			Expect(sleepCallCount).To(Equal(0))
+		})
+
+		It("returns an error without retrying when the member is lagging", func() {
+			selfRaftIndexes = []uint64{850}
+
+			err := syncController.CheckSynced(context.Background(), etcdfabConfig)
+			Expect(err).To(MatchError("member is 150 raft entries behind the leader, more than the allowed 100"))
+
+			Expect(etcdClient.EndpointStatusCall.CallCount).To(Equal(2))
+			Expect(sleepCallCount).To(Equal(0))
+		})
+
+		It("returns an error when the cluster has no leader", func() {
+			etcdClient.LeaderCall.Returns.Error = errors.New("cluster has no leader")
+
+			err := syncController.CheckSynced(context.Background(), etcdfabConfig)
+			Expect(err).To(MatchError("cluster has no leader"))
+		})
+
+		It("returns an error when the member does not answer", func() {
+			selfStatusError = errors.New("connection refused")
+
+			err := syncController.CheckSynced(context.Background(), etcdfabConfig)
+			Expect(err).To(MatchError("connection refused"))
+			Expect(etcdClient.LeaderCall.CallCount).To(Equal(0))
+		})
 	})
 })